@@ -0,0 +1,122 @@
+// Package ahocorasick implements a multi-pattern substring matcher.
+//
+// The automaton is built once from a set of byte patterns and reports every
+// pattern that occurs in a text in a single pass, regardless of the number of
+// patterns.  Transitions are stored sparsely to keep memory proportional to
+// the total length of the patterns.
+package ahocorasick
+
+import (
+	"sort"
+)
+
+type edgeT struct {
+	b    byte
+	next int32
+}
+
+type nodeT struct {
+	edges []edgeT // Sorted by byte
+	fail  int32   // Longest proper suffix that is also a trie prefix
+	dict  int32   // Nearest suffix node that terminates a pattern; -1 if none
+	out   []int   // Pattern ids terminating at this node
+}
+
+type Automaton struct {
+	nodes []nodeT
+}
+
+// Build an automaton over patterns; a pattern's id is its index.
+// Empty patterns are ignored.
+func Build(patterns []string) *Automaton {
+	a := &Automaton{nodes: []nodeT{{dict: -1}}}
+
+	for id, p := range patterns {
+		if p == "" {
+			continue
+		}
+		var cur int32
+		for i := 0; i < len(p); i++ {
+			cur = a.child(cur, p[i], true)
+		}
+		a.nodes[cur].out = append(a.nodes[cur].out, id)
+	}
+
+	a.link()
+	return a
+}
+
+// Scan text and call fn with the id of each pattern found.
+// A pattern is reported once per occurrence.
+func (a *Automaton) Scan(text string, fn func(id int)) {
+	var cur int32
+	for i := 0; i < len(text); i++ {
+		cur = a.next(cur, text[i])
+
+		for n := cur; n >= 0; n = a.nodes[n].dict {
+			for _, id := range a.nodes[n].out {
+				fn(id)
+			}
+		}
+	}
+}
+
+// Follow the goto function, falling back along failure links.
+func (a *Automaton) next(cur int32, b byte) int32 {
+	for {
+		if n := a.child(cur, b, false); n >= 0 {
+			return n
+		}
+		if cur == 0 {
+			return 0
+		}
+		cur = a.nodes[cur].fail
+	}
+}
+
+func (a *Automaton) child(cur int32, b byte, create bool) int32 {
+	edges := a.nodes[cur].edges
+	i := sort.Search(len(edges), func(i int) bool { return edges[i].b >= b })
+	if i < len(edges) && edges[i].b == b {
+		return edges[i].next
+	}
+	if !create {
+		return -1
+	}
+
+	n := int32(len(a.nodes))
+	a.nodes = append(a.nodes, nodeT{dict: -1})
+
+	edges = append(edges, edgeT{})
+	copy(edges[i+1:], edges[i:])
+	edges[i] = edgeT{b: b, next: n}
+	a.nodes[cur].edges = edges
+	return n
+}
+
+// Compute failure and dictionary links breadth first.
+func (a *Automaton) link() {
+	queue := make([]int32, 0, len(a.nodes))
+
+	for _, e := range a.nodes[0].edges {
+		a.nodes[e.next].fail = 0
+		queue = append(queue, e.next)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, e := range a.nodes[cur].edges {
+			fail := a.next(a.nodes[cur].fail, e.b)
+			a.nodes[e.next].fail = fail
+
+			if len(a.nodes[fail].out) > 0 {
+				a.nodes[e.next].dict = fail
+			} else {
+				a.nodes[e.next].dict = a.nodes[fail].dict
+			}
+			queue = append(queue, e.next)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ahocorasick
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func found(a *Automaton, text string, n int) []bool {
+	res := make([]bool, n)
+	a.Scan(text, func(id int) { res[id] = true })
+	return res
+}
+
+func TestScan(t *testing.T) {
+	var tests = map[string]struct {
+		patterns []string
+		text     string
+		expect   []bool
+	}{
+		"Overlap": {
+			patterns: []string{"he", "she", "his", "hers"},
+			text:     "ushers",
+			expect:   []bool{true, true, false, true},
+		},
+		"Nested": {
+			patterns: []string{"a", "aa", "aaa", "b"},
+			text:     "aa",
+			expect:   []bool{true, true, false, false},
+		},
+		"Empty": {
+			patterns: []string{"", "x"},
+			text:     "xyz",
+			expect:   []bool{false, true},
+		},
+		"Dupes": {
+			patterns: []string{"abc", "abc", "bc"},
+			text:     "zabcz",
+			expect:   []bool{true, true, true},
+		},
+		"NoText": {
+			patterns: []string{"abc"},
+			text:     "",
+			expect:   []bool{false},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := Build(tc.patterns)
+			if got := found(a, tc.text, len(tc.patterns)); !slices.Equal(got, tc.expect) {
+				t.Errorf("Expected %v, got %v", tc.expect, got)
+			}
+		})
+	}
+}
+
+// Results must agree with strings.Contains on random input.
+func TestScanRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	randStr := func(n int) string {
+		var sb strings.Builder
+		for range n {
+			sb.WriteByte("abc"[rng.Intn(3)])
+		}
+		return sb.String()
+	}
+
+	for range 200 {
+		patterns := make([]string, 1+rng.Intn(20))
+		for i := range patterns {
+			patterns[i] = randStr(1 + rng.Intn(5))
+		}
+		a := Build(patterns)
+
+		for range 20 {
+			text := randStr(rng.Intn(30))
+			got := found(a, text, len(patterns))
+			for i, p := range patterns {
+				if got[i] != strings.Contains(text, p) {
+					t.Fatalf("Pattern %q in %q: expected %v, got %v", p, text, !got[i], got[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,422 @@
+// Package jsonscan extracts the values at a fixed set of object paths from a
+// JSON document in a single pass, without building a tree.
+//
+// The whole document is validated; values off the requested paths are
+// skipped without being decoded.  Each extracted value is returned as its raw
+// JSON text, so a scan does not allocate.
+package jsonscan
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax    = errors.New("invalid json")
+	ErrDepth     = errors.New("json nested too deeply")
+	ErrRange     = errors.New("json number out of range")
+	ErrEscapeKey = errors.New("escaped key on path")
+	ErrNotObject = errors.New("json document is not an object")
+)
+
+const maxDepth = 10000
+
+// Kind of a JSON value; kinds from Null onwards are in jq sort order.
+type Kind uint8
+
+const (
+	Missing  Kind = iota // Path not present in the document
+	Mismatch             // Path crosses a value that is neither an object nor null
+	Null
+	False
+	True
+	Number
+	String
+	Array
+	Object
+)
+
+type Value struct {
+	Kind Kind
+	Raw  string // Raw JSON text of the value
+}
+
+type nodeT struct {
+	key      string
+	children []*nodeT
+	ids      []int // Paths ending at this node
+	sub      []int // Paths ending strictly below this node
+}
+
+// Paths is a compiled set of object key paths.
+type Paths struct {
+	root nodeT
+	n    int
+}
+
+// Compile a set of paths; the value for paths[i] is returned in vals[i].
+func Compile(paths [][]string) *Paths {
+	p := &Paths{n: len(paths)}
+
+	for id, path := range paths {
+		n := &p.root
+		for _, key := range path {
+			n.sub = append(n.sub, id)
+			n = n.child(key)
+		}
+		n.ids = append(n.ids, id)
+	}
+
+	return p
+}
+
+func (n *nodeT) child(key string) *nodeT {
+	for _, c := range n.children {
+		if c.key == key {
+			return c
+		}
+	}
+	c := &nodeT{key: key}
+	n.children = append(n.children, c)
+	return c
+}
+
+// Len returns the number of compiled paths.
+func (p *Paths) Len() int {
+	return p.n
+}
+
+// Scan validates doc and stores the value found at each path in vals, which
+// must hold at least Len() values.  As with encoding/json, the last of
+// duplicate keys wins.  Returns ErrNotObject if doc is valid but its root is
+// not an object.
+func (p *Paths) Scan(doc string, vals []Value) error {
+	for _, id := range p.root.ids {
+		vals[id] = Value{}
+	}
+	for _, id := range p.root.sub {
+		vals[id] = Value{}
+	}
+
+	s := scannerT{s: doc}
+	s.ws()
+
+	kind, err := s.value(&p.root, vals, 0)
+	if err != nil {
+		return err
+	}
+
+	if s.ws(); s.i != len(s.s) {
+		return ErrSyntax
+	}
+
+	if kind != Object {
+		return ErrNotObject
+	}
+
+	return nil
+}
+
+type scannerT struct {
+	s string
+	i int
+}
+
+func (s *scannerT) ws() {
+	for s.i < len(s.s) {
+		switch s.s[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+// Scan a value; n is the path node the value is bound to, or nil.
+func (s *scannerT) value(n *nodeT, vals []Value, depth int) (kind Kind, err error) {
+	if n != nil {
+		// Reset paths below n; a duplicate key may have set them.
+		for _, id := range n.sub {
+			vals[id] = Value{}
+		}
+	}
+
+	start := s.i
+
+	if n != nil && len(n.children) > 0 && s.i < len(s.s) && s.s[s.i] == '{' {
+		kind, err = Object, s.object(n, vals, depth+1)
+	} else {
+		kind, err = s.skip(depth)
+	}
+
+	if err != nil || n == nil {
+		return
+	}
+
+	for _, id := range n.ids {
+		vals[id] = Value{Kind: kind, Raw: s.s[start:s.i]}
+	}
+
+	switch kind {
+	case Object:
+	case Null:
+		// Indexing null yields null.
+		for _, id := range n.sub {
+			vals[id] = Value{Kind: Null, Raw: "null"}
+		}
+	default:
+		for _, id := range n.sub {
+			vals[id] = Value{Kind: Mismatch}
+		}
+	}
+
+	return
+}
+
+// Scan an object whose keys are matched against the children of n.
+func (s *scannerT) object(n *nodeT, vals []Value, depth int) error {
+	if depth > maxDepth {
+		return ErrDepth
+	}
+
+	s.i++ // '{'
+	s.ws()
+
+	if s.i < len(s.s) && s.s[s.i] == '}' {
+		s.i++
+		return nil
+	}
+
+	for {
+		key, escaped, err := s.str()
+		if err != nil {
+			return err
+		}
+		if escaped {
+			// Keys are compared undecoded.
+			return ErrEscapeKey
+		}
+
+		var c *nodeT
+		for _, child := range n.children {
+			if child.key == key {
+				c = child
+				break
+			}
+		}
+
+		if s.ws(); s.i >= len(s.s) || s.s[s.i] != ':' {
+			return ErrSyntax
+		}
+		s.i++
+		s.ws()
+
+		if _, err := s.value(c, vals, depth); err != nil {
+			return err
+		}
+
+		s.ws()
+		if s.i >= len(s.s) {
+			return ErrSyntax
+		}
+		switch s.s[s.i] {
+		case ',':
+			s.i++
+			s.ws()
+		case '}':
+			s.i++
+			return nil
+		default:
+			return ErrSyntax
+		}
+	}
+}
+
+// Skip a value without tracking paths.
+func (s *scannerT) skip(depth int) (Kind, error) {
+	if s.i >= len(s.s) {
+		return Missing, ErrSyntax
+	}
+
+	switch c := s.s[s.i]; {
+	case c == '{':
+		return Object, s.skipContainer('}', depth+1)
+	case c == '[':
+		return Array, s.skipContainer(']', depth+1)
+	case c == '"':
+		_, _, err := s.str()
+		return String, err
+	case c == 't':
+		return True, s.lit("true")
+	case c == 'f':
+		return False, s.lit("false")
+	case c == 'n':
+		return Null, s.lit("null")
+	case c == '-' || ('0' <= c && c <= '9'):
+		return Number, s.num()
+	}
+
+	return Missing, ErrSyntax
+}
+
+func (s *scannerT) skipContainer(end byte, depth int) error {
+	if depth > maxDepth {
+		return ErrDepth
+	}
+
+	s.i++
+	s.ws()
+
+	if s.i < len(s.s) && s.s[s.i] == end {
+		s.i++
+		return nil
+	}
+
+	for {
+		if end == '}' {
+			if _, _, err := s.str(); err != nil {
+				return err
+			}
+			if s.ws(); s.i >= len(s.s) || s.s[s.i] != ':' {
+				return ErrSyntax
+			}
+			s.i++
+			s.ws()
+		}
+
+		if _, err := s.skip(depth); err != nil {
+			return err
+		}
+
+		s.ws()
+		if s.i >= len(s.s) {
+			return ErrSyntax
+		}
+		switch s.s[s.i] {
+		case ',':
+			s.i++
+			s.ws()
+		case end:
+			s.i++
+			return nil
+		default:
+			return ErrSyntax
+		}
+	}
+}
+
+func (s *scannerT) lit(want string) error {
+	if !strings.HasPrefix(s.s[s.i:], want) {
+		return ErrSyntax
+	}
+	s.i += len(want)
+	return nil
+}
+
+// Scan a string; returns its undecoded contents and whether it has escapes.
+func (s *scannerT) str() (string, bool, error) {
+	if s.i >= len(s.s) || s.s[s.i] != '"' {
+		return "", false, ErrSyntax
+	}
+
+	var (
+		start   = s.i + 1
+		escaped bool
+	)
+
+	for i := start; i < len(s.s); i++ {
+		switch c := s.s[i]; {
+		case c == '"':
+			s.i = i + 1
+			return s.s[start:i], escaped, nil
+		case c == '\\':
+			escaped = true
+			if i+1 >= len(s.s) {
+				return "", false, ErrSyntax
+			}
+			i++
+			switch s.s[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(s.s) || !isHex(s.s[i+1]) || !isHex(s.s[i+2]) || !isHex(s.s[i+3]) || !isHex(s.s[i+4]) {
+					return "", false, ErrSyntax
+				}
+				i += 4
+			default:
+				return "", false, ErrSyntax
+			}
+		case c < 0x20:
+			return "", false, ErrSyntax
+		}
+	}
+
+	return "", false, ErrSyntax
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (s *scannerT) num() error {
+	var (
+		start = s.i
+		i     = s.i
+		exp   bool
+	)
+
+	if s.s[i] == '-' {
+		i++
+	}
+
+	switch {
+	case i < len(s.s) && s.s[i] == '0':
+		i++
+	case i < len(s.s) && isDigit(s.s[i]):
+		for i < len(s.s) && isDigit(s.s[i]) {
+			i++
+		}
+	default:
+		return ErrSyntax
+	}
+
+	if i < len(s.s) && s.s[i] == '.' {
+		i++
+		if i >= len(s.s) || !isDigit(s.s[i]) {
+			return ErrSyntax
+		}
+		for i < len(s.s) && isDigit(s.s[i]) {
+			i++
+		}
+	}
+
+	if i < len(s.s) && (s.s[i] == 'e' || s.s[i] == 'E') {
+		exp = true
+		i++
+		if i < len(s.s) && (s.s[i] == '+' || s.s[i] == '-') {
+			i++
+		}
+		if i >= len(s.s) || !isDigit(s.s[i]) {
+			return ErrSyntax
+		}
+		for i < len(s.s) && isDigit(s.s[i]) {
+			i++
+		}
+	}
+
+	s.i = i
+
+	// Only an exponent or a very long mantissa can overflow a float64.
+	if exp || i-start > 300 {
+		if _, err := strconv.ParseFloat(s.s[start:i], 64); err != nil {
+			return ErrRange
+		}
+	}
+
+	return nil
+}
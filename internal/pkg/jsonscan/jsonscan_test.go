@@ -0,0 +1,129 @@
+package jsonscan
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	paths := Compile([][]string{
+		{"a"},
+		{"a", "b"},
+		{"c"},
+		{"a", "b", "c"},
+	})
+
+	var tests = map[string]struct {
+		doc  string
+		err  error
+		vals []Value
+	}{
+		"Found": {
+			doc:  `{"a": {"b": "x"}, "c": [1, 2]}`,
+			vals: []Value{{Object, `{"b": "x"}`}, {String, `"x"`}, {Array, `[1, 2]`}, {Mismatch, ""}},
+		},
+		"Missing": {
+			doc:  `{"z": 1}`,
+			vals: []Value{{}, {}, {}, {}},
+		},
+		"NullParent": {
+			doc:  `{"a": null}`,
+			vals: []Value{{Null, "null"}, {Null, "null"}, {}, {Null, "null"}},
+		},
+		"ScalarParent": {
+			doc:  `{"a": 5, "c": true}`,
+			vals: []Value{{Number, "5"}, {Mismatch, ""}, {True, "true"}, {Mismatch, ""}},
+		},
+		"DuplicateKey": {
+			doc:  `{"a": {"b": 1}, "a": {"x": 2}}`,
+			vals: []Value{{Object, `{"x": 2}`}, {}, {}, {}},
+		},
+		"DuplicateScalar": {
+			doc:  `{"a": {"b": {"c": 1}}, "a": 3}`,
+			vals: []Value{{Number, "3"}, {Mismatch, ""}, {}, {Mismatch, ""}},
+		},
+		"Nested": {
+			doc:  `{"x": {"a": 1}, "a": {"y": [{"b": 2}], "b": {"c": -1.5e3}}}`,
+			vals: []Value{{Object, `{"y": [{"b": 2}], "b": {"c": -1.5e3}}`}, {Object, `{"c": -1.5e3}`}, {}, {Number, "-1.5e3"}},
+		},
+		"EscapedValue": {
+			doc:  `{"c": "a\"bé"}`,
+			vals: []Value{{}, {}, {String, `"a\"bé"`}, {}},
+		},
+		"EscapedKey":    {doc: `{"\u0061": 1}`, err: ErrEscapeKey},
+		"NotObject":     {doc: `[1, 2]`, err: ErrNotObject},
+		"Empty":         {doc: ``, err: ErrSyntax},
+		"Truncated":     {doc: `{"a": 1`, err: ErrSyntax},
+		"Trailing":      {doc: `{} {}`, err: ErrSyntax},
+		"BadNumber":     {doc: `{"x": 01}`, err: ErrSyntax},
+		"BadEscape":     {doc: `{"x": "\q"}`, err: ErrSyntax},
+		"ControlChar":   {doc: "{\"x\": \"\t\"}", err: ErrSyntax},
+		"BadLiteral":    {doc: `{"x": nul}`, err: ErrSyntax},
+		"Overflow":      {doc: `{"x": 1e400}`, err: ErrRange},
+		"TrailingComma": {doc: `{"x": 1,}`, err: ErrSyntax},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			vals := make([]Value, paths.Len())
+			if err := paths.Scan(tc.doc, vals); err != tc.err {
+				t.Fatalf("Expected err %v, got %v", tc.err, err)
+			}
+			if tc.err != nil {
+				return
+			}
+			for i, want := range tc.vals {
+				if vals[i] != want {
+					t.Errorf("Path %d: expected %v, got %v", i, want, vals[i])
+				}
+			}
+		})
+	}
+}
+
+// Validation must agree with encoding/json.
+func TestScanValid(t *testing.T) {
+	docs := []string{
+		`{}`,
+		` { "a" : [ ] , "b" : { } } `,
+		`{"a": [1, -0, 0.5, 1e5, 1E-5, -1.0e+2]}`,
+		`{"a": "\ud800 \/ \b\f\n\r\t"}`,
+		"{\"a\": \"\xff\"}",
+		`{"a": true, "b": false, "c": null}`,
+		`{"a": [[[[]]]]}`,
+		`{"a" 1}`,
+		`{"a": 1.}`,
+		`{"a": -}`,
+		`{"a": .5}`,
+		`{"a": +1}`,
+		`{"a": 1e}`,
+		`{"a": "\u12"}`,
+		`{"a": [1 2]}`,
+		`{"a": [1,]}`,
+		`{1: 2}`,
+		`{"a": tru}`,
+		`{"a": "x}`,
+		`{"a": 1}}`,
+	}
+
+	paths := Compile([][]string{{"a"}})
+	vals := make([]Value, paths.Len())
+
+	for _, doc := range docs {
+		var v any
+		want := json.Unmarshal([]byte(doc), &v) == nil
+		if got := paths.Scan(doc, vals) == nil; got != want {
+			t.Errorf("Doc %q: expected valid %v, got %v", doc, want, got)
+		}
+	}
+}
+
+func TestScanDepth(t *testing.T) {
+	doc := `{"a": ` + strings.Repeat("[", maxDepth+1) + strings.Repeat("]", maxDepth+1) + `}`
+
+	paths := Compile([][]string{{"a"}})
+	if err := paths.Scan(doc, make([]Value, 1)); err != ErrDepth {
+		t.Fatalf("Expected ErrDepth, got %v", err)
+	}
+}
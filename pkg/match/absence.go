@@ -0,0 +1,139 @@
+package match
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// MatchAbsence is a dead man's switch; it fires when a term has not been
+// seen for window after the matcher is armed.
+//
+// The matcher arms on the first clock it observes, or on a match of the
+// start term if one is specified with WithStartTerm.  Every match of the
+// term while armed pushes the deadline out to window past the match.  When
+// Scan or Eval advances the clock past the deadline, a hit is emitted with
+// the last seen LogEntry as context; that is the last match of the term, or
+// the arming event if the term was never seen.
+//
+// Once fired the matcher disarms.  Without a start term, it re-arms on the
+// next match of the term; with a start term, it re-arms on the next start.
+
+type MatchAbsence struct {
+	clock    int64
+	window   int64
+	deadline int64
+	armed    bool
+	started  bool
+	matcher  EntryMatchFunc
+	start    EntryMatchFunc
+	last     LogEntry
+	lastTerm bool // last is a match of the term, not the arming event
+	meta     hitMetaT
+	trace    tracerT
+}
+
+func NewMatchAbsence(window int64, term TermT, opts ...OptT) (*MatchAbsence, error) {
+	o := parseOpts(opts)
+
+	m, err := o.newMatcher(term)
+	if err != nil {
+		return nil, err
+	}
+
+	var start EntryMatchFunc
+	if o.startTerm != nil {
+		if start, err = o.newMatcher(*o.startTerm); err != nil {
+			return nil, err
+		}
+	}
+
+	meta, err := newHitMeta(o, []TermT{term}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MatchAbsence{
+		window:  window,
+		matcher: m,
+		start:   start,
+		meta:    meta,
+		trace:   newTracer(o, 1, nil),
+	}, nil
+}
+
+func (r *MatchAbsence) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("MatchAbsence: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+
+	if r.start == nil && !r.started {
+		// Arm on the first clock
+		r.started = true
+		r.arm(e, false)
+	}
+
+	// The deadline may have passed before this event arrived.
+	hits = r.Eval(e.Timestamp)
+
+	if r.start != nil && r.start(e) {
+		r.arm(e, false)
+	}
+
+	if r.matcher(e) {
+		r.trace.match(0)
+		if r.armed || r.start == nil {
+			r.arm(e, true)
+			r.trace.assert(r.clock, 0, e)
+		}
+	}
+
+	return
+}
+
+// Assert clock; fires if the deadline has passed with no match of the term.
+func (r *MatchAbsence) Eval(clock int64) (hits Hits) {
+	if clock < r.clock {
+		return
+	}
+
+	if r.start == nil && !r.started {
+		// Arm on the first clock; there is no event to use as context.
+		r.started = true
+		r.arm(LogEntry{Timestamp: clock}, false)
+	}
+	r.clock = clock
+
+	if !r.armed || clock <= r.deadline {
+		return
+	}
+
+	if r.lastTerm {
+		r.meta.add(&hits, r.last, 0)
+	} else {
+		r.meta.addContext(&hits, r.last)
+	}
+	hits.closeFrame(r.window)
+	hits.Frames[0].Stop = r.deadline
+	r.trace.hit(clock, hits)
+
+	r.armed = false
+	r.last = LogEntry{}
+	return
+}
+
+// Matcher state is constant size; nothing to collect.
+func (r *MatchAbsence) GarbageCollect(clock int64) {
+}
+
+func (r *MatchAbsence) arm(e LogEntry, term bool) {
+	r.armed = true
+	r.last = e
+	r.lastTerm = term
+	r.deadline = e.Timestamp + r.window
+}
@@ -0,0 +1,140 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+)
+
+func TestAbsence(t *testing.T) {
+	type step = stepT[MatchAbsence]
+
+	var tests = map[string]struct {
+		window int64
+		opts   []OptT
+		steps  []step
+	}{
+		"Heartbeat": {
+			// -1--4--7--------- heartbeat
+			// Fires once clock passes 7 + window.
+			window: 5,
+			steps: []step{
+				{line: "heartbeat", stamp: 1},
+				{line: "heartbeat", stamp: 4},
+				{line: "heartbeat", stamp: 7},
+				{line: "noop", stamp: 12},
+				{line: "noop", stamp: 13, cb: matchStamps(7)},
+				{line: "noop", stamp: 100},
+			},
+		},
+
+		"FirstClockArms": {
+			// Never seen; fires with arming event as context.
+			window: 5,
+			steps: []step{
+				{line: "noop1", stamp: 1},
+				{line: "noop2", stamp: 6},
+				{line: "noop3", stamp: 7, cb: matchLines("noop1")},
+			},
+		},
+
+		"Eval": {
+			window: 5,
+			steps: []step{
+				{line: "heartbeat", stamp: 1},
+				{postF: checkEval[*MatchAbsence](6, checkNoFire)},
+				{postF: checkEval[*MatchAbsence](7, matchStamps(1))},
+				{postF: checkEval[*MatchAbsence](20, checkNoFire)},
+			},
+		},
+
+		"Rearm": {
+			// Disarmed after firing; re-arms on next match.
+			window: 5,
+			steps: []step{
+				{line: "heartbeat", stamp: 1},
+				{line: "noop", stamp: 10, cb: matchStamps(1)},
+				{line: "heartbeat", stamp: 20},
+				{line: "noop", stamp: 26, cb: matchStamps(20)},
+			},
+		},
+
+		"FireThenRearmSameEvent": {
+			// Late heartbeat fires, then re-arms.
+			window: 5,
+			steps: []step{
+				{line: "heartbeat", stamp: 1},
+				{line: "heartbeat", stamp: 10, cb: matchStamps(1)},
+				{line: "noop", stamp: 16, cb: matchStamps(10)},
+			},
+		},
+
+		"StartTerm": {
+			// Not armed until start; disarmed after firing until next start.
+			window: 5,
+			opts:   []OptT{WithStartTerm(makeRaw("leader elected"))},
+			steps: []step{
+				{line: "noop", stamp: 1},
+				{line: "noop", stamp: 10},
+				{line: "leader elected", stamp: 11},
+				{line: "renewed lease", stamp: 14},
+				{line: "noop", stamp: 20, cb: matchLines("renewed lease")},
+				{line: "renewed lease", stamp: 30},
+				{line: "noop", stamp: 40},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			term := makeRaw("heartbeat")
+			if tc.opts != nil {
+				term = makeRaw("renewed lease")
+			}
+
+			sm, err := NewMatchAbsence(tc.window, term, tc.opts...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestAbsenceEvalArms(t *testing.T) {
+	sm, err := NewMatchAbsence(5, makeRaw("heartbeat"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	if hits := sm.Eval(100); hits.Cnt != 0 {
+		t.Fatalf("Expected no hits, got %v", hits.Cnt)
+	}
+
+	hits := sm.Eval(106)
+	if hits.Cnt != 1 || hits.Logs[0].Timestamp != 100 {
+		t.Fatalf("Expected hit with stamp 100, got %v", hits)
+	}
+}
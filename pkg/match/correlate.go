@@ -0,0 +1,329 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrTermExtract      = errors.New("extract requires a jq term")
+	ErrTermCapture      = errors.New("capture requires a regex term")
+	ErrCorrelateInverse = errors.New("inverse matchers do not correlate captured fields")
+)
+
+// Correlation on captured fields.
+//
+// A term captures named fields from the lines it matches, if it asks to: regex
+// terms with Capture set capture their named groups, eg. `started (?P<req>\d+)`,
+// and jq terms capture the object produced by their Extract program, eg.
+// `{req: .request_id}`.  The named groups of a regex without Capture do not
+// capture.
+//
+// When two or more terms of a MatchSeq or MatchSet capture fields, the matcher
+// only fires on a frame where every field that is captured by more than one
+// term has the same value across those terms.  A field that is captured by a
+// single term does not constrain the frame.  An empty capture, such as an
+// optional group that did not participate in the match, acts as a wildcard.
+//
+// The search for an agreeing frame backtracks over the buffered matches, and
+// may take time exponential in the number of terms.  It is capped at
+// WithMaxSearch candidate matches, 4096 by default.  A search over the cap
+// gives up; the match that started it is dropped, counted in Stats.DropLimit
+// and traced as DropLimit.
+//
+// InverseSeq and InverseSet do not correlate; they fail with
+// ErrCorrelateInverse rather than fire on frames whose fields disagree.
+
+const defMaxSearch = 4096 // See WithMaxSearch
+
+type fieldT struct {
+	name  string
+	value string
+}
+
+type captureFuncT func(string) []fieldT
+
+// Returns nil if the term captures no fields.
+func (tt TermT) newCapture(pc *parseCacheT) (captureFuncT, error) {
+	switch {
+	case tt.Extract != "":
+		return makeJqCapture(tt, pc)
+	case tt.Capture:
+		return makeRegexCapture(tt.Value)
+	}
+	return nil, nil
+}
+
+func makeRegexCapture(term string) (captureFuncT, error) {
+	exp, err := regexp.Compile(term)
+	if err != nil {
+		return nil, err
+	}
+
+	names := exp.SubexpNames()
+	if !slices.ContainsFunc(names, func(s string) bool { return s != "" }) {
+		return nil, nil
+	}
+
+	return func(line string) (fields []fieldT) {
+		for i, v := range exp.FindStringSubmatch(line) {
+			if names[i] != "" && v != "" {
+				fields = append(fields, fieldT{name: names[i], value: v})
+			}
+		}
+		return
+	}, nil
+}
+
+func makeJqCapture(term TermT, pc *parseCacheT) (captureFuncT, error) {
+	unmarshal := pc.unmarshal(term.Type)
+	if unmarshal == nil {
+		return nil, ErrTermExtract
+	}
+
+	query, err := gojq.Parse(term.Extract)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(line string) (fields []fieldT) {
+		v, err := unmarshal(line)
+		if err != nil {
+			return nil
+		}
+
+		// Only the first result is used; it must be an object.
+		res, ok := code.Run(v).Next()
+		if !ok {
+			return nil
+		}
+
+		obj, ok := res.(map[string]any)
+		if !ok {
+			if err, ok := res.(error); ok {
+				log.Debug().Err(err).
+					Str("line", line).
+					Str("extract", term.Extract).
+					Msg("Fail jq extract on log line")
+			}
+			return nil
+		}
+
+		for name, v := range obj {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				if v != "" {
+					fields = append(fields, fieldT{name: name, value: v})
+				}
+			default:
+				fields = append(fields, fieldT{name: name, value: fmt.Sprint(v)})
+			}
+		}
+
+		// Map iteration is random; keep fields in a stable order.
+		slices.SortFunc(fields, func(a, b fieldT) int {
+			return strings.Compare(a.name, b.name)
+		})
+		return
+	}, nil
+}
+
+// Install capture functions on terms, where src[i] is the source of terms[i].
+// Returns true if more than one term captures, ie. correlation is required.
+func installCaptures(terms []termT, src []TermT, pc *parseCacheT) (bool, error) {
+	var nCapture int
+	for i, term := range src {
+		capture, err := term.newCapture(pc)
+		if err != nil {
+			return false, fmt.Errorf("%w type:'%s' extract:'%s': %w", ErrTermCompile, term.Type.String(), term.Extract, err)
+		}
+		if capture != nil {
+			terms[i].capture = capture
+			nCapture += 1
+		}
+	}
+
+	if nCapture < 2 {
+		// Nothing to correlate; skip the capture cost on scan.
+		for i := range terms {
+			terms[i].capture = nil
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Fields bound so far while searching for a correlated frame.
+type bindingsT []fieldT
+
+// Returns false if any field conflicts with a bound value.
+func (b bindingsT) compatible(fields []fieldT) bool {
+	for _, f := range fields {
+		for _, v := range b {
+			if v.name == f.name && v.value != f.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Bind fields not already bound; returns the length to restore on backtrack.
+func (b *bindingsT) bind(fields []fieldT) int {
+	mark := len(*b)
+	for _, f := range fields {
+		if !slices.ContainsFunc((*b)[:mark], func(v fieldT) bool { return v.name == f.name }) {
+			*b = append(*b, f)
+		}
+	}
+	return mark
+}
+
+func sameEntry(a, b LogEntry) bool {
+	return a.Timestamp == b.Timestamp && a.Line == b.Line && a.Stream == b.Stream
+}
+
+// Remove the assert at pos from terms[idx].
+func removeAssert(terms []termT, idx, pos int) {
+	if pos == 0 {
+		shiftLeft(terms, idx, 1)
+		return
+	}
+	terms[idx].bytes -= terms[idx].asserts[pos].Size()
+	terms[idx].asserts = slices.Delete(terms[idx].asserts, pos, pos+1)
+}
+
+// Search for a correlated sequence ending in 'last'.  Picks one assert from
+// each of the preceding terms such that each links in order to the next, no
+// entry is used twice, and captured fields agree.  The earliest candidate is
+// preferred on each term.  Returns the assert index for each preceding term,
+// or nil; over is set if the search visited more than budget candidates.
+func correlateSeq(terms []termT, last assertT, order orderT, gaps gapsT, budget int) (picks []int, over bool) {
+	var (
+		n     = len(terms) - 1
+		binds = make(bindingsT, 0, 8)
+	)
+
+	picks = make([]int, n)
+
+	binds.bind(last.fields)
+
+	var walk func(i int, prev *assertT) bool
+	walk = func(i int, prev *assertT) bool {
+		if i == n {
+			return true
+		}
+
+	ASSERTS:
+		for j, a := range terms[i].asserts {
+			switch {
+			case prev != nil && !gaps.link(order, i-1, *prev, a):
+				continue
+			case a.Timestamp > last.Timestamp:
+				break ASSERTS
+			case !order.before(a, last):
+				continue
+			case i == n-1 && !gaps.fits(i, a.Timestamp, last.Timestamp):
+				continue
+			case sameEntry(a.LogEntry, last.LogEntry):
+				continue
+			case !binds.compatible(a.fields):
+				continue
+			}
+
+			for k := range i {
+				if sameEntry(terms[k].asserts[picks[k]].LogEntry, a.LogEntry) {
+					continue ASSERTS
+				}
+			}
+
+			if budget -= 1; budget < 0 {
+				over = true
+				return false
+			}
+
+			mark := binds.bind(a.fields)
+			picks[i] = j
+			if walk(i+1, &terms[i].asserts[j]) {
+				return true
+			}
+			if over {
+				return false
+			}
+			binds = binds[:mark]
+		}
+		return false
+	}
+
+	if !walk(0, nil) {
+		return nil, over
+	}
+	return picks, false
+}
+
+// Search for a correlated set frame.  Picks cnt(i) distinct asserts from each
+// term such that captured fields agree; the earliest candidates are preferred.
+// Returns the chosen assert indices per term, or nil; over is set if the
+// search visited more than budget candidates.
+func correlateSet(terms []termT, cnt func(int) int, budget int) (picks [][]int, over bool) {
+	binds := make(bindingsT, 0, 8)
+
+	picks = make([][]int, len(terms))
+
+	for i := range terms {
+		picks[i] = make([]int, 0, cnt(i))
+	}
+
+	var walk func(i, from int) bool
+	walk = func(i, from int) bool {
+		if i == len(terms) {
+			return true
+		}
+
+		if len(picks[i]) == cnt(i) {
+			return walk(i+1, 0)
+		}
+
+		m := terms[i].asserts
+		for j := from; j < len(m); j++ {
+			if !binds.compatible(m[j].fields) {
+				continue
+			}
+
+			if budget -= 1; budget < 0 {
+				over = true
+				return false
+			}
+
+			mark := binds.bind(m[j].fields)
+			picks[i] = append(picks[i], j)
+			if walk(i, j+1) {
+				return true
+			}
+			if over {
+				return false
+			}
+			picks[i] = picks[i][:len(picks[i])-1]
+			binds = binds[:mark]
+		}
+		return false
+	}
+
+	if !walk(0, 0) {
+		return nil, over
+	}
+	return picks, false
+}
@@ -0,0 +1,387 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+)
+
+func regexTerm(v string) TermT {
+	return TermT{Type: TermRegex, Value: v}
+}
+
+func captureTerm(v string) TermT {
+	return TermT{Type: TermRegex, Value: v, Capture: true}
+}
+
+func jqTerm(v, extract string) TermT {
+	return TermT{Type: TermJqJson, Value: v, Extract: extract}
+}
+
+func TestSeqCorrelate(t *testing.T) {
+	type step = stepT[MatchSeq]
+
+	var tests = map[string]struct {
+		window int64
+		terms  []TermT
+		steps  []step
+	}{
+		"Simple": {
+			// Request 2 fails; must not pair with request 1 start.
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start req=1"},
+				{line: "start req=2"},
+				{line: "fail req=2", cb: matchStamps(2, 3)},
+				{line: "fail req=1", cb: matchStamps(1, 4)},
+				{line: "fail req=1"},
+			},
+		},
+
+		"NoAgree": {
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start req=1"},
+				{line: "fail req=2"},
+				{line: "fail req=3", postF: checkActive[MatchSeq](1)},
+			},
+		},
+
+		"ThreeTerms": {
+			// Middle term for request 2 precedes the start of request 1's middle.
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				captureTerm(`retry req=(?P<req>\d+)`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start req=1"},
+				{line: "start req=2"},
+				{line: "retry req=2"},
+				{line: "retry req=1"},
+				{line: "fail req=1", cb: matchStamps(1, 4, 5)},
+				{line: "fail req=2", cb: matchStamps(2, 3, 6)},
+			},
+		},
+
+		"DisjointFields": {
+			// Fields on the middle term do not constrain the others.
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				captureTerm(`node=(?P<node>\w+)`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start req=1"},
+				{line: "node=a"},
+				{line: "fail req=1", cb: matchStamps(1, 2, 3)},
+			},
+		},
+
+		"Wildcard": {
+			// An empty capture agrees with any value.
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start(?: req=(?P<req>\d+))?`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start"},
+				{line: "fail req=7", cb: matchStamps(1, 2)},
+			},
+		},
+
+		"Window": {
+			window: 5,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				captureTerm(`fail req=(?P<req>\d+)`),
+			},
+			steps: []step{
+				{line: "start req=1", stamp: 1},
+				{line: "start req=2", stamp: 4},
+				{line: "fail req=1", stamp: 7},
+				{line: "fail req=2", stamp: 8, cb: matchStamps(4, 8)},
+			},
+		},
+
+		"JqExtract": {
+			window: 10,
+			terms: []TermT{
+				jqTerm(`select(.msg == "start")`, `{req: .id}`),
+				jqTerm(`select(.msg == "fail")`, `{req: .id}`),
+			},
+			steps: []step{
+				{line: `{"msg": "start", "id": 1}`},
+				{line: `{"msg": "start", "id": 2}`},
+				{line: `{"msg": "fail", "id": 2}`, cb: matchStamps(2, 3)},
+			},
+		},
+
+		"SingleCapture": {
+			// Only one term captures; nothing to correlate.
+			window: 10,
+			terms: []TermT{
+				captureTerm(`start req=(?P<req>\d+)`),
+				makeRaw("fail"),
+			},
+			steps: []step{
+				{line: "start req=1"},
+				{line: "fail req=2", cb: matchStamps(1, 2)},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeq(tc.window, tc.terms...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestSetCorrelate(t *testing.T) {
+	type step = stepT[MatchSet]
+
+	var tests = map[string]struct {
+		window int64
+		terms  []TermT
+		steps  []step
+	}{
+		"Simple": {
+			window: 10,
+			terms: []TermT{
+				captureTerm(`oom pod=(?P<pod>\w+)`),
+				captureTerm(`evict pod=(?P<pod>\w+)`),
+			},
+			steps: []step{
+				{line: "evict pod=a"},
+				{line: "oom pod=b"},
+				{line: "oom pod=a", cb: matchStamps(3, 1)},
+				{line: "evict pod=b", cb: matchStamps(2, 4)},
+			},
+		},
+
+		"NoAgree": {
+			window: 10,
+			terms: []TermT{
+				captureTerm(`oom pod=(?P<pod>\w+)`),
+				captureTerm(`evict pod=(?P<pod>\w+)`),
+			},
+			steps: []step{
+				{line: "evict pod=a"},
+				{line: "oom pod=b"},
+				{line: "noop"},
+				{line: "oom pod=c", postF: checkHotMask[MatchSet](0b11)},
+			},
+		},
+
+		"Dupes": {
+			window: 10,
+			terms: []TermT{
+				captureTerm(`oom pod=(?P<pod>\w+)`),
+				captureTerm(`oom pod=(?P<pod>\w+)`),
+				captureTerm(`evict pod=(?P<pod>\w+)`),
+			},
+			steps: []step{
+				{line: "oom pod=a"},
+				{line: "oom pod=b"},
+				{line: "evict pod=a"},
+				{line: "oom pod=a", cb: matchStamps(1, 4, 3)},
+			},
+		},
+
+		"GarbageCollect": {
+			window: 5,
+			terms: []TermT{
+				captureTerm(`oom pod=(?P<pod>\w+)`),
+				captureTerm(`evict pod=(?P<pod>\w+)`),
+			},
+			steps: []step{
+				{line: "oom pod=a", stamp: 1},
+				{line: "oom pod=b", stamp: 5},
+				{line: "evict pod=a", stamp: 8},
+				{line: "evict pod=b", stamp: 9, cb: matchStamps(5, 9)},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSet(tc.window, tc.terms...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRequiresJq(t *testing.T) {
+	term := TermT{Type: TermRegex, Value: "alpha", Extract: "{a: .a}"}
+	if _, err := term.NewMatcher(); err != ErrTermExtract {
+		t.Fatalf("Expected ErrTermExtract, got %v", err)
+	}
+
+	term = jqTerm(".a", "{a: ")
+	if _, err := NewMatchSeq(10, term, term); !errors.Is(err, ErrTermCompile) {
+		t.Fatalf("Expected ErrTermCompile, got %v", err)
+	}
+}
+
+func TestCaptureRequiresRegex(t *testing.T) {
+	term := TermT{Type: TermRaw, Value: "alpha", Capture: true}
+	if _, err := term.NewMatcher(); err != ErrTermCapture {
+		t.Fatalf("Expected ErrTermCapture, got %v", err)
+	}
+}
+
+// Named groups without Capture do not correlate.
+func TestNamedGroupsNoCapture(t *testing.T) {
+	sm, err := NewMatchSeq(10, regexTerm(`start req=(?P<req>\d+)`), regexTerm(`fail req=(?P<req>\d+)`))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "start req=1"})
+	if hits := sm.Scan(LogEntry{Timestamp: 2, Line: "fail req=2"}); hits.Cnt != 1 {
+		t.Errorf("Expected 1 hit, got %d", hits.Cnt)
+	}
+}
+
+func TestInverseCorrelate(t *testing.T) {
+	var (
+		terms  = []TermT{captureTerm(`req (?P<req>\d+) started`), captureTerm(`req (?P<req>\d+) failed`)}
+		resets = []ResetT{{Term: regexTerm("shutdown")}}
+	)
+
+	if _, err := NewInverseSeq(10, terms, resets); err != ErrCorrelateInverse {
+		t.Errorf("Expected ErrCorrelateInverse, got %v", err)
+	}
+	if _, err := NewInverseSet(10, terms, resets); err != ErrCorrelateInverse {
+		t.Errorf("Expected ErrCorrelateInverse, got %v", err)
+	}
+
+	// A single capturing term does not correlate.
+	terms[1] = regexTerm(`req (?P<req>\d+) failed`)
+	if _, err := NewInverseSeq(10, terms, resets); err != nil {
+		t.Errorf("Expected err == nil, got %v", err)
+	}
+}
+
+// Every pair of a and b agrees, only for c to disagree with all of them.
+func TestCorrelateMaxSearch(t *testing.T) {
+	var (
+		a     = captureTerm(`a (?P<x>\d+)`)
+		b     = captureTerm(`b (?P<y>\d+)`)
+		c     = captureTerm(`c (?P<x>\d+) (?P<y>\d+)`)
+		lines []string
+	)
+
+	for i := range 10 {
+		lines = append(lines, fmt.Sprintf("a %d", i+1))
+	}
+	for i := range 10 {
+		lines = append(lines, fmt.Sprintf("b %d", i+1))
+	}
+	lines = append(lines, "c 0 0")
+
+	tests := map[string]struct {
+		set       bool
+		maxSearch int
+		dropped   int64
+	}{
+		"seq":         {maxSearch: 50, dropped: 1},
+		"seqUncapped": {maxSearch: defMaxSearch},
+		"set":         {set: true, maxSearch: 50, dropped: 1},
+		"setUncapped": {set: true, maxSearch: defMaxSearch},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				m   Matcher
+				err error
+				in  = lines
+			)
+			if tc.set {
+				m, err = NewMatchSetOpts(100, []TermT{a, b, c}, WithMaxSearch(tc.maxSearch))
+			} else {
+				m, err = NewMatchSeqOpts(100, []TermT{a, b, c, makeRaw("d")}, WithMaxSearch(tc.maxSearch))
+				in = append(slices.Clip(lines), "d")
+			}
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var hits Hits
+			for i, line := range in {
+				appendHits(&hits, m.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+			}
+
+			if st := m.Stats(); hits.Cnt != 0 || st.DropLimit != tc.dropped {
+				t.Errorf("Expected no hits and %d dropped, got %d %+v", tc.dropped, hits.Cnt, st)
+			}
+		})
+	}
+}
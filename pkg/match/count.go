@@ -0,0 +1,231 @@
+package match
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrThreshold = errors.New("invalid threshold")
+)
+
+const defCountSamples = 16
+
+// MatchCount fires when a term matches at least N times within a window.
+//
+// By default the window slides; it fires when N matches are found with the
+// last match no more than window after the first.  A tumbling window instead
+// opens on the first match and closes window later, after which the count
+// starts over on the next match.  In both cases the contributing matches are
+// consumed when the matcher fires.
+//
+// The hit frame contains every contributing LogEntry when N is less than or
+// equal to the sample limit.  Above the limit, only the first and last matches
+// are reported to keep memory bounded.  On a sliding window, the first match may
+// age out of the window; in that case the oldest retained sample is reported.
+//
+// A sliding window keeps the timestamp of each match in window to age them out.
+// As the matcher fires on the Nth, there are fewer than N at any time; they are
+// kept in a ring that grows up to N, whatever the rate of matches.
+
+type MatchCount struct {
+	clock     int64
+	window    int64
+	start     int64
+	threshold int
+	samples   int
+	cnt       int
+	tumbling  bool
+	firstOk   bool
+	matcher   EntryMatchFunc
+	first     LogEntry
+	stamps    []int64    // Sliding window only; ring of the cnt match timestamps in window.
+	head      int        // Index of the oldest timestamp in stamps.
+	recent    []LogEntry // Up to 'samples' most recent matches.
+	meta      hitMetaT
+	trace     tracerT
+}
+
+func NewMatchCount(window int64, threshold int, term TermT, opts ...OptT) (*MatchCount, error) {
+	if threshold <= 0 {
+		return nil, ErrThreshold
+	}
+
+	o := parseOpts(opts)
+
+	m, err := o.newMatcher(term)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := newHitMeta(o, []TermT{term}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MatchCount{
+		window:    window,
+		threshold: threshold,
+		samples:   o.samples,
+		tumbling:  o.tumbling,
+		matcher:   m,
+		meta:      meta,
+		trace:     newTracer(o, 1, nil),
+	}, nil
+}
+
+func (r *MatchCount) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("MatchCount: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+	r.clock = e.Timestamp
+
+	r.maybeGC(e.Timestamp)
+
+	if !r.matcher(e) {
+		return
+	}
+
+	if r.cnt == 0 {
+		r.start = e.Timestamp
+		r.first = e
+		r.firstOk = true
+	}
+	if !r.tumbling {
+		r.push(e.Timestamp)
+	}
+	r.cnt += 1
+
+	if len(r.recent) == r.samples {
+		r.recent = append(r.recent[:0], r.recent[1:]...)
+	}
+	r.recent = append(r.recent, e)
+	r.trace.match(0)
+	r.trace.assert(r.clock, 0, e)
+
+	if r.cnt < r.threshold {
+		return
+	}
+
+	// We have a full frame; fire and reset.
+	if r.threshold <= r.samples {
+		hits.Logs = make([]LogEntry, 0, len(r.recent))
+		for _, m := range r.recent {
+			r.meta.add(&hits, m, 0)
+		}
+	} else {
+		first := r.first
+		if !r.firstOk {
+			first = r.recent[0]
+		}
+		hits.Logs = make([]LogEntry, 0, 2)
+		r.meta.add(&hits, first, 0)
+		r.meta.add(&hits, e, 0)
+	}
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, hits)
+
+	r.reset()
+	return
+}
+
+// Add a timestamp to the ring; there is room for at least threshold.
+func (r *MatchCount) push(stamp int64) {
+	if r.cnt == len(r.stamps) {
+		grown := make([]int64, min(max(2*r.cnt, 8), r.threshold))
+		n := copy(grown, r.stamps[r.head:])
+		copy(grown[n:], r.stamps[:r.head])
+		r.stamps, r.head = grown, 0
+	}
+	r.stamps[(r.head+r.cnt)%len(r.stamps)] = stamp
+}
+
+// The i'th oldest timestamp in the ring.
+func (r *MatchCount) stamp(i int) int64 {
+	return r.stamps[(r.head+i)%len(r.stamps)]
+}
+
+func (r *MatchCount) maybeGC(clock int64) {
+	if r.cnt == 0 || clock-r.start <= r.window {
+		return
+	}
+	r.GarbageCollect(clock)
+}
+
+// Remove all matches that are older than the window.
+func (r *MatchCount) GarbageCollect(clock int64) {
+	if r.cnt == 0 {
+		return
+	}
+
+	deadline := clock - r.window
+
+	if r.tumbling {
+		if r.start < deadline {
+			r.trace.gc(clock, 0, r.cnt)
+			r.reset()
+		}
+		return
+	}
+
+	var cnt int
+	for cnt < r.cnt && r.stamp(cnt) < deadline {
+		cnt += 1
+	}
+
+	if cnt == 0 {
+		return
+	}
+
+	r.trace.gc(clock, 0, cnt)
+
+	if cnt == r.cnt {
+		r.reset()
+		return
+	}
+
+	r.head = (r.head + cnt) % len(r.stamps)
+	r.cnt -= cnt
+	r.start = r.stamp(0)
+
+	if r.first.Timestamp < deadline {
+		r.firstOk = false
+	}
+
+	cnt = 0
+	for _, e := range r.recent {
+		if e.Timestamp >= deadline {
+			break
+		}
+		cnt += 1
+	}
+	r.recent = r.recent[cnt:]
+}
+
+func (r *MatchCount) reset() {
+	r.cnt = 0
+	r.head = 0
+	r.firstOk = false
+	r.first = LogEntry{}
+
+	if len(r.stamps) > capThreshold {
+		r.stamps = nil
+	}
+
+	// Recent is bounded by samples; keep the allocation.
+	clear(r.recent)
+	r.recent = r.recent[:0]
+}
+
+// Because match count is edge triggered, there won't be hits.
+func (r *MatchCount) Eval(clock int64) (h Hits) {
+	return
+}
@@ -0,0 +1,205 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+)
+
+func TestCount(t *testing.T) {
+	type step = stepT[MatchCount]
+
+	var tests = map[string]struct {
+		window    int64
+		threshold int
+		opts      []OptT
+		steps     []step
+	}{
+		"Simple": {
+			// -1-2-3---- alpha
+			window:    10,
+			threshold: 3,
+			steps: []step{
+				{line: "alpha"},
+				{line: "noop"},
+				{line: "alpha"},
+				{line: "noop"},
+				{line: "alpha", cb: matchStamps(1, 3, 5)},
+			},
+		},
+
+		"Consume": {
+			// -123456--- alpha
+			// Should fire {1,2,3}, {4,5,6}
+			window:    10,
+			threshold: 3,
+			steps: []step{
+				{line: "alpha"},
+				{line: "alpha"},
+				{line: "alpha", cb: matchStamps(1, 2, 3)},
+				{line: "alpha"},
+				{line: "alpha"},
+				{line: "alpha", cb: matchStamps(4, 5, 6)},
+			},
+		},
+
+		"Sliding": {
+			// -1-----7-9-C- alpha
+			// 1 ages out of the window at 12; fire {7,9,12}
+			window:    5,
+			threshold: 3,
+			steps: []step{
+				{line: "alpha", stamp: 1},
+				{line: "alpha", stamp: 7},
+				{line: "alpha", stamp: 9},
+				{line: "alpha", stamp: 12, cb: matchStamps(7, 9, 12)},
+			},
+		},
+
+		"SlidingWindowEdge": {
+			// Last match is exactly window after the first; should fire.
+			window:    5,
+			threshold: 2,
+			steps: []step{
+				{line: "alpha", stamp: 1},
+				{line: "alpha", stamp: 6, cb: matchStamps(1, 6)},
+			},
+		},
+
+		"Tumbling": {
+			// -1---5-7-9---DEF- alpha
+			// Window [1,6] holds two matches, as does window [7,12].
+			// A sliding window would fire on {5,7,9}.
+			// Window [13,18] fires on {13,14,15}.
+			window:    5,
+			threshold: 3,
+			opts:      []OptT{WithTumbling(true)},
+			steps: []step{
+				{line: "alpha", stamp: 1},
+				{line: "alpha", stamp: 5},
+				{line: "alpha", stamp: 7},
+				{line: "alpha", stamp: 9},
+				{line: "alpha", stamp: 13},
+				{line: "alpha", stamp: 14},
+				{line: "alpha", stamp: 15, cb: matchStamps(13, 14, 15)},
+				{line: "alpha", stamp: 16},
+			},
+		},
+
+		"SamplesFirstLast": {
+			// Threshold above sample limit reports first and last.
+			window:    100,
+			threshold: 5,
+			opts:      []OptT{WithSamples(2)},
+			steps: []step{
+				{line: "alpha1"},
+				{line: "alpha2"},
+				{line: "alpha3"},
+				{line: "alpha4"},
+				{line: "alpha5", cb: matchLines("alpha1", "alpha5")},
+			},
+		},
+
+		"SamplesFirstAgedOut": {
+			// First match ages out; report oldest retained sample.
+			window:    10,
+			threshold: 3,
+			opts:      []OptT{WithSamples(2)},
+			steps: []step{
+				{line: "alpha1", stamp: 1},
+				{line: "alpha2", stamp: 5},
+				{line: "alpha3", stamp: 12},
+				{line: "alpha4", stamp: 14, cb: matchLines("alpha3", "alpha4")},
+			},
+		},
+
+		"GarbageCollect": {
+			window:    10,
+			threshold: 2,
+			steps: []step{
+				{line: "alpha", stamp: 1},
+				{postF: garbageCollect[*MatchCount](12)},
+				{line: "alpha", stamp: 12},
+				{line: "alpha", stamp: 13, cb: matchStamps(12, 13)},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchCount(tc.window, tc.threshold, makeRaw("alpha"), tc.opts...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestCountBadThreshold(t *testing.T) {
+	if _, err := NewMatchCount(10, 0, makeRaw("alpha")); err != ErrThreshold {
+		t.Fatalf("Expected err == ErrThreshold, got %v", err)
+	}
+}
+
+func BenchmarkCountLargeThreshold(b *testing.B) {
+	sm, err := NewMatchCount(int64(time.Hour), 100000, makeRaw("alpha"))
+	if err != nil {
+		b.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	ev := LogEntry{Line: "alpha", Timestamp: time.Now().UnixNano()}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ev.Timestamp += 1
+		sm.Scan(ev)
+	}
+}
+
+// The sliding window keeps fewer than threshold timestamps as it wraps.
+func TestCountSlidingRing(t *testing.T) {
+	cm, err := NewMatchCount(10, 4, makeRaw("alpha"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var stamp int64
+	for ; stamp <= 400; stamp += 4 {
+		if hits := cm.Scan(LogEntry{Timestamp: stamp, Line: "alpha"}); hits.Cnt != 0 {
+			t.Fatalf("Expected no hits at %d, got %v", stamp, frameStamps(hits))
+		}
+		if len(cm.stamps) > 4 || cm.cnt > 3 {
+			t.Fatalf("Expected at most 3 of 4 stamps at %d, got %d of %d", stamp, cm.cnt, len(cm.stamps))
+		}
+	}
+
+	hits := cm.Scan(LogEntry{Timestamp: stamp - 3, Line: "alpha"})
+	if got, want := frameStamps(hits), [][]int64{{392, 396, 400, 401}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
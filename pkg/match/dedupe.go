@@ -10,7 +10,7 @@ import (
 type Dedupe struct {
 	window  int64
 	active  int64
-	pendHit []LogEntry
+	pendHit HitFrame // Pending if Logs is not nil
 }
 
 // Extra time to deal with inaccuracies of timer on poll hint
@@ -22,23 +22,39 @@ func NewDedupe(window time.Duration) *Dedupe {
 	}
 }
 
-func (dd *Dedupe) maybeFirePending(clock int64) (fire []LogEntry) {
+// The active window is anchored on the first logged entry of the frame,
+// which need not be its earliest; eg. a MatchSet logs in term order.
+func dedupeAnchor(f HitFrame) int64 {
+	if len(f.Logs) == 0 {
+		return f.Start
+	}
+	return f.Logs[0].Timestamp
+}
+
+func (dd *Dedupe) maybeFirePending(clock int64) (fire HitFrame) {
 	switch {
 	case clock < dd.active:
 		// Active window still valid
-	case dd.pendHit == nil:
+	case dd.pendHit.Logs == nil:
 		// Active window expired, no pending hit
 		dd.active = 0
 	default:
 		// Acive window expired, but we have a pending hit
 		fire = dd.pendHit
-		dd.pendHit = nil
-		dd.active = fire[0].Timestamp + dd.window
+		dd.pendHit = HitFrame{}
+		dd.active = dedupeAnchor(fire) + dd.window
 	}
 	return
 }
 
 func (dd *Dedupe) MaybeFire(clock int64, hits Hits) (fire []LogEntry, hint time.Duration) {
+	f, hint := dd.MaybeFireFrame(clock, hits)
+	return f.Logs, hint
+}
+
+// MaybeFireFrame is MaybeFire returning the whole frame; Logs is nil if
+// nothing fired.
+func (dd *Dedupe) MaybeFireFrame(clock int64, hits Hits) (fire HitFrame, hint time.Duration) {
 	if hits.Cnt <= 0 {
 		if dd.active > 0 {
 			fire = dd.maybeFirePending(clock)
@@ -48,21 +64,21 @@ func (dd *Dedupe) MaybeFire(clock int64, hits Hits) (fire []LogEntry, hint time.
 	return dd._maybeFire(clock, hits)
 }
 
-func (dd *Dedupe) _maybeFire(clock int64, hits Hits) (fire []LogEntry, hint time.Duration) {
+func (dd *Dedupe) _maybeFire(clock int64, hits Hits) (fire HitFrame, hint time.Duration) {
 
 	if dd.active == 0 {
-		dd.active = hits.Logs[0].Timestamp + dd.window
-		fire = hits.PopFront()
+		fire = hits.PopFrame()
+		dd.active = dedupeAnchor(fire) + dd.window
 	} else if clock >= dd.active {
 		// active has expired, fire the latest hit
-		dd.active = hits.Logs[0].Timestamp + dd.window
-		fire = hits.PopFront()
+		fire = hits.PopFrame()
+		dd.active = dedupeAnchor(fire) + dd.window
 	}
 
 	// If any this left, the last is pending
 	if hits.Cnt > 0 {
 		// Only return 'hint'' on the first pending hit
-		if dd.pendHit == nil {
+		if dd.pendHit.Logs == nil {
 			tdiff := dd.active - time.Now().UnixNano()
 			if tdiff > 0 {
 				hint = time.Duration(tdiff) + kSlop
@@ -70,7 +86,7 @@ func (dd *Dedupe) _maybeFire(clock int64, hits Hits) (fire []LogEntry, hint time
 				hint = 1 // non-zero; fire now.
 			}
 		}
-		dd.pendHit = hits.Last()
+		dd.pendHit = hits.Frame(hits.Cnt - 1)
 	}
 
 	return
@@ -81,33 +97,38 @@ func (dd *Dedupe) _maybeFire(clock int64, hits Hits) (fire []LogEntry, hint time
 // Only works accurately when log is running at real time.
 
 func (dd *Dedupe) PollFire() []LogEntry {
+	return dd.PollFireFrame().Logs
+}
+
+// PollFireFrame is PollFire returning the whole frame.
+func (dd *Dedupe) PollFireFrame() (fire HitFrame) {
 	// No active window, nothing to do
 	if dd.active == 0 {
-		return nil
+		return
 	}
 
 	// Active window still valid
 	now := time.Now().UnixNano()
 	if now < dd.active {
-		return nil
+		return
 	}
 
 	// Active window expired, promote pending hit if any
-	if dd.pendHit == nil {
+	if dd.pendHit.Logs == nil {
 		dd.active = 0
-		return nil
+		return
 	}
 
 	// If pending hit is also expired, clear state
-	if dd.pendHit[0].Timestamp+dd.window < now {
+	if dedupeAnchor(dd.pendHit)+dd.window < now {
 		dd.active = 0
-		dd.pendHit = nil
-		return nil
+		dd.pendHit = HitFrame{}
+		return
 	}
 
 	// Fire the pending hit, make it active
-	fire := dd.pendHit
-	dd.pendHit = nil
-	dd.active = fire[0].Timestamp + dd.window
-	return fire
+	fire = dd.pendHit
+	dd.pendHit = HitFrame{}
+	dd.active = dedupeAnchor(fire) + dd.window
+	return
 }
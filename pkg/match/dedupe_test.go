@@ -175,6 +175,33 @@ func TestDedupePoll(t *testing.T) {
 
 }
 
+// The active window is anchored on the first logged entry, not the earliest.
+func TestDedupeAnchor(t *testing.T) {
+	dd := NewDedupe(10)
+
+	frame := func(stamps ...int64) Hits {
+		var hits Hits
+		for _, ts := range stamps {
+			hits.Logs = append(hits.Logs, LogEntry{Timestamp: ts})
+		}
+		hits.closeFrame(0)
+		return hits
+	}
+
+	if logs, _ := dd.MaybeFire(100, frame(100, 50)); len(logs) != 2 {
+		t.Fatalf("Expected first frame to fire, got %v", logs)
+	}
+
+	// Inside [100,110); a window anchored on Start would have closed at 60.
+	if logs, _ := dd.MaybeFire(105, frame(105)); logs != nil {
+		t.Errorf("Expected second frame pending, got %v", logs)
+	}
+
+	if logs, _ := dd.MaybeFire(110, Hits{}); !testEqualLogs(t, logs, []LogEntry{{Timestamp: 105}}) {
+		t.Errorf("Expected pending frame at 110")
+	}
+}
+
 func BenchmarkDupeMisses(b *testing.B) {
 	dd := NewDedupe(time.Second)
 
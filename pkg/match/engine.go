@@ -0,0 +1,173 @@
+package match
+
+import (
+	"errors"
+)
+
+var (
+	ErrEngineId = errors.New("duplicate matcher id")
+)
+
+// TermCache shares compiled terms across matchers.  Identical terms compile to
+// a single MatchFunc that memoizes its result on the last line seen, so a term
+// used by many matchers is evaluated once per LogEntry.  Install the cache on a
+// matcher with WithTermCache.
+//
+// Distinct jq terms share a parse cache, so a line is decoded at most once
+// however many jq terms inspect it; see parse.go.
+//
+// Raw and regex terms are additionally gated by a literal prefilter; see
+// prefilter.go.  Most lines match none of the terms, and are rejected with a
+// single pass over the line.
+//
+// A TermCache is not safe for concurrent use; matchers sharing a cache must be
+// scanned from the same goroutine.
+
+type TermCache struct {
+	terms map[TermT]*cachedTermT
+	pre   prefilterT
+	docs  *parseCacheT
+}
+
+type cachedTermT struct {
+	matcher MatchFunc
+	lit     int  // Prefilter literal id; -1 if none
+	exact   bool // Literal presence decides the match
+	line    string
+	hit     bool
+	valid   bool
+}
+
+func NewTermCache() *TermCache {
+	return &TermCache{
+		terms: make(map[TermT]*cachedTermT),
+		docs:  newParseCache(),
+	}
+}
+
+// Number of distinct terms in the cache.
+func (c *TermCache) Len() int {
+	return len(c.terms)
+}
+
+func (c *TermCache) matcher(term TermT) (MatchFunc, error) {
+	// Extract does not affect the match, and the stream is checked by the
+	// caller; share the line match regardless.
+	key := term
+	key.Extract = ""
+	key.Stream = ""
+
+	ct, ok := c.terms[key]
+	if !ok {
+		m, err := term.compile(c.docs)
+		if err != nil {
+			return nil, err
+		}
+		ct = &cachedTermT{matcher: m, lit: -1}
+		if lit, exact := requiredLiteral(term); lit != "" {
+			ct.lit = c.pre.add(lit)
+			ct.exact = exact
+		}
+		c.terms[key] = ct
+	}
+
+	return func(line string) bool {
+		// String compare short circuits when the line is the same backing array.
+		if ct.valid && ct.line == line {
+			return ct.hit
+		}
+
+		switch {
+		case ct.lit < 0:
+			ct.hit = ct.matcher(line)
+		case !c.pre.present(ct.lit, line):
+			ct.hit = false
+		case ct.exact:
+			ct.hit = true
+		default:
+			ct.hit = ct.matcher(line)
+		}
+
+		ct.line = line
+		ct.valid = true
+		return ct.hit
+	}, nil
+}
+
+// Engine evaluates many matchers in a single pass over a stream.  Matchers
+// built with WithTermCache(engine.Terms()) share identical terms, so each
+// distinct term is evaluated at most once per LogEntry regardless of how
+// many matchers use it.  Hits are tagged with the id of the owning matcher.
+
+type Engine struct {
+	terms *TermCache
+	rules []engineRuleT
+	ids   map[string]struct{}
+}
+
+type engineRuleT struct {
+	id      string
+	matcher Matcher
+}
+
+// RuleHits are the hits from a single matcher registered with the Engine.
+type RuleHits struct {
+	Id   string
+	Hits Hits
+}
+
+func NewEngine() *Engine {
+	return &Engine{
+		terms: NewTermCache(),
+		ids:   make(map[string]struct{}),
+	}
+}
+
+// The term cache to install on matchers added to the engine.
+func (e *Engine) Terms() *TermCache {
+	return e.terms
+}
+
+// Register a matcher under id; ids must be unique.
+func (e *Engine) Add(id string, m Matcher) error {
+	if m == nil {
+		return ErrNilMatcher
+	}
+	if _, ok := e.ids[id]; ok {
+		return ErrEngineId
+	}
+	e.ids[id] = struct{}{}
+	e.rules = append(e.rules, engineRuleT{id: id, matcher: m})
+	return nil
+}
+
+// Number of registered matchers.
+func (e *Engine) Len() int {
+	return len(e.rules)
+}
+
+// Scan the entry on every matcher; returns the hits of matchers that fired.
+func (e *Engine) Scan(entry LogEntry) (hits []RuleHits) {
+	for _, r := range e.rules {
+		if h := r.matcher.Scan(entry); h.Cnt > 0 {
+			hits = append(hits, RuleHits{Id: r.id, Hits: h})
+		}
+	}
+	return
+}
+
+// Eval every matcher at clock; returns the hits of matchers that fired.
+func (e *Engine) Eval(clock int64) (hits []RuleHits) {
+	for _, r := range e.rules {
+		if h := r.matcher.Eval(clock); h.Cnt > 0 {
+			hits = append(hits, RuleHits{Id: r.id, Hits: h})
+		}
+	}
+	return
+}
+
+func (e *Engine) GarbageCollect(clock int64) {
+	for _, r := range e.rules {
+		r.matcher.GarbageCollect(clock)
+	}
+}
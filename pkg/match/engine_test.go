@@ -0,0 +1,203 @@
+package match
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	var (
+		engine = NewEngine()
+		opt    = WithTermCache(engine.Terms())
+
+		// Case insensitive terms have no literal to prefilter on.
+		alpha = regexTerm("(?i)alpha")
+		beta  = regexTerm("(?i)beta")
+	)
+
+	seq, err := NewMatchSeqOpts(10, []TermT{alpha, beta}, opt)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	set, err := NewMatchSetOpts(10, []TermT{beta, alpha}, opt)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	single, err := NewMatchSingleOpts(beta, opt)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	for id, m := range map[string]Matcher{"seq": seq, "set": set, "single": single} {
+		if err := engine.Add(id, m); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+	}
+
+	if engine.Terms().Len() != 2 {
+		t.Fatalf("Expected 2 distinct terms, got %v", engine.Terms().Len())
+	}
+
+	// Count evaluations of each distinct term.
+	calls := make(map[string]int)
+	for term, ct := range engine.Terms().terms {
+		m := ct.matcher
+		ct.matcher = func(line string) bool {
+			calls[term.Value] += 1
+			return m(line)
+		}
+	}
+
+	if hits := engine.Scan(LogEntry{Timestamp: 1, Line: "alpha"}); len(hits) != 0 {
+		t.Fatalf("Expected no hits, got %v", hits)
+	}
+
+	hits := engine.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+	if len(hits) != 3 {
+		t.Fatalf("Expected 3 rule hits, got %v", hits)
+	}
+
+	ids := make(map[string]int)
+	for _, h := range hits {
+		ids[h.Id] = h.Hits.Cnt
+	}
+	if ids["seq"] != 1 || ids["set"] != 1 || ids["single"] != 1 {
+		t.Errorf("Expected one hit per rule, got %v", ids)
+	}
+
+	if calls[alpha.Value] != 2 || calls[beta.Value] != 2 {
+		t.Errorf("Expected each term evaluated once per entry, got %v", calls)
+	}
+}
+
+func TestEngineDupeId(t *testing.T) {
+	engine := NewEngine()
+
+	m, err := NewMatchSingleOpts(makeRaw("alpha"), WithTermCache(engine.Terms()))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	if err := engine.Add("a", m); err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	if err := engine.Add("a", m); err != ErrEngineId {
+		t.Fatalf("Expected ErrEngineId, got %v", err)
+	}
+	if err := engine.Add("b", nil); err != ErrNilMatcher {
+		t.Fatalf("Expected ErrNilMatcher, got %v", err)
+	}
+}
+
+func TestEngineEval(t *testing.T) {
+	engine := NewEngine()
+
+	m, err := NewInverseSeqOpts(10, makeTermsA("alpha", "beta"), []ResetT{{Term: makeRaw("reset"), Window: 5, Absolute: true}}, WithTermCache(engine.Terms()))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	if err := engine.Add("inverse", m); err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	engine.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	engine.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+
+	hits := engine.Eval(10)
+	if len(hits) != 1 || hits[0].Id != "inverse" || hits[0].Hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit on inverse, got %v", hits)
+	}
+}
+
+func TestEngineParseOnce(t *testing.T) {
+	var (
+		engine = NewEngine()
+		opt    = WithTermCache(engine.Terms())
+		docs   = engine.Terms().docs
+		nJson  int
+	)
+
+	// Count decodes on the shared parser.
+	docs.json = memoUnmarshal(func(data []byte, v any) error {
+		nJson += 1
+		return json.Unmarshal(data, v)
+	})
+
+	for i := range 50 {
+		terms := []TermT{
+			{Type: TermJqJson, Value: fmt.Sprintf(".code == %d", i), Extract: "{id: .id}"},
+			{Type: TermJqJson, Value: fmt.Sprintf(".retry == %d", i), Extract: "{id: .id}"},
+		}
+		m, err := NewMatchSeqOpts(10, terms, opt)
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		if err := engine.Add(fmt.Sprintf("rule%d", i), m); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+
+		expr, err := NewMatchSingleOpts(TermT{Type: TermExpr, Value: fmt.Sprintf(`raw("code") and jqJson(".code == %d.5")`, i)}, opt)
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		if err := engine.Add(fmt.Sprintf("expr%d", i), expr); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+	}
+
+	if err := engine.Add("partition", mustPartition(t, opt)); err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	engine.Scan(LogEntry{Timestamp: 1, Line: `{"code": 7, "id": "a"}`})
+	hits := engine.Scan(LogEntry{Timestamp: 2, Line: `{"code": 8, "retry": 7, "id": "a"}`})
+
+	if len(hits) != 1 || hits[0].Id != "rule7" {
+		t.Fatalf("Expected 1 hit on rule7, got %v", hits)
+	}
+	if nJson != 2 {
+		t.Errorf("Expected each line decoded once, got %v decodes", nJson)
+	}
+}
+
+func mustPartition(t *testing.T, opt OptT) Matcher {
+	m, err := NewMatchPartition(KeyT{Type: KeyJqJson, Value: ".id"}, func() (Matcher, error) {
+		return NewMatchSingleOpts(TermT{Type: TermJqJson, Value: ".code > 100"}, opt)
+	}, opt)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	return m
+}
+
+func BenchmarkEngineSharedTerms(b *testing.B) {
+	var (
+		engine = NewEngine()
+		opt    = WithTermCache(engine.Terms())
+	)
+
+	// Many rules share a small pool of regex terms.
+	for i := range 2000 {
+		terms := []TermT{
+			{Type: TermRegex, Value: fmt.Sprintf(`error code=%d\d`, i%10)},
+			{Type: TermRegex, Value: fmt.Sprintf(`retry \w+ %d`, i%20)},
+		}
+		m, err := NewMatchSeqOpts(1000, terms, opt)
+		if err != nil {
+			b.Fatalf("Expected err == nil, got %v", err)
+		}
+		if err := engine.Add(fmt.Sprintf("rule%d", i), m); err != nil {
+			b.Fatalf("Expected err == nil, got %v", err)
+		}
+	}
+
+	ev := LogEntry{Line: "nothing to see here"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ev.Timestamp += 1
+		engine.Scan(ev)
+	}
+}
@@ -0,0 +1,266 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrExprSyntax = errors.New("expression syntax error")
+)
+
+// A TermExpr value is a boolean expression over raw, regex and jq leaves:
+//
+//	raw("timeout") and not regex(`retry(ing)?`)
+//	jqJson(".level == \"error\"") or (raw("panic") && !raw("recovered"))
+//
+// A leaf is a term type followed by a quoted value; double quoted values
+// support Go escapes, back quoted values are taken verbatim.  Operators are
+// 'not' ('!'), 'and' ('&&') and 'or' ('||'), in decreasing precedence, and
+// parentheses group.  Evaluation short circuits left to right, so cheap
+// leaves should come first.
+
+type exprTokT int
+
+const (
+	tokEOF exprTokT = iota
+	tokIdent
+	tokString
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type exprTokenT struct {
+	typ exprTokT
+	val string
+	off int
+}
+
+type exprParserT struct {
+	pc  *parseCacheT
+	src string
+	off int
+	tok exprTokenT
+}
+
+var exprLeafTypes = map[string]TermTypeT{
+	TermRaw.String():        TermRaw,
+	TermRegex.String():      TermRegex,
+	TermJqJson.String():     TermJqJson,
+	TermJqYaml.String():     TermJqYaml,
+	TermJqJsonFast.String(): TermJqJsonFast,
+}
+
+func makeExprMatch(src string, pc *parseCacheT) (MatchFunc, error) {
+	p := &exprParserT{pc: pc, src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.typ != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.val)
+	}
+
+	return m, nil
+}
+
+func (p *exprParserT) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrExprSyntax, p.tok.off, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParserT) parseOr() (MatchFunc, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.typ == tokOr {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := lhs
+		lhs = func(line string) bool {
+			return l(line) || rhs(line)
+		}
+	}
+
+	return lhs, nil
+}
+
+func (p *exprParserT) parseAnd() (MatchFunc, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.typ == tokAnd {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := lhs
+		lhs = func(line string) bool {
+			return l(line) && rhs(line)
+		}
+	}
+
+	return lhs, nil
+}
+
+func (p *exprParserT) parseUnary() (MatchFunc, error) {
+	switch p.tok.typ {
+	case tokNot:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(line string) bool {
+			return !m(line)
+		}, nil
+
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.typ != tokRParen {
+			return nil, p.errorf("expected ')'")
+		}
+		return m, p.next()
+
+	case tokIdent:
+		return p.parseLeaf()
+
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	return nil, p.errorf("unexpected %q", p.tok.val)
+}
+
+func (p *exprParserT) parseLeaf() (MatchFunc, error) {
+	tt, ok := exprLeafTypes[p.tok.val]
+	if !ok {
+		return nil, p.errorf("unknown term type %q", p.tok.val)
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.typ != tokLParen {
+		return nil, p.errorf("expected '('")
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.typ != tokString {
+		return nil, p.errorf("expected quoted value")
+	}
+
+	m, err := TermT{Type: tt, Value: p.tok.val}.compile(p.pc)
+	if err != nil {
+		return nil, fmt.Errorf("%w at offset %d: %w", ErrExprSyntax, p.tok.off, err)
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.typ != tokRParen {
+		return nil, p.errorf("expected ')'")
+	}
+
+	return m, p.next()
+}
+
+// Advance to the next token.
+func (p *exprParserT) next() error {
+	for p.off < len(p.src) && unicode.IsSpace(rune(p.src[p.off])) {
+		p.off++
+	}
+
+	p.tok = exprTokenT{off: p.off}
+	if p.off >= len(p.src) {
+		return nil
+	}
+
+	rest := p.src[p.off:]
+
+	switch c := rest[0]; {
+	case c == '(':
+		p.tok.typ, p.tok.val = tokLParen, "("
+		p.off++
+	case c == ')':
+		p.tok.typ, p.tok.val = tokRParen, ")"
+		p.off++
+	case c == '!':
+		p.tok.typ, p.tok.val = tokNot, "!"
+		p.off++
+	case strings.HasPrefix(rest, "&&"):
+		p.tok.typ, p.tok.val = tokAnd, "&&"
+		p.off += 2
+	case strings.HasPrefix(rest, "||"):
+		p.tok.typ, p.tok.val = tokOr, "||"
+		p.off += 2
+	case c == '"' || c == '`':
+		s, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return p.errorf("unterminated string")
+		}
+		if p.tok.val, err = strconv.Unquote(s); err != nil {
+			return p.errorf("invalid string %s", s)
+		}
+		p.tok.typ = tokString
+		p.off += len(s)
+	case isIdentByte(c):
+		n := 1
+		for n < len(rest) && isIdentByte(rest[n]) {
+			n++
+		}
+		p.tok.val = rest[:n]
+		p.off += n
+
+		switch p.tok.val {
+		case "and":
+			p.tok.typ = tokAnd
+		case "or":
+			p.tok.typ = tokOr
+		case "not":
+			p.tok.typ = tokNot
+		default:
+			p.tok.typ = tokIdent
+		}
+	default:
+		return p.errorf("unexpected character %q", c)
+	}
+
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
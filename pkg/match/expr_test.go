@@ -0,0 +1,137 @@
+package match
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	var tests = map[string]struct {
+		expr  string
+		lines map[string]bool
+	}{
+		"And": {
+			expr: `raw("timeout") and not raw("retrying")`,
+			lines: map[string]bool{
+				"timeout":          true,
+				"timeout retrying": false,
+				"retrying":         false,
+			},
+		},
+		"Or": {
+			expr: `raw("panic") or regex("fatal\\s+error")`,
+			lines: map[string]bool{
+				"panic":        true,
+				"fatal  error": true,
+				"error":        false,
+			},
+		},
+		"Precedence": {
+			// and binds tighter than or
+			expr: `raw("a") or raw("b") and raw("c")`,
+			lines: map[string]bool{
+				"a":  true,
+				"b":  false,
+				"bc": true,
+			},
+		},
+		"Parens": {
+			expr: `(raw("a") or raw("b")) and raw("c")`,
+			lines: map[string]bool{
+				"a":  false,
+				"ac": true,
+				"bc": true,
+			},
+		},
+		"Symbols": {
+			expr: "raw(`x`) && !(raw(`y`) || raw(`z`))",
+			lines: map[string]bool{
+				"x":  true,
+				"xy": false,
+				"xz": false,
+			},
+		},
+		"DoubleNot": {
+			expr: `not not raw("a")`,
+			lines: map[string]bool{
+				"a": true,
+				"b": false,
+			},
+		},
+		"Jq": {
+			expr: `jqJson(".level == \"error\"") and not raw("healthz")`,
+			lines: map[string]bool{
+				`{"level": "error"}`:                    true,
+				`{"level": "info"}`:                     false,
+				`{"level": "error", "path": "healthz"}`: false,
+				`not json`:                              false,
+			},
+		},
+		"RawRegex": {
+			expr: "regex(`\\d{3}`)",
+			lines: map[string]bool{
+				"code 500": true,
+				"code 50":  false,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := TermT{Type: TermExpr, Value: tc.expr}.NewMatcher()
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+			for line, expect := range tc.lines {
+				if got := m(line); got != expect {
+					t.Errorf("Line %q: expected %v, got %v", line, expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	var tests = map[string]string{
+		"Empty":        ` `,
+		"UnknownType":  `xml("a")`,
+		"Unterminated": `raw("a`,
+		"NoParen":      `raw "a"`,
+		"NoValue":      `raw()`,
+		"Unbalanced":   `(raw("a")`,
+		"Trailing":     `raw("a") raw("b")`,
+		"DanglingOp":   `raw("a") and`,
+		"BadChar":      `raw("a") ^ raw("b")`,
+		"BadRegex":     `regex("([")`,
+		"EmptyLeaf":    `raw("")`,
+	}
+
+	for name, expr := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := TermT{Type: TermExpr, Value: expr}.NewMatcher()
+			if !errors.Is(err, ErrTermCompile) || !errors.Is(err, ErrExprSyntax) {
+				t.Fatalf("Expected ErrTermCompile and ErrExprSyntax, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExprInSeq(t *testing.T) {
+	sm, err := NewMatchSeq(10,
+		TermT{Type: TermExpr, Value: `raw("timeout") and not raw("retrying")`},
+		makeRaw("giving up"),
+	)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "timeout, retrying"})
+	if hits := sm.Scan(LogEntry{Timestamp: 2, Line: "giving up"}); hits.Cnt != 0 {
+		t.Fatalf("Expected no hits, got %v", hits.Cnt)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 3, Line: "timeout"})
+	if hits := sm.Scan(LogEntry{Timestamp: 4, Line: "giving up"}); hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit, got %v", hits.Cnt)
+	}
+}
@@ -0,0 +1,97 @@
+package match
+
+import (
+	"iter"
+	"math"
+)
+
+// A HitFrame is a single firing of a matcher: the entries that satisfied its
+// terms, in term order, and the time they span.  Frames emitted by matchers
+// are sub-slices of Hits.Logs and Hits.Meta; frames may differ in size, eg.
+// a MatchSet with duplicate terms or a nested matcher.
+
+type HitFrame struct {
+	Start  int64      // Earliest timestamp in the frame
+	Stop   int64      // Latest timestamp in the frame; the expired deadline for MatchAbsence
+	Window int64      // Window of the matcher that fired
+	Key    string     // Partition key; empty unless emitted by a MatchPartition
+	Logs   []LogEntry // Entries in term order
+	Meta   []HitMeta  // Metadata per entry; nil unless enabled with WithHitMeta
+}
+
+func newHitFrame(window int64, logs []LogEntry, meta []HitMeta) HitFrame {
+	f := HitFrame{
+		Start:  math.MaxInt64,
+		Stop:   math.MinInt64,
+		Window: window,
+		Logs:   logs,
+		Meta:   meta,
+	}
+
+	for _, e := range logs {
+		f.Start = min(f.Start, e.Timestamp)
+		f.Stop = max(f.Stop, e.Timestamp)
+	}
+
+	if len(logs) == 0 {
+		f.Start, f.Stop = 0, 0
+	}
+
+	return f
+}
+
+// Close a frame over the entries added to Logs since the previous frame.
+func (h *Hits) closeFrame(window int64) {
+	var off int
+	for _, f := range h.Frames {
+		off += len(f.Logs)
+	}
+
+	var (
+		end  = len(h.Logs)
+		meta []HitMeta
+	)
+
+	// Clip, so that appending to one frame cannot overwrite the next.
+	if len(h.Meta) >= end {
+		meta = h.Meta[off:end:end]
+	}
+
+	h.Frames = append(h.Frames, newHitFrame(window, h.Logs[off:end:end], meta))
+	h.Cnt += 1
+}
+
+// Frame returns the i'th frame.  Hits built by hand without Frames are split
+// into Cnt frames of equal size.
+func (h Hits) Frame(i int) HitFrame {
+	if i < 0 || i >= h.Cnt {
+		return HitFrame{}
+	}
+
+	if len(h.Frames) == h.Cnt {
+		return h.Frames[i]
+	}
+
+	var (
+		sz   = len(h.Logs) / h.Cnt
+		off  = i * sz
+		meta []HitMeta
+	)
+
+	if len(h.Meta) == len(h.Logs) {
+		meta = h.Meta[off : off+sz]
+	}
+
+	return newHitFrame(0, h.Logs[off:off+sz], meta)
+}
+
+// All iterates over the frames in order.
+func (h Hits) All() iter.Seq2[int, HitFrame] {
+	return func(yield func(int, HitFrame) bool) {
+		for i := range h.Cnt {
+			if !yield(i, h.Frame(i)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package match
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHitFrameSet(t *testing.T) {
+	sm, err := NewMatchSet(10, makeTermsA("alpha", "beta")...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 3, Line: "beta"})
+	hits := sm.Scan(LogEntry{Timestamp: 5, Line: "alpha"})
+
+	if hits.Cnt != 1 || len(hits.Frames) != 1 {
+		t.Fatalf("Expected 1 frame, got %v", hits)
+	}
+
+	f := hits.Frame(0)
+	if f.Start != 3 || f.Stop != 5 || f.Window != 10 || len(f.Logs) != 2 {
+		t.Errorf("Expected frame [3,5] window 10, got %v", f)
+	}
+	if f.Logs[0].Line != "alpha" || f.Logs[1].Line != "beta" {
+		t.Errorf("Expected entries in term order, got %v", f.Logs)
+	}
+}
+
+func TestHitFrameUnequal(t *testing.T) {
+	var (
+		hits Hits
+		sm1  = mustSet(t, makeTermsA("alpha", "alpha", "beta"))
+		sm2  = mustSet(t, makeTermsA("gamma"))
+	)
+
+	sm1.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm1.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	appendHits(&hits, sm1.Scan(LogEntry{Timestamp: 3, Line: "beta"}))
+	appendHits(&hits, sm2.Scan(LogEntry{Timestamp: 4, Line: "gamma"}))
+
+	if hits.Cnt != 2 || len(hits.Logs) != 4 {
+		t.Fatalf("Expected 2 hits over 4 entries, got %v", hits)
+	}
+
+	var sizes []int
+	for i, f := range hits.All() {
+		if f.Start != hits.Frames[i].Start {
+			t.Errorf("Frame %d: expected %v, got %v", i, hits.Frames[i], f)
+		}
+		sizes = append(sizes, len(f.Logs))
+	}
+	if len(sizes) != 2 || sizes[0] != 3 || sizes[1] != 1 {
+		t.Fatalf("Expected frame sizes [3 1], got %v", sizes)
+	}
+
+	// Stride arithmetic would take two entries off the front.
+	if f := hits.PopFrame(); len(f.Logs) != 3 || f.Stop != 3 {
+		t.Errorf("Expected first frame, got %v", f)
+	}
+	if hits.Cnt != 1 || len(hits.Logs) != 1 || hits.Logs[0].Line != "gamma" {
+		t.Errorf("Expected gamma frame left, got %v", hits)
+	}
+	if f := hits.Frame(0); f.Start != 4 || len(f.Logs) != 1 {
+		t.Errorf("Expected gamma frame, got %v", f)
+	}
+
+	if f := hits.PopFrame(); f.Logs[0].Line != "gamma" || hits.Cnt != 0 || len(hits.Logs) != 0 {
+		t.Errorf("Expected empty hits, got %v %v", f, hits)
+	}
+	if f := hits.PopFrame(); f.Logs != nil {
+		t.Errorf("Expected empty frame, got %v", f)
+	}
+}
+
+func TestHitFrameLegacy(t *testing.T) {
+	hits := Hits{
+		Cnt: 2,
+		Logs: []LogEntry{
+			{Timestamp: 1}, {Timestamp: 2},
+			{Timestamp: 3}, {Timestamp: 4},
+		},
+	}
+
+	f := hits.Frame(1)
+	if f.Start != 3 || f.Stop != 4 || len(f.Logs) != 2 {
+		t.Errorf("Expected second stride, got %v", f)
+	}
+	if f := hits.Frame(2); f.Logs != nil {
+		t.Errorf("Expected empty frame, got %v", f)
+	}
+
+	logs := hits.PopFront()
+	if len(logs) != 2 || logs[0].Timestamp != 1 || hits.Cnt != 1 || hits.Logs[0].Timestamp != 3 {
+		t.Errorf("Expected first stride popped, got %v %v", logs, hits)
+	}
+}
+
+func TestHitFrameAbsence(t *testing.T) {
+	am, err := NewMatchAbsence(10, makeRaw("alpha"), WithStartTerm(makeRaw("start")))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	am.Scan(LogEntry{Timestamp: 2, Line: "start"})
+	hits := am.Eval(20)
+	if hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit, got %v", hits)
+	}
+
+	if f := hits.Frame(0); f.Start != 2 || f.Stop != 12 {
+		t.Errorf("Expected frame to stop at deadline, got %v", f)
+	}
+}
+
+func TestHitFramePartition(t *testing.T) {
+	pm, err := NewMatchPartition(KeyT{Type: KeyRegex, Value: `id=(\w+)`}, func() (Matcher, error) {
+		return NewMatchSingle(makeRaw("fail"))
+	})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	hits := pm.Scan(LogEntry{Timestamp: 1, Line: "fail id=a"})
+	if f := hits.Frame(0); f.Key != "a" || len(f.Logs) != 1 {
+		t.Errorf("Expected frame keyed a, got %v", f)
+	}
+}
+
+func TestHitFrameDedupe(t *testing.T) {
+	var (
+		dd   = NewDedupe(time.Hour)
+		now  = time.Now().UnixNano()
+		hits Hits
+	)
+
+	sm := mustSet(t, makeTermsA("alpha", "alpha", "beta"))
+	sm.Scan(LogEntry{Timestamp: now, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: now, Line: "alpha"})
+	appendHits(&hits, sm.Scan(LogEntry{Timestamp: now, Line: "beta"}))
+	appendHits(&hits, mustSet(t, makeTermsA("gamma")).Scan(LogEntry{Timestamp: now + 1, Line: "gamma"}))
+
+	fire, hint := dd.MaybeFireFrame(now+1, hits)
+	if len(fire.Logs) != 3 || fire.Start != now {
+		t.Fatalf("Expected first frame to fire, got %v", fire)
+	}
+	if hint == 0 {
+		t.Errorf("Expected hint for pending frame")
+	}
+
+	// Pending frame fires once the active window expires.
+	fire, _ = dd.MaybeFireFrame(now+int64(time.Hour), Hits{})
+	if len(fire.Logs) != 1 || fire.Logs[0].Line != "gamma" {
+		t.Errorf("Expected pending gamma frame, got %v", fire)
+	}
+}
+
+func mustSet(t *testing.T, terms []TermT) *MatchSet {
+	t.Helper()
+	sm, err := NewMatchSet(10, terms...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	return sm
+}
@@ -0,0 +1,179 @@
+package match
+
+import (
+	"errors"
+)
+
+// Gaps bound the delay between consecutive terms of a MatchSeq or
+// InverseSeq, on top of the window across the whole sequence; eg. B within
+// 2s of A, then C at least 30s after B.  gaps[i] applies from term i to term
+// i+1; a Max of zero is unbounded.
+//
+// Gaps are enforced by pruning.  After each change the matcher drops every
+// assert that cannot be part of a chain that fits the gaps: one with no
+// predecessor in range, or one whose successors are all out of range and
+// whose max gap has elapsed on the clock.  The first assert of each term then
+// always forms a valid chain, so a sequence fires as it would without gaps.
+// The earliest time an assert may expire by its max gap is folded into the GC
+// horizon.  Pruned asserts are counted as stale.
+
+var (
+	ErrGap      = errors.New("invalid gap")
+	ErrGapRange = errors.New("more gaps than term transitions")
+)
+
+type GapT struct {
+	Min int64 // Minimum delay from the previous term
+	Max int64 // Maximum delay from the previous term; zero if unbounded
+}
+
+type gapsT []GapT // Nil if no gaps
+
+func newGaps(gaps []GapT, nTerms int) (gapsT, error) {
+	if len(gaps) > max(nTerms-1, 0) {
+		return nil, ErrGapRange
+	}
+
+	var set bool
+	for _, g := range gaps {
+		switch {
+		case g.Min < 0 || g.Max < 0:
+			return nil, ErrGap
+		case g.Max > 0 && g.Max < g.Min:
+			return nil, ErrGap
+		case g.Min > 0 || g.Max > 0:
+			set = true
+		}
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	out := make(gapsT, nTerms-1)
+	copy(out, gaps)
+	return out, nil
+}
+
+// Whether a delay from term i to term i+1 fits.
+func (g gapsT) fits(i int, from, to int64) bool {
+	if g == nil {
+		return true
+	}
+	d := to - from
+	return d >= g[i].Min && (g[i].Max == 0 || d <= g[i].Max)
+}
+
+// Whether a on term i may be followed by b on term i+1.
+func (g gapsT) link(order orderT, i int, a, b assertT) bool {
+	return order.before(a, b) && a.seq != b.seq && g.fits(i, a.Timestamp, b.Timestamp)
+}
+
+// Whether the entry being scanned may follow an assert of terms[i].
+func (g gapsT) linked(order orderT, terms []termT, i int, e LogEntry) bool {
+	if g == nil {
+		return order.follows(terms[i].asserts[0], e)
+	}
+
+	b := assertT{LogEntry: e, seq: order.seq}
+	for _, a := range terms[i].asserts {
+		if g.link(order, i, a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// The time at which an assert on term i stamped ts expires unless followed.
+func (g gapsT) expiry(i int, ts int64) int64 {
+	if g == nil || i >= len(g) || g[i].Max == 0 {
+		return disableGC
+	}
+	return ts + g[i].Max + 1
+}
+
+// Drop the asserts of terms[:nActive] that cannot be part of a chain that
+// fits the gaps at clock; calls dropped with the term index and count.
+// Returns the new active count and the earliest time a remaining assert
+// may expire.
+func (g gapsT) prune(terms []termT, nActive int, clock int64, order orderT, dropped func(idx, cnt int)) (int, int64) {
+	var (
+		mark = disableGC
+		keep = make([][]bool, nActive)
+	)
+
+	// Backward; an assert is alive if it has an alive successor, or
+	// may still be followed by an entry not yet scanned.
+	for i := nActive - 1; i >= 0; i-- {
+		keep[i] = make([]bool, len(terms[i].asserts))
+
+		for j, a := range terms[i].asserts {
+			if i == len(terms)-1 {
+				keep[i][j] = true
+				continue
+			}
+
+			if i+1 < nActive {
+				for k, b := range terms[i+1].asserts {
+					if keep[i+1][k] && g.link(order, i, a, b) {
+						keep[i][j] = true
+						break
+					}
+				}
+			}
+
+			if !keep[i][j] {
+				if exp := g.expiry(i, a.Timestamp); clock < exp {
+					keep[i][j] = true
+					mark = min(mark, exp)
+				}
+			}
+		}
+	}
+
+	// Forward; an assert is reachable if an alive predecessor links to it.
+	for i := 1; i < nActive; i++ {
+		for j, b := range terms[i].asserts {
+			if !keep[i][j] {
+				continue
+			}
+
+			var ok bool
+			for k, a := range terms[i-1].asserts {
+				if keep[i-1][k] && g.link(order, i-1, a, b) {
+					ok = true
+					break
+				}
+			}
+			keep[i][j] = ok
+		}
+	}
+
+	n := nActive
+	for i := range nActive {
+		var (
+			cnt int
+			m   = terms[i].asserts
+		)
+
+		for j, a := range m {
+			if keep[i][j] {
+				m[cnt] = a
+				cnt++
+			}
+		}
+
+		if drop := len(m) - cnt; drop > 0 {
+			dropped(i, drop)
+			clear(m[cnt:])
+			terms[i].asserts = m[:cnt]
+			terms[i].bytes = assertBytes(m[:cnt])
+		}
+
+		if cnt == 0 && i < n {
+			n = i
+		}
+	}
+
+	return n, mark
+}
@@ -0,0 +1,140 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGapSeq(t *testing.T) {
+	// Beta within 2 of alpha, then gamma at least 30 after beta.
+	gaps := WithGaps(GapT{Max: 2}, GapT{Min: 30})
+
+	tests := map[string]struct {
+		stamps []int64 // alpha, beta, gamma...
+		want   [][]int64
+	}{
+		"fits":       {stamps: []int64{0, 1, 40}, want: [][]int64{{0, 1, 40}}},
+		"lateBeta":   {stamps: []int64{0, 5, 40}},
+		"earlyGamma": {stamps: []int64{0, 1, 20}},
+		"waitGamma":  {stamps: []int64{0, 1, 20, 31}, want: [][]int64{{0, 1, 31}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeqOpts(100, makeTermsA("alpha", "beta", "gamma"), gaps)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var hits Hits
+			for i, ts := range tc.stamps {
+				line := []string{"alpha", "beta", "gamma"}[min(i, 2)]
+				appendHits(&hits, sm.Scan(LogEntry{Timestamp: ts, Line: line}))
+			}
+
+			if got := frameStamps(hits); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGapMaxPrune(t *testing.T) {
+	sm, err := NewMatchSeqOpts(100, makeTermsA("alpha", "beta"), WithGaps(GapT{Max: 2}))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// Alpha at 0 is dropped once its gap has elapsed, before the window.
+	sm.Scan(LogEntry{Timestamp: 0, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 5, Line: "noise"})
+	if st := sm.Stats(); st.Asserts != 0 || st.DropStale != 1 {
+		t.Errorf("Expected alpha pruned, got %+v", st)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 10, Line: "alpha"})
+	hits := sm.Scan(LogEntry{Timestamp: 12, Line: "beta"})
+	if got := frameStamps(hits); !reflect.DeepEqual(got, [][]int64{{10, 12}}) {
+		t.Errorf("Expected [[10 12]], got %v", got)
+	}
+}
+
+func TestGapMinPrune(t *testing.T) {
+	sm, err := NewMatchSeqOpts(100, makeTermsA("alpha", "beta", "gamma"), WithGaps(GapT{Min: 5}))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 0, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 6, Line: "beta"})
+	sm.Scan(LogEntry{Timestamp: 7, Line: "beta"})
+
+	// Both betas follow the first alpha; neither follows the second.
+	var hits Hits
+	appendHits(&hits, sm.Scan(LogEntry{Timestamp: 9, Line: "gamma"}))
+	appendHits(&hits, sm.Scan(LogEntry{Timestamp: 10, Line: "gamma"}))
+
+	if got := frameStamps(hits); !reflect.DeepEqual(got, [][]int64{{0, 6, 9}}) {
+		t.Errorf("Expected [[0 6 9]], got %v", got)
+	}
+	if st := sm.Stats(); st.Asserts != 1 || st.DropStale != 1 {
+		t.Errorf("Expected beta at 7 pruned, got %+v", st)
+	}
+}
+
+func TestGapSelectAll(t *testing.T) {
+	sm, err := NewMatchSeqOpts(100, makeTermsA("alpha", "beta"), WithGaps(GapT{Min: 2}), WithSelect(SelectAll))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	for ts := range 3 {
+		sm.Scan(LogEntry{Timestamp: int64(ts), Line: "alpha"})
+	}
+
+	want := [][]int64{{0, 3}, {1, 3}}
+	if got := frameStamps(sm.Scan(LogEntry{Timestamp: 3, Line: "beta"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestGapInverseSeq(t *testing.T) {
+	is, err := NewInverseSeqOpts(100, makeTermsA("alpha", "beta"), []ResetT{
+		{Term: makeRaw("reset")},
+	}, WithGaps(GapT{Max: 2}))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	is.Scan(LogEntry{Timestamp: 0, Line: "alpha"})
+	is.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+	is.Scan(LogEntry{Timestamp: 10, Line: "alpha"})
+	is.Scan(LogEntry{Timestamp: 11, Line: "beta"})
+
+	if got := frameStamps(is.Eval(200)); !reflect.DeepEqual(got, [][]int64{{10, 11}}) {
+		t.Errorf("Expected [[10 11]], got %v", got)
+	}
+}
+
+func TestGapErrors(t *testing.T) {
+	tests := map[string]struct {
+		gaps []GapT
+		err  error
+	}{
+		"range":    {gaps: []GapT{{Max: 1}, {Max: 1}}, err: ErrGapRange},
+		"negative": {gaps: []GapT{{Min: -1}}, err: ErrGap},
+		"inverted": {gaps: []GapT{{Min: 5, Max: 2}}, err: ErrGap},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMatchSeqOpts(10, makeTermsA("alpha", "beta"), WithGaps(tc.gaps...)); err != tc.err {
+				t.Errorf("Expected %v, got %v", tc.err, err)
+			}
+			if _, err := NewInverseSeqOpts(10, makeTermsA("alpha", "beta"), nil, WithGaps(tc.gaps...)); err != tc.err {
+				t.Errorf("Expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
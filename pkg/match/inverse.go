@@ -12,7 +12,7 @@ var (
 )
 
 const (
-	maxTerms     = 64
+	maxTerms     = 1024 // Sanity bound; term masks are not limited in width.
 	capThreshold = 4
 )
 
@@ -20,22 +20,52 @@ type ResetT struct {
 	Term     TermT // Inverse term
 	Window   int64 // Window size; defaults to 0 which in combination with !Absolute means the window is the range of the matched sequence.
 	Slide    int64 // Slide the anchor, +/- relative to the anchor term
-	Anchor   uint8 // Anchor term; defaults to first event in match sequence
+	Anchor   int   // Anchor term; defaults to first event in match sequence
 	Absolute bool  // Absolute window time or relative to the range of the matched sequence.
 }
 
 type resetT struct {
-	matcher  MatchFunc
+	matcher  EntryMatchFunc
 	resets   []int64
 	window   int64
 	slide    int64
-	anchor   uint8
+	anchor   int
 	absolute bool
 }
 
 type termT struct {
-	matcher MatchFunc
-	asserts []LogEntry
+	matcher EntryMatchFunc
+	capture captureFuncT // nil if the term captures no fields
+	asserts []assertT
+	bytes   int // Estimated size of asserts; see LogEntry.Size
+}
+
+// A matched LogEntry along with any fields captured by the term.
+type assertT struct {
+	LogEntry
+	fields []fieldT
+	seq    uint64 // Input sequence number; see order.go
+}
+
+func (t termT) newAssert(e LogEntry) assertT {
+	a := assertT{LogEntry: e}
+	if t.capture != nil {
+		a.fields = t.capture(e.Line)
+	}
+	return a
+}
+
+// Buffer e as an assert.
+func (t *termT) push(e LogEntry) {
+	t.asserts = append(t.asserts, t.newAssert(e))
+	t.bytes += e.Size()
+}
+
+func assertBytes(m []assertT) (n int) {
+	for _, a := range m {
+		n += a.Size()
+	}
+	return
 }
 
 func (r resetT) calcWindow(stamps []int64) (int64, int64) {
@@ -105,10 +135,13 @@ func shiftLeft(terms []termT, idx, cnt int) int {
 
 	switch {
 	case cnt < len(m):
+		terms[idx].bytes -= assertBytes(m[:cnt])
 		m = m[cnt:]
 	case cap(m) <= capThreshold:
+		terms[idx].bytes = 0
 		m = m[:0]
 	default:
+		terms[idx].bytes = 0
 		m = nil
 	}
 
@@ -118,6 +151,7 @@ func shiftLeft(terms []termT, idx, cnt int) int {
 
 func resetTerm(terms []termT, idx int) {
 	m := terms[idx].asserts
+	terms[idx].bytes = 0
 
 	if cap(m) <= capThreshold {
 		terms[idx].asserts = m[:0]
@@ -138,6 +172,7 @@ func shiftAnchor(terms []termT, drop anchorT) int {
 		m = terms[drop.term].asserts
 	)
 
+	terms[drop.term].bytes -= m[i].Size()
 	m = slices.Delete(m, i, i+1)
 	terms[drop.term].asserts = m
 	return len(m)
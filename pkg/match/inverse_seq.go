@@ -1,7 +1,6 @@
 package match
 
 import (
-	"math"
 	"slices"
 
 	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
@@ -12,17 +11,29 @@ type InverseSeq struct {
 	clock    int64
 	window   int64
 	gcMark   int64
+	gapMark  int64
 	gcLeft   int64
 	gcRight  int64
 	nActive  int
 	dupeMask bitMaskT
+	order    orderT
+	gaps     gapsT
 	terms    []termT
+	matched  []bool // Per term result of the current entry
 	resets   []resetT
+	meta     hitMetaT
+	trace    tracerT
 }
 
 func NewInverseSeq(window int64, seqTerms []TermT, resetTerms []ResetT) (*InverseSeq, error) {
+	return NewInverseSeqOpts(window, seqTerms, resetTerms)
+}
+
+// NewInverseSeqOpts is NewInverseSeq with options.
+func NewInverseSeqOpts(window int64, seqTerms []TermT, resetTerms []ResetT, opts ...OptT) (*InverseSeq, error) {
 
 	var (
+		o        = parseOpts(opts)
 		resets   []resetT
 		nTerms   = len(seqTerms)
 		terms    = make([]termT, 0, nTerms)
@@ -47,7 +58,7 @@ func NewInverseSeq(window int64, seqTerms []TermT, resetTerms []ResetT) (*Invers
 	}
 
 	for i, term := range seqTerms {
-		m, err := term.NewMatcher()
+		m, err := o.newMatcher(term)
 		if err != nil {
 			return nil, err
 		}
@@ -57,15 +68,21 @@ func NewInverseSeq(window int64, seqTerms []TermT, resetTerms []ResetT) (*Invers
 		}
 	}
 
+	if correlate, err := installCaptures(terms, seqTerms, o.parseCache()); err != nil {
+		return nil, err
+	} else if correlate {
+		return nil, ErrCorrelateInverse
+	}
+
 	if len(resetTerms) > 0 {
 		resets = make([]resetT, 0, len(resetTerms))
 
 		for _, term := range resetTerms {
-			m, err := term.Term.NewMatcher()
+			m, err := o.newMatcher(term.Term)
 			switch {
 			case err != nil:
 				return nil, err
-			case int(term.Anchor) >= len(seqTerms):
+			case term.Anchor < 0 || term.Anchor >= len(seqTerms):
 				return nil, ErrAnchorRange
 			}
 
@@ -80,36 +97,62 @@ func NewInverseSeq(window int64, seqTerms []TermT, resetTerms []ResetT) (*Invers
 	}
 	gcLeft, gcRight := calcGCWindow(window, resets)
 
+	gaps, err := newGaps(o.gaps, nTerms)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := newHitMeta(o, seqTerms, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	return &InverseSeq{
 		window:   window,
 		gcLeft:   gcLeft,
 		gcRight:  gcRight,
 		gcMark:   disableGC,
+		gapMark:  disableGC,
 		dupeMask: dupeMask,
+		order:    orderT{policy: o.order},
+		gaps:     gaps,
 		terms:    terms,
+		matched:  make([]bool, nTerms),
 		resets:   resets,
+		meta:     meta,
+		trace:    newTracer(o, nTerms, nil),
 	}, nil
 }
 
 func (r *InverseSeq) Scan(e entry.LogEntry) (hits Hits) {
+	r.trace.scan()
 	if e.Timestamp < r.clock {
 		log.Warn().
 			Str("line", e.Line).
 			Int64("stamp", e.Timestamp).
 			Int64("clock", r.clock).
 			Msg("MatchSeq: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
 		return
 	}
 	r.clock = e.Timestamp
+	r.order.next()
 
 	r.maybeGC(e.Timestamp)
 
+	// Count every term, not only those the state machine can take.
+	for i := range r.terms {
+		if r.matched[i] = r.terms[i].matcher(e); r.matched[i] {
+			r.trace.match(i)
+		}
+	}
+
 	// Zero match optimization to avoid resets if no lookback is needed.
 	var zeroMatch bool
 	switch {
 	case r.nActive > 0:
 	case r.gcLeft > 0:
-	case !r.terms[r.nActive].matcher(e.Line):
+	case !r.matched[r.nActive]:
 		return
 	default:
 		zeroMatch = true
@@ -117,16 +160,17 @@ func (r *InverseSeq) Scan(e entry.LogEntry) (hits Hits) {
 
 	// Run resets
 	for i, reset := range r.resets {
-		if reset.matcher(e.Line) {
+		if reset.matcher(e) {
 			r.resets[i].resets = append(reset.resets, e.Timestamp)
+			r.trace.reset(r.clock, i, e)
 			r.resetGcMark(e.Timestamp + r.gcLeft + r.gcRight)
 		}
 	}
 
 	// Run the active terms
 	for i := range r.nActive {
-		if r.terms[i].matcher(e.Line) {
-			r.terms[i].asserts = append(r.terms[i].asserts, e)
+		if r.matched[i] && (i == 0 || r.gaps == nil || r.gaps.linked(r.order, r.terms, i-1, e)) {
+			r.push(i, e)
 		}
 	}
 
@@ -134,11 +178,13 @@ func (r *InverseSeq) Scan(e entry.LogEntry) (hits Hits) {
 
 		switch {
 		case zeroMatch:
-		case !r.terms[r.nActive].matcher(e.Line):
+		case !r.matched[r.nActive]:
 			return // No match on active term; NOOP.
+		case r.nActive > 0 && !r.gaps.linked(r.order, r.terms, r.nActive-1, e):
+			return // Cannot follow the previous term; NOOP.
 		}
 
-		r.terms[r.nActive].asserts = append(r.terms[r.nActive].asserts, e)
+		r.push(r.nActive, e)
 		r.nActive += 1
 
 		r.resetGcMark(e.Timestamp + r.gcRight)
@@ -151,6 +197,12 @@ func (r *InverseSeq) Scan(e entry.LogEntry) (hits Hits) {
 	return r.Eval(e.Timestamp)
 }
 
+func (r *InverseSeq) push(idx int, e LogEntry) {
+	r.order.push(&r.terms[idx], e)
+	r.trace.assert(r.clock, idx, e)
+	r.resetGcMark(r.gaps.expiry(idx, e.Timestamp))
+}
+
 // Assert clock, may used to close out matcher
 func (r *InverseSeq) Eval(clock int64) (hits Hits) {
 	var nTerms = len(r.terms)
@@ -159,6 +211,7 @@ func (r *InverseSeq) Eval(clock int64) (hits Hits) {
 
 		var (
 			drop   = -1
+			reason = DropWindow
 			tStart = r.terms[0].asserts[0].Timestamp
 			tStop  = r.terms[len(r.terms)-1].asserts[0].Timestamp
 		)
@@ -169,8 +222,9 @@ func (r *InverseSeq) Eval(clock int64) (hits Hits) {
 			retryNanos, anchor := r.checkReset(clock)
 
 			switch {
-			case anchor != math.MaxUint8:
-				drop = int(anchor)
+			case anchor != NoTerm:
+				drop = anchor
+				reason = DropReset
 			case retryNanos > 0:
 				// We have a match that is too recent; we must wait.
 				return
@@ -180,18 +234,20 @@ func (r *InverseSeq) Eval(clock int64) (hits Hits) {
 		if drop >= 0 {
 			// We have a negative match;
 			// remove the offending term assert and continue.
+			r.trace.drop(clock, reason, drop, 1)
 			shiftLeft(r.terms, drop, 1)
 		} else {
 			// Fire hit and prune first assert from each term.
-			hits.Cnt += 1
 			if hits.Logs == nil {
 				hits.Logs = make([]LogEntry, 0, nTerms)
 			}
 
 			for i, term := range r.terms {
-				hits.Logs = append(hits.Logs, term.asserts[0])
+				r.meta.add(&hits, term.asserts[0].LogEntry, i)
 				shiftLeft(r.terms, i, 1)
 			}
+			hits.closeFrame(r.window)
+			r.trace.hit(clock, hits)
 		}
 
 		// Fixup state
@@ -239,6 +295,7 @@ func (r *InverseSeq) GarbageCollect(clock int64) {
 	}
 
 	if cnt > 0 {
+		r.trace.gc(clock, 0, cnt)
 		shiftLeft(r.terms, 0, cnt)
 	}
 
@@ -247,6 +304,7 @@ func (r *InverseSeq) GarbageCollect(clock int64) {
 	if r.nActive > 0 {
 		nMark = r.terms[0].asserts[0].Timestamp + r.gcRight
 	}
+	nMark = min(nMark, r.gapMark)
 
 	// Adjust the deadline for the reset terms
 	deadline -= r.gcLeft
@@ -286,6 +344,7 @@ func (r *InverseSeq) GarbageCollect(clock int64) {
 func (r *InverseSeq) miniGC() {
 
 	if len(r.terms[0].asserts) == 0 {
+		r.trace.dropTerms(r.clock, DropStale, r.terms, 1)
 		r.reset()
 		return
 	}
@@ -305,7 +364,7 @@ func (r *InverseSeq) miniGC() {
 	// Do not allocate if not processing dupes.
 	// Dupe detection  is used to prune duplicate terms
 	// that are incorrectly activated due to garbage collection.
-	if !r.dupeMask.Zeros() {
+	if !r.dupeMask.Zeros() && r.order.lenient() {
 		dupes = make(map[dupeT]struct{}, len(r.terms))
 		if r.dupeMask.IsSet(0) {
 			term := r.terms[0].asserts[0]
@@ -322,6 +381,7 @@ func (r *InverseSeq) miniGC() {
 	for i := 1; i < r.nActive; i++ {
 
 		if forceClear {
+			r.trace.drop(r.clock, DropStale, i, len(r.terms[i].asserts))
 			resetTerm(r.terms, i)
 			continue
 		}
@@ -332,6 +392,11 @@ func (r *InverseSeq) miniGC() {
 		for _, term := range r.terms[i].asserts {
 
 			switch {
+			case !r.order.lenient():
+				// Drop asserts that cannot follow the previous term.
+				if r.order.before(r.terms[i-1].asserts[0], term) {
+					break TERMLOOP
+				}
 			case term.Timestamp < zeroMatch:
 			case r.dupeMask.IsSet(i):
 				dupe := dupeT{
@@ -350,13 +415,14 @@ func (r *InverseSeq) miniGC() {
 		}
 
 		if cnt > 0 {
+			r.trace.drop(r.clock, DropStale, i, cnt)
 			shiftLeft(r.terms, i, cnt)
 		}
 
 		if len(r.terms[i].asserts) > 0 {
 			nActive++
 
-			if r.dupeMask.IsSet(i) {
+			if dupes != nil && r.dupeMask.IsSet(i) {
 				term := r.terms[i].asserts[0]
 				dupes[dupeT{
 					Line:      term.Line,
@@ -371,6 +437,17 @@ func (r *InverseSeq) miniGC() {
 
 	r.nActive = nActive
 
+	if r.gaps != nil {
+		r.pruneGaps()
+	}
+}
+
+// Drop asserts that cannot be part of a chain that fits the gaps.
+func (r *InverseSeq) pruneGaps() {
+	r.nActive, r.gapMark = r.gaps.prune(r.terms, r.nActive, r.clock, r.order, func(idx, cnt int) {
+		r.trace.drop(r.clock, DropStale, idx, cnt)
+	})
+	r.resetGcMark(r.gapMark)
 }
 
 func (r *InverseSeq) reset() {
@@ -380,7 +457,7 @@ func (r *InverseSeq) reset() {
 	r.nActive = 0
 }
 
-func (r *InverseSeq) checkReset(clock int64) (int64, uint8) {
+func (r *InverseSeq) checkReset(clock int64) (int64, int) {
 	// 'stamps'  escapes;  annoying.
 	// TODO: consider avoiding by using s.terms[0].asserts[0].Timestamp directly
 	var (
@@ -407,11 +484,11 @@ func (r *InverseSeq) checkReset(clock int64) (int64, uint8) {
 		// We must wait until the reset window is in the past due to events with
 		// duplicate timestamps.  Thus must wait until one tick past the reset window.
 		if stop >= clock {
-			return stop - clock + 1, math.MaxUint8
+			return stop - clock + 1, NoTerm
 		}
 	}
 
-	return 0, math.MaxUint8
+	return 0, NoTerm
 }
 
 func (r *InverseSeq) resetGcMark(nMark int64) {
@@ -1,6 +1,7 @@
 package match
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -33,6 +34,20 @@ func TestSeqInverseBadReset(t *testing.T) {
 	}
 }
 
+func TestSeqInverseAnchorRange(t *testing.T) {
+	values := make([]string, 300)
+	for i := range values {
+		values[i] = fmt.Sprintf("term%03d", i)
+	}
+
+	for anchor, want := range map[int]error{299: nil, 300: ErrAnchorRange, -1: ErrAnchorRange} {
+		resets := []ResetT{{Term: makeRaw("Shutdown initiated"), Anchor: anchor}}
+		if _, err := NewInverseSeq(10, makeTermsA(values...), resets); err != want {
+			t.Errorf("Anchor %d: expected %v, got %v", anchor, want, err)
+		}
+	}
+}
+
 func TestSeqInverse(t *testing.T) {
 	type step = stepT[InverseSeq]
 
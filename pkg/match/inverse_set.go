@@ -19,16 +19,27 @@ type InverseSet struct {
 	terms   []termT
 	resets  []resetT
 	dupeMap map[int]int
+	meta    hitMetaT
+	trace   tracerT
+	limit   limitT
 }
 
 func NewInverseSet(window int64, setTerms []TermT, resetTerms []ResetT) (*InverseSet, error) {
+	return NewInverseSetOpts(window, setTerms, resetTerms)
+}
+
+// NewInverseSetOpts is NewInverseSet with options.
+func NewInverseSetOpts(window int64, setTerms []TermT, resetTerms []ResetT, opts ...OptT) (*InverseSet, error) {
 
 	var (
+		o       = parseOpts(opts)
 		resets  []resetT
 		dupeMap map[int]int
 		nTerms  = len(setTerms)
 		dupes   = make(map[TermT]int, nTerms)
 		terms   = make([]termT, 0, nTerms)
+		src     = make([]TermT, 0, nTerms)
+		index   = make([]int, 0, nTerms)
 	)
 
 	switch {
@@ -50,12 +61,14 @@ func NewInverseSet(window int64, setTerms []TermT, resetTerms []ResetT) (*Invers
 
 		if cnt >= 1 {
 
-			m, err := term.NewMatcher()
+			m, err := o.newMatcher(term)
 			if err != nil {
 				return nil, err
 			}
 
 			terms = append(terms, termT{matcher: m})
+			src = append(src, term)
+			index = append(index, i)
 
 			if cnt > 1 {
 
@@ -71,15 +84,21 @@ func NewInverseSet(window int64, setTerms []TermT, resetTerms []ResetT) (*Invers
 		}
 	}
 
+	if correlate, err := installCaptures(terms, src, o.parseCache()); err != nil {
+		return nil, err
+	} else if correlate {
+		return nil, ErrCorrelateInverse
+	}
+
 	if len(resetTerms) > 0 {
 		resets = make([]resetT, 0, len(resetTerms))
 
 		for _, term := range resetTerms {
-			m, err := term.Term.NewMatcher()
+			m, err := o.newMatcher(term.Term)
 			switch {
 			case err != nil:
 				return nil, err
-			case int(term.Anchor) >= len(setTerms):
+			case term.Anchor < 0 || term.Anchor >= len(setTerms):
 				return nil, ErrAnchorRange
 			}
 
@@ -94,6 +113,11 @@ func NewInverseSet(window int64, setTerms []TermT, resetTerms []ResetT) (*Invers
 	}
 	gcLeft, gcRight := calcGCWindow(window, resets)
 
+	meta, err := newHitMeta(o, src, index)
+	if err != nil {
+		return nil, err
+	}
+
 	return &InverseSet{
 		window:  window,
 		gcLeft:  gcLeft,
@@ -102,16 +126,31 @@ func NewInverseSet(window int64, setTerms []TermT, resetTerms []ResetT) (*Invers
 		terms:   terms,
 		resets:  resets,
 		dupeMap: dupeMap,
+		meta:    meta,
+		trace:   newTracer(o, nTerms, index),
+		limit:   newLimit(o),
 	}, nil
 }
 
 func (r *InverseSet) Scan(e entry.LogEntry) (hits Hits) {
+	hits = r.scan(e)
+
+	// After firing, so that a complete frame is not broken up.
+	if r.limit.enabled() {
+		r.limit.enforce(r.terms, r.evicted)
+	}
+	return
+}
+
+func (r *InverseSet) scan(e entry.LogEntry) (hits Hits) {
+	r.trace.scan()
 	if e.Timestamp < r.clock {
 		log.Warn().
 			Str("line", e.Line).
 			Int64("stamp", e.Timestamp).
 			Int64("clock", r.clock).
 			Msg("InverseSet: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
 		return
 	}
 	r.clock = e.Timestamp
@@ -121,9 +160,12 @@ func (r *InverseSet) Scan(e entry.LogEntry) (hits Hits) {
 	// For a set, must scan all terms.
 	// Cannot short circuit like a sequence.
 	for i, term := range r.terms {
-		if term.matcher(e.Line) {
+		if term.matcher(e) {
+			r.trace.match(i)
+
 			// Append the match to the assert list
-			r.terms[i].asserts = append(r.terms[i].asserts, e)
+			r.terms[i].push(e)
+			r.trace.assert(r.clock, i, e)
 
 			// If not a dupe or we've hit the dupe count, set the hot mask
 			if dupeCnt, ok := r.dupeMap[i]; !ok || len(r.terms[i].asserts) >= dupeCnt {
@@ -142,8 +184,9 @@ func (r *InverseSet) Scan(e entry.LogEntry) (hits Hits) {
 
 	// Run resets
 	for i, reset := range r.resets {
-		if reset.matcher(e.Line) {
+		if reset.matcher(e) {
 			r.resets[i].resets = append(reset.resets, e.Timestamp)
+			r.trace.reset(r.clock, i, e)
 			r.resetGcMark(e.Timestamp + r.gcLeft + r.gcRight)
 		}
 	}
@@ -161,7 +204,10 @@ func (r *InverseSet) Eval(clock int64) (hits Hits) {
 
 	for r.hotMask.FirstN(nTerms) {
 
-		drop := anchorT{term: -1}
+		var (
+			drop   = anchorT{term: -1}
+			reason = DropWindow
+		)
 
 		// Cannot depend on GC to determine whether we are still in the window.
 		// This is because we might have an extended GC due to a long reset window.
@@ -175,6 +221,7 @@ func (r *InverseSet) Eval(clock int64) (hits Hits) {
 			switch {
 			case anchor.ValidTerm():
 				drop = anchor
+				reason = DropReset
 			case anchor.clock > 0:
 				// We have a match that is too recent; we must wait.
 				return
@@ -184,6 +231,7 @@ func (r *InverseSet) Eval(clock int64) (hits Hits) {
 		if drop.ValidTerm() {
 			// We have a negative match;
 			// remove the offending term assert and continue.
+			r.trace.drop(clock, reason, drop.term, 1)
 			if dupeCnt := r.dupeMap[drop.term]; dupeCnt <= 0 {
 				if shiftLeft(r.terms, drop.term, 1) == 0 {
 					r.hotMask.Clr(drop.term)
@@ -194,7 +242,6 @@ func (r *InverseSet) Eval(clock int64) (hits Hits) {
 
 		} else {
 			// Fire hit and prune first assert from each term.
-			hits.Cnt += 1
 			if hits.Logs == nil {
 				hits.Logs = make([]LogEntry, 0, nTerms)
 			}
@@ -204,11 +251,15 @@ func (r *InverseSet) Eval(clock int64) (hits Hits) {
 				if dupeCnt, ok := r.dupeMap[i]; ok {
 					cnt = dupeCnt
 				}
-				hits.Logs = append(hits.Logs, term.asserts[0:cnt]...)
+				for _, a := range term.asserts[0:cnt] {
+					r.meta.add(&hits, a.LogEntry, i)
+				}
 				if shiftLeft(r.terms, i, cnt) < cnt {
 					r.hotMask.Clr(i)
 				}
 			}
+			hits.closeFrame(r.window)
+			r.trace.hit(clock, hits)
 		}
 	}
 
@@ -338,6 +389,13 @@ func (r *InverseSet) frameMatch() (int, int64, int64) {
 	return minAnchor, tStart, tStop
 }
 
+func (r *InverseSet) evicted(idx, cnt int) {
+	r.trace.drop(r.clock, DropLimit, idx, cnt)
+	if len(r.terms[idx].asserts) < max(r.dupeMap[idx], 1) {
+		r.hotMask.Clr(idx)
+	}
+}
+
 func (r *InverseSet) maybeGC(clock int64) {
 
 	if clock < r.gcMark {
@@ -380,6 +438,7 @@ func (r *InverseSet) GarbageCollect(clock int64) {
 		}
 
 		if cnt > 0 {
+			r.trace.gc(clock, i, cnt)
 			if shiftLeft(r.terms, i, cnt) == 0 {
 				r.hotMask.Clr(i)
 			}
@@ -81,8 +81,8 @@ func checkHotMask[T any](mask int64) func(*testing.T, int, *T) {
 			panic("Invalid type")
 		}
 
-		if hotMask != bitMaskT(mask) {
-			t.Errorf("Step %v: Expected hotMask == %b, got %b", step, mask, hotMask)
+		if hotMask.lo != uint64(mask) || !(bitMaskT{hi: hotMask.hi}).Zeros() {
+			t.Errorf("Step %v: Expected hotMask == %b, got %b %b", step, mask, hotMask.lo, hotMask.hi)
 		}
 	}
 }
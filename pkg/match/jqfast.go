@@ -0,0 +1,422 @@
+package match
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prequel-dev/prequel-logmatch/internal/pkg/jsonscan"
+
+	"github.com/itchyny/gojq"
+)
+
+// A TermJqJsonFast term is a jq program evaluated against JSON lines like
+// TermJqJson, but common predicate shapes are evaluated directly on the raw
+// line without unmarshalling it:
+//
+//	.level                             path is neither null nor false
+//	.level == "error"                  ==, !=, <, <=, >, >= against a literal or path
+//	.req.path | contains("/api")       contains, startswith, endswith
+//	select(.status >= 500 and .retry)  select, and, or, parentheses
+//
+// Object key paths are supported; array indexing, iteration and every other
+// jq construct fall back to gojq for the whole program.  A line the fast path
+// cannot decide, eg. indexing into a number or comparing two objects, falls
+// back to gojq for that line only, so results always equal TermJqJson.
+
+// Result of a fast evaluation; ok is false if the line needs gojq.
+type fastEvalT func(vals []jsonscan.Value) (v fastValT, ok bool)
+
+type fastValT struct {
+	kind jsonscan.Kind
+	raw  string // Raw JSON text; empty for literals and results
+	num  float64
+	str  string
+}
+
+var (
+	fastTrue  = fastValT{kind: jsonscan.True}
+	fastFalse = fastValT{kind: jsonscan.False}
+)
+
+func fastBool(b bool) fastValT {
+	if b {
+		return fastTrue
+	}
+	return fastFalse
+}
+
+func (v fastValT) truthy() bool {
+	return v.kind != jsonscan.Null && v.kind != jsonscan.False
+}
+
+// Decode a number or string read from the line.
+func (v *fastValT) decode() bool {
+	if v.raw == "" {
+		return true
+	}
+
+	switch v.kind {
+	case jsonscan.Number:
+		f, err := strconv.ParseFloat(v.raw, 64)
+		if err != nil {
+			return false
+		}
+		v.num = f
+	case jsonscan.String:
+		s := v.raw[1 : len(v.raw)-1]
+		if strings.IndexByte(s, '\\') >= 0 || !utf8.ValidString(s) {
+			var ok bool
+			if s, ok = unquoteJson(v.raw); !ok {
+				return false
+			}
+		}
+		v.str = s
+	}
+
+	v.raw = ""
+	return true
+}
+
+// Rare; let encoding/json apply its escape and UTF-8 rules.
+func unquoteJson(raw string) (s string, ok bool) {
+	return s, json.Unmarshal([]byte(raw), &s) == nil
+}
+
+type fastCompilerT struct {
+	paths [][]string
+}
+
+// Compile q into a fast evaluation; returns nil if q has an unsupported shape.
+func compileJqFast(q *gojq.Query) (*jsonscan.Paths, fastEvalT) {
+	var (
+		c    fastCompilerT
+		eval fastEvalT
+	)
+
+	// A top level select yields the (truthy) root object or nothing.
+	if t := q.Term; q.Op == 0 && t != nil && t.Type == gojq.TermTypeFunc && len(t.SuffixList) == 0 &&
+		t.Func.Name == "select" && len(t.Func.Args) == 1 {
+		if pred := c.query(t.Func.Args[0]); pred != nil {
+			eval = func(vals []jsonscan.Value) (fastValT, bool) {
+				v, ok := pred(vals)
+				return fastBool(v.truthy()), ok
+			}
+		}
+	} else {
+		eval = c.query(q)
+	}
+
+	if eval == nil {
+		return nil, nil
+	}
+
+	return jsonscan.Compile(c.paths), eval
+}
+
+func (c *fastCompilerT) query(q *gojq.Query) fastEvalT {
+	if q.Func != "" {
+		return nil
+	}
+
+	switch q.Op {
+	case 0:
+		return c.term(q.Term)
+	case gojq.OpAnd, gojq.OpOr:
+		return c.logical(q)
+	case gojq.OpEq, gojq.OpNe, gojq.OpLt, gojq.OpLe, gojq.OpGt, gojq.OpGe:
+		return c.compare(q)
+	case gojq.OpPipe:
+		return c.strFunc(q)
+	}
+
+	return nil
+}
+
+func (c *fastCompilerT) logical(q *gojq.Query) fastEvalT {
+	lhs, rhs := c.query(q.Left), c.query(q.Right)
+	if lhs == nil || rhs == nil {
+		return nil
+	}
+
+	// Both short circuit, as in jq.
+	if q.Op == gojq.OpAnd {
+		return func(vals []jsonscan.Value) (fastValT, bool) {
+			if l, ok := lhs(vals); !ok || !l.truthy() {
+				return fastFalse, ok
+			}
+			r, ok := rhs(vals)
+			return fastBool(r.truthy()), ok
+		}
+	}
+
+	return func(vals []jsonscan.Value) (fastValT, bool) {
+		if l, ok := lhs(vals); !ok || l.truthy() {
+			return fastTrue, ok
+		}
+		r, ok := rhs(vals)
+		return fastBool(r.truthy()), ok
+	}
+}
+
+func (c *fastCompilerT) compare(q *gojq.Query) fastEvalT {
+	lhs, rhs := c.query(q.Left), c.query(q.Right)
+	if lhs == nil || rhs == nil {
+		return nil
+	}
+
+	op := q.Op
+	return func(vals []jsonscan.Value) (fastValT, bool) {
+		l, ok := lhs(vals)
+		if !ok {
+			return fastValT{}, false
+		}
+		r, ok := rhs(vals)
+		if !ok {
+			return fastValT{}, false
+		}
+		cmp, ok := fastCompare(l, r)
+		if !ok {
+			return fastValT{}, false
+		}
+
+		switch op {
+		case gojq.OpEq:
+			return fastBool(cmp == 0), true
+		case gojq.OpNe:
+			return fastBool(cmp != 0), true
+		case gojq.OpLt:
+			return fastBool(cmp < 0), true
+		case gojq.OpLe:
+			return fastBool(cmp <= 0), true
+		case gojq.OpGt:
+			return fastBool(cmp > 0), true
+		default:
+			return fastBool(cmp >= 0), true
+		}
+	}
+}
+
+// Compare in jq order; values of different kinds order by kind.
+func fastCompare(l, r fastValT) (int, bool) {
+	if l.kind != r.kind {
+		if l.kind < r.kind {
+			return -1, true
+		}
+		return 1, true
+	}
+
+	switch l.kind {
+	case jsonscan.Number:
+		if !l.decode() || !r.decode() {
+			return 0, false
+		}
+		switch {
+		case l.num < r.num:
+			return -1, true
+		case l.num > r.num:
+			return 1, true
+		}
+		return 0, true
+	case jsonscan.String:
+		if !l.decode() || !r.decode() {
+			return 0, false
+		}
+		return strings.Compare(l.str, r.str), true
+	case jsonscan.Array, jsonscan.Object:
+		// Deep comparison is left to gojq.
+		return 0, false
+	}
+
+	return 0, true
+}
+
+// A path piped into contains, startswith or endswith with a literal argument.
+func (c *fastCompilerT) strFunc(q *gojq.Query) fastEvalT {
+	lhs := c.query(q.Left)
+	if lhs == nil {
+		return nil
+	}
+
+	t := q.Right.Term
+	if q.Right.Op != 0 || t == nil || t.Type != gojq.TermTypeFunc || len(t.SuffixList) != 0 || len(t.Func.Args) != 1 {
+		return nil
+	}
+
+	arg, ok := literal(t.Func.Args[0])
+	if !ok || arg.kind != jsonscan.String {
+		return nil
+	}
+
+	var f func(s, substr string) bool
+	switch t.Func.Name {
+	case "contains":
+		f = strings.Contains
+	case "startswith":
+		f = strings.HasPrefix
+	case "endswith":
+		f = strings.HasSuffix
+	default:
+		return nil
+	}
+
+	return func(vals []jsonscan.Value) (fastValT, bool) {
+		v, ok := lhs(vals)
+		if !ok || v.kind != jsonscan.String || !v.decode() {
+			// jq raises an error on anything but a string.
+			return fastValT{}, false
+		}
+		return fastBool(f(v.str, arg.str)), true
+	}
+}
+
+func (c *fastCompilerT) term(t *gojq.Term) fastEvalT {
+	if t == nil {
+		return nil
+	}
+
+	switch t.Type {
+	case gojq.TermTypeQuery:
+		if len(t.SuffixList) != 0 {
+			return nil
+		}
+		return c.query(t.Query)
+	case gojq.TermTypeIndex:
+		return c.path(t)
+	}
+
+	v, ok := literal(&gojq.Query{Term: t})
+	if !ok {
+		return nil
+	}
+	return func([]jsonscan.Value) (fastValT, bool) {
+		return v, true
+	}
+}
+
+// An object key path, eg. .a.b or .a["b c"].
+func (c *fastCompilerT) path(t *gojq.Term) fastEvalT {
+	key, ok := indexKey(t.Index)
+	if !ok {
+		return nil
+	}
+
+	path := []string{key}
+	for _, s := range t.SuffixList {
+		if s.Index == nil || s.Iter || s.Optional || s.Bind != nil {
+			return nil
+		}
+		if key, ok = indexKey(s.Index); !ok {
+			return nil
+		}
+		path = append(path, key)
+	}
+
+	id := len(c.paths)
+	c.paths = append(c.paths, path)
+
+	return func(vals []jsonscan.Value) (fastValT, bool) {
+		switch v := vals[id]; v.Kind {
+		case jsonscan.Missing:
+			return fastValT{kind: jsonscan.Null}, true
+		case jsonscan.Mismatch:
+			return fastValT{}, false
+		default:
+			return fastValT{kind: v.Kind, raw: v.Raw}, true
+		}
+	}
+}
+
+func indexKey(idx *gojq.Index) (string, bool) {
+	switch {
+	case idx == nil || idx.IsSlice || idx.End != nil:
+		return "", false
+	case idx.Name != "":
+		return idx.Name, true
+	case idx.Str != nil:
+		return literalString(idx.Str)
+	case idx.Start != nil:
+		if v, ok := literal(idx.Start); ok && v.kind == jsonscan.String {
+			return v.str, true
+		}
+	}
+	return "", false
+}
+
+func literalString(s *gojq.String) (string, bool) {
+	if len(s.Queries) != 0 {
+		return "", false
+	}
+	return s.Str, true
+}
+
+// A constant null, boolean, number or string.
+func literal(q *gojq.Query) (fastValT, bool) {
+	if q.Op != 0 || q.Func != "" || q.Term == nil || len(q.Term.SuffixList) != 0 {
+		return fastValT{}, false
+	}
+
+	switch t := q.Term; t.Type {
+	case gojq.TermTypeNull:
+		return fastValT{kind: jsonscan.Null}, true
+	case gojq.TermTypeTrue:
+		return fastTrue, true
+	case gojq.TermTypeFalse:
+		return fastFalse, true
+	case gojq.TermTypeString:
+		if s, ok := literalString(t.Str); ok {
+			return fastValT{kind: jsonscan.String, str: s}, true
+		}
+	case gojq.TermTypeNumber:
+		return literalNumber(t.Number, false)
+	case gojq.TermTypeUnary:
+		if u := t.Unary; u.Op == gojq.OpSub && u.Term.Type == gojq.TermTypeNumber && len(u.Term.SuffixList) == 0 {
+			return literalNumber(u.Term.Number, true)
+		}
+	case gojq.TermTypeQuery:
+		return literal(t.Query)
+	}
+
+	return fastValT{}, false
+}
+
+// Numbers that gojq would not hold as an exact float64 are not supported.
+func literalNumber(s string, neg bool) (fastValT, bool) {
+	mant, _, _ := strings.Cut(strings.ToLower(s), "e")
+	if digits := strings.TrimLeft(strings.Replace(mant, ".", "", 1), "0"); len(digits) > 15 {
+		return fastValT{}, false
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fastValT{}, false
+	}
+	if neg {
+		f = -f
+	}
+	return fastValT{kind: jsonscan.Number, num: f}, true
+}
+
+// Wrap the gojq matcher for q with the fast path, if q has a supported shape.
+func makeJqFastMatch(q *gojq.Query, slow MatchFunc) MatchFunc {
+	paths, eval := compileJqFast(q)
+	if eval == nil {
+		return slow
+	}
+
+	vals := make([]jsonscan.Value, paths.Len())
+
+	return func(line string) bool {
+		switch err := paths.Scan(line, vals); err {
+		case nil:
+			if v, ok := eval(vals); ok {
+				return v.truthy()
+			}
+		case jsonscan.ErrSyntax:
+			// gojq would fail to unmarshal the line too.
+			return false
+		}
+		return slow(line)
+	}
+}
@@ -0,0 +1,191 @@
+package match
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestJqFastShapes(t *testing.T) {
+	var tests = map[string]bool{
+		`.level`:                               true,
+		`.level == "error"`:                    true,
+		`"error" != .level`:                    true,
+		`.a.b["c d"] >= -1.5`:                  true,
+		`.a."b"`:                               true,
+		`.status >= 500 and (.retry or .x)`:    true,
+		`select(.level == "error")`:            true,
+		`.msg | contains("timeout")`:           true,
+		`.msg | startswith("a") or .b == null`: false, // Pipe binds loosest
+		`.a == .b`:                             true,
+		`.a[0]`:                                false,
+		`.a[]`:                                 false,
+		`.a?`:                                  false,
+		`.`:                                    false,
+		`.a | length > 2`:                      false,
+		`.msg | test("x")`:                     false,
+		`.a == 12345678901234567890`:           false,
+		`.a == "\(.b)"`:                        false,
+		`select(.a) | .b`:                      false,
+		`.a == [1]`:                            false,
+		`.a + 1 > 2`:                           false,
+	}
+
+	for program, fast := range tests {
+		t.Run(program, func(t *testing.T) {
+			q, err := gojq.Parse(program)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+			if _, eval := compileJqFast(q); (eval != nil) != fast {
+				t.Errorf("Expected fast %v, got %v", fast, eval != nil)
+			}
+		})
+	}
+}
+
+// TermJqJsonFast must produce exactly the same results as TermJqJson.
+func TestJqFastEquivalence(t *testing.T) {
+	var (
+		rng      = rand.New(rand.NewSource(11))
+		programs = []string{
+			`.level`,
+			`.level == "error"`,
+			`.level != "error"`,
+			`.level < "info"`,
+			`.code == 500`,
+			`.code > 499.5`,
+			`.code <= -1`,
+			`.code == null`,
+			`.code == true`,
+			`.req.path`,
+			`.req.path == "/api"`,
+			`.req.path | contains("api")`,
+			`.req.path | startswith("/")`,
+			`.msg | endswith("é")`,
+			`.req.id == .code`,
+			`.req == .level`,
+			`select(.code >= 500 and .level == "error")`,
+			`select(.req.path) or .msg`,
+			`.level == "error" or .req.path.x`,
+			`.missing.deep == null`,
+			`(.code > 1) and (.code < 1000)`,
+			`.code | contains("1")`,
+			`.msg == "a\"b"`,
+		}
+		values = []string{
+			`null`, `true`, `false`, `0`, `500`, `-1`, `499.5`, `1e3`, `-0.0`,
+			`12345678901234567890`, `"error"`, `"info"`, `"/api"`, `"/api/v1"`, `"api"`,
+			`"a\"b"`, `"é"`, `"café"`, `"café"`, "\"\xff\"", `""`,
+			`[]`, `[1, "a"]`, `{}`, `{"path": "/api"}`, `{"path": null}`, `{"path": 5, "x": 1}`,
+		}
+		keys = []string{"level", "code", "req", "msg", "id", "path", "x"}
+	)
+
+	var value func(depth int) string
+	value = func(depth int) string {
+		if depth < 2 && rng.Intn(4) == 0 {
+			var fields []string
+			for range rng.Intn(4) {
+				fields = append(fields, fmt.Sprintf("%q: %s", keys[rng.Intn(len(keys))], value(depth+1)))
+			}
+			return "{" + strings.Join(fields, ", ") + "}"
+		}
+		return values[rng.Intn(len(values))]
+	}
+
+	type pairT struct {
+		program    string
+		fast, slow MatchFunc
+	}
+
+	var pairs []pairT
+	for _, program := range programs {
+		fast, err := TermT{Type: TermJqJsonFast, Value: program}.NewMatcher()
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		slow, err := TermT{Type: TermJqJson, Value: program}.NewMatcher()
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		pairs = append(pairs, pairT{program, fast, slow})
+	}
+
+	lines := []string{"not json", `{"level": "error"`, `["level"]`, `"error"`, `{"level": 1e400}`}
+	for range 3000 {
+		lines = append(lines, value(0))
+	}
+
+	for _, line := range lines {
+		for _, p := range pairs {
+			if got, want := p.fast(line), p.slow(line); got != want {
+				t.Fatalf("Program %q on line %q: expected %v, got %v", p.program, line, want, got)
+			}
+		}
+	}
+}
+
+func TestJqFastRule(t *testing.T) {
+	sm, err := NewMatchSeq(10,
+		TermT{Type: TermJqJsonFast, Value: `.level == "error"`},
+		TermT{Type: TermJqJsonFast, Value: `.msg | contains("giving up")`},
+	)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: `{"level": "error", "msg": "timeout"}`})
+	if hits := sm.Scan(LogEntry{Timestamp: 2, Line: `{"level": "warn", "msg": "giving up now"}`}); hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit, got %v", hits.Cnt)
+	}
+}
+
+func makeLargeJsonLine() string {
+	var sb strings.Builder
+	sb.WriteString(`{"ts": "2024-01-01T00:00:00Z", "attrs": {`)
+	for i := range 200 {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `"attr%d": {"value": %d, "tags": ["a", "b", "c"], "note": "some text here"}`, i, i)
+	}
+	sb.WriteString(`}, "level": "info", "status": 200, "msg": "request served"}`)
+	return sb.String()
+}
+
+func benchmarkJq(b *testing.B, typ TermTypeT, program string) {
+	m, err := TermT{Type: typ, Value: program}.NewMatcher()
+	if err != nil {
+		b.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// Alternate lines to defeat the unmarshal memo.
+	lines := []string{makeLargeJsonLine(), makeLargeJsonLine() + " "}
+
+	b.SetBytes(int64(len(lines[0])))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m(lines[i&1])
+	}
+}
+
+func BenchmarkJqJsonEq(b *testing.B) {
+	benchmarkJq(b, TermJqJson, `.level == "error"`)
+}
+
+func BenchmarkJqJsonFastEq(b *testing.B) {
+	benchmarkJq(b, TermJqJsonFast, `.level == "error"`)
+}
+
+func BenchmarkJqJsonSelect(b *testing.B) {
+	benchmarkJq(b, TermJqJson, `select(.status >= 500 and (.msg | contains("timeout")))`)
+}
+
+func BenchmarkJqJsonFastSelect(b *testing.B) {
+	benchmarkJq(b, TermJqJsonFast, `select(.status >= 500 and (.msg | contains("timeout")))`)
+}
@@ -0,0 +1,127 @@
+package match
+
+// A noisy term can buffer an unbounded number of asserts within a long
+// window.  WithMaxAsserts and WithMemoryLimit cap the asserts buffered by a
+// MatchSet or InverseSet; when a scan leaves the matcher over either cap,
+// after any hit has fired, asserts are evicted from the term holding the
+// most until it fits again.  WithEviction picks which asserts of that term
+// go.  Evictions are counted in Stats.DropLimit and traced as DropLimit.
+// Evicting asserts that are still inside the window trades missed or
+// shifted frames for bounded memory; size the caps well above the asserts
+// a frame needs.
+
+type EvictT uint8
+
+const (
+	EvictOldest   EvictT = iota // Drop the oldest assert
+	EvictKeepEnds               // Keep the oldest and newest asserts; drop the second oldest
+	EvictSample                 // Drop every other assert, keeping the oldest and newest
+)
+
+func (p EvictT) String() string {
+	switch p {
+	case EvictOldest:
+		return "oldest"
+	case EvictKeepEnds:
+		return "keepEnds"
+	case EvictSample:
+		return "sample"
+	default:
+		return "unknown"
+	}
+}
+
+type limitT struct {
+	maxAsserts int // Zero if unlimited
+	maxBytes   int // Zero if unlimited
+	policy     EvictT
+}
+
+func newLimit(o optsT) limitT {
+	return limitT{
+		maxAsserts: max(o.maxAsserts, 0),
+		maxBytes:   max(o.memLimit, 0),
+		policy:     o.eviction,
+	}
+}
+
+func (l limitT) enabled() bool {
+	return l.maxAsserts > 0 || l.maxBytes > 0
+}
+
+// Evict asserts until terms fit in the limit; calls evicted with the term
+// index and count for each eviction.
+func (l limitT) enforce(terms []termT, evicted func(idx, cnt int)) {
+	if !l.enabled() {
+		return
+	}
+
+	var nAsserts, nBytes int
+	for _, t := range terms {
+		nAsserts += len(t.asserts)
+		nBytes += t.bytes
+	}
+
+	for {
+		overAsserts := l.maxAsserts > 0 && nAsserts > l.maxAsserts
+		overBytes := l.maxBytes > 0 && nBytes > l.maxBytes
+		if !overAsserts && !overBytes {
+			return
+		}
+
+		// Victim is the term holding the most; by bytes if over the memory limit.
+		victim := 0
+		for i, t := range terms {
+			if overBytes && t.bytes > terms[victim].bytes ||
+				!overBytes && len(t.asserts) > len(terms[victim].asserts) {
+				victim = i
+			}
+		}
+
+		var (
+			t     = &terms[victim]
+			cnt   = len(t.asserts)
+			bytes = t.bytes
+		)
+
+		if cnt == 0 {
+			// Should not happen; the totals say otherwise.
+			return
+		}
+
+		l.evict(terms, victim)
+
+		cnt -= len(t.asserts)
+		nAsserts -= cnt
+		nBytes -= bytes - t.bytes
+		evicted(victim, cnt)
+	}
+}
+
+func (l limitT) evict(terms []termT, idx int) {
+	m := terms[idx].asserts
+
+	switch {
+	case len(m) <= 2 || l.policy == EvictOldest:
+		shiftLeft(terms, idx, 1)
+
+	case l.policy == EvictKeepEnds:
+		removeAssert(terms, idx, 1)
+
+	default:
+		var (
+			n    int
+			last = len(m) - 1
+		)
+		for i := 0; i < last; i += 2 {
+			m[n] = m[i]
+			n++
+		}
+		m[n] = m[last]
+		n++
+
+		clear(m[n:])
+		terms[idx].asserts = m[:n]
+		terms[idx].bytes = assertBytes(m[:n])
+	}
+}
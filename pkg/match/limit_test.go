@@ -0,0 +1,168 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func bufferedStamps(terms []termT, idx int) (stamps []int64) {
+	for _, a := range terms[idx].asserts {
+		stamps = append(stamps, a.Timestamp)
+	}
+	return
+}
+
+func TestLimitSetPolicies(t *testing.T) {
+	tests := map[string]struct {
+		policy EvictT
+		want   []int64 // healthz stamps buffered after 1..8
+		first  int64   // healthz stamp in the hit frame
+	}{
+		"oldest":   {policy: EvictOldest, want: []int64{5, 6, 7, 8}, first: 5},
+		"keepEnds": {policy: EvictKeepEnds, want: []int64{1, 6, 7, 8}, first: 1},
+		"sample":   {policy: EvictSample, want: []int64{1, 5, 7, 8}, first: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSetOpts(100, makeTermsA("healthz", "error"), WithMaxAsserts(4), WithEviction(tc.policy))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			for i := range 8 {
+				sm.Scan(LogEntry{Timestamp: int64(i + 1), Line: "GET /healthz"})
+			}
+
+			if got := bufferedStamps(sm.terms, 0); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected buffered %v, got %v", tc.want, got)
+			}
+
+			st := sm.Stats()
+			if st.DropLimit != 4 || st.Asserts != 4 {
+				t.Errorf("Expected 4 evicted and 4 buffered, got %+v", st)
+			}
+
+			hits := sm.Scan(LogEntry{Timestamp: 9, Line: "error"})
+			if hits.Cnt != 1 || hits.Logs[0].Timestamp != tc.first {
+				t.Errorf("Expected hit on healthz %v, got %v", tc.first, hits)
+			}
+		})
+	}
+}
+
+func TestLimitSetDupes(t *testing.T) {
+	var tl traceLogT
+	sm, err := NewMatchSetOpts(100, makeTermsA("alpha", "alpha", "alpha", "beta"), WithMaxAsserts(2), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// The cap is below the frame size; the dupe term never turns hot.
+	for i := range 3 {
+		sm.Scan(LogEntry{Timestamp: int64(i + 1), Line: "alpha"})
+	}
+	if hits := sm.Scan(LogEntry{Timestamp: 4, Line: "beta"}); hits.Cnt != 0 {
+		t.Errorf("Expected no hit, got %v", hits)
+	}
+
+	tl.check(t,
+		"assert:0:0:alpha",
+		"assert:0:0:alpha",
+		"assert:0:0:alpha",
+		"drop:0:1:limit",
+		"assert:3:0:beta",
+		"drop:0:1:limit",
+	)
+}
+
+func TestLimitMemory(t *testing.T) {
+	var (
+		big   = LogEntry{Line: "error " + string(make([]byte, 100))}
+		small = LogEntry{Line: "error"}
+		limit = big.Size() + 2*small.Size()
+	)
+
+	sm, err := NewMatchSetOpts(100, makeTermsA("error", "done"), WithMemoryLimit(limit))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	big.Timestamp, small.Timestamp = 1, 2
+	sm.Scan(big)
+	sm.Scan(small)
+	small.Timestamp = 3
+	sm.Scan(small)
+	if st := sm.Stats(); st.DropLimit != 0 || st.Bytes != limit {
+		t.Fatalf("Expected to fit, got %+v", st)
+	}
+
+	small.Timestamp = 4
+	sm.Scan(small)
+	if st := sm.Stats(); st.DropLimit != 1 || st.Bytes > limit {
+		t.Fatalf("Expected oldest evicted, got %+v", st)
+	}
+	if got := bufferedStamps(sm.terms, 0); !reflect.DeepEqual(got, []int64{2, 3, 4}) {
+		t.Errorf("Expected [2 3 4], got %v", got)
+	}
+}
+
+func TestLimitInverseSet(t *testing.T) {
+	is, err := NewInverseSetOpts(100, makeTermsA("healthz", "error"), []ResetT{
+		{Term: makeRaw("reset")},
+	}, WithMaxAsserts(3))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	for i := range 10 {
+		is.Scan(LogEntry{Timestamp: int64(i + 1), Line: "GET /healthz"})
+	}
+
+	if st := is.Stats(); st.DropLimit != 7 || st.Asserts != 3 {
+		t.Errorf("Expected 7 evicted, got %+v", st)
+	}
+
+	is.Scan(LogEntry{Timestamp: 11, Line: "error"})
+	hits := is.Eval(200)
+	if hits.Cnt != 1 || hits.Logs[0].Timestamp != 9 {
+		t.Errorf("Expected hit on healthz 9, got %v", hits)
+	}
+}
+
+// The byte estimate of each term must track its asserts through every
+// path that removes them.
+func TestLimitBytesInvariant(t *testing.T) {
+	var (
+		lines = []string{"alpha", "beta", "alpha", "reset", "gamma", "beta", "alpha", "gamma", "noise", "beta"}
+		check = func(t *testing.T, step int, terms []termT) {
+			t.Helper()
+			for i, term := range terms {
+				if want := assertBytes(term.asserts); term.bytes != want {
+					t.Fatalf("Step %d term %d: expected %d bytes, got %d", step, i, want, term.bytes)
+				}
+			}
+		}
+	)
+
+	seq, _ := NewMatchSeq(4, makeTermsA("alpha", "beta", "alpha", "gamma")...)
+	set, _ := NewMatchSetOpts(4, makeTermsA("alpha", "beta", "gamma"), WithMaxAsserts(3), WithEviction(EvictSample))
+	iseq, _ := NewInverseSeq(4, makeTermsA("alpha", "beta"), []ResetT{{Term: makeRaw("reset"), Window: 1}})
+	iset, _ := NewInverseSetOpts(4, makeTermsA("alpha", "beta", "beta"), []ResetT{{Term: makeRaw("reset")}}, WithEviction(EvictKeepEnds))
+	cseq, _ := NewMatchSeq(4, captureTerm(`(?P<x>a)lpha`), captureTerm(`(?P<x>a)`))
+
+	for step := range 60 {
+		e := LogEntry{Timestamp: int64(step), Line: lines[step%len(lines)] + " alpha"[:step%2*6]}
+		seq.Scan(e)
+		set.Scan(e)
+		iseq.Scan(e)
+		iset.Scan(e)
+		cseq.Scan(e)
+
+		check(t, step, seq.terms)
+		check(t, step, set.terms)
+		check(t, step, iseq.terms)
+		check(t, step, iset.terms)
+		check(t, step, cseq.terms)
+	}
+}
@@ -1,28 +1,89 @@
 package match
 
-type bitMaskT uint64
+// bitMaskT is a bitset of arbitrary width.  The first 64 slots are stored
+// inline, so the common case of 64 terms or fewer does not allocate.  Slots
+// beyond 64 spill into hi, which grows on demand.
+
+type bitMaskT struct {
+	lo uint64
+	hi []uint64
+}
+
+const wordBits = 64
 
 func (m *bitMaskT) Set(slot int) {
-	*m |= (1 << uint64(slot))
+	if slot < wordBits {
+		m.lo |= 1 << uint64(slot)
+		return
+	}
+
+	w, b := slot/wordBits-1, slot%wordBits
+	if w >= len(m.hi) {
+		m.hi = append(m.hi, make([]uint64, w-len(m.hi)+1)...)
+	}
+	m.hi[w] |= 1 << uint64(b)
 }
 
 func (m *bitMaskT) Clr(slot int) {
-	*m &= ^(1 << uint64(slot))
+	if slot < wordBits {
+		m.lo &= ^(1 << uint64(slot))
+		return
+	}
+
+	if w, b := slot/wordBits-1, slot%wordBits; w < len(m.hi) {
+		m.hi[w] &= ^(1 << uint64(b))
+	}
 }
 
 func (m *bitMaskT) Reset() {
-	*m = 0
+	m.lo = 0
+	clear(m.hi)
 }
 
 func (m bitMaskT) Zeros() bool {
-	return m == 0
+	if m.lo != 0 {
+		return false
+	}
+	for _, w := range m.hi {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
 }
 
+// Returns true if the first n slots are set.
 func (m bitMaskT) FirstN(n int) bool {
-	mask := bitMaskT(1)<<n - 1
-	return m&mask == mask
+	if n <= wordBits {
+		mask := uint64(1)<<n - 1
+		return m.lo&mask == mask
+	}
+
+	if m.lo != ^uint64(0) {
+		return false
+	}
+
+	n -= wordBits
+	for _, w := range m.hi {
+		if n <= wordBits {
+			mask := uint64(1)<<n - 1
+			return w&mask == mask
+		}
+		if w != ^uint64(0) {
+			return false
+		}
+		n -= wordBits
+	}
+
+	// Ran out of words before n slots
+	return false
 }
 
 func (m bitMaskT) IsSet(slot int) bool {
-	return (m & bitMaskT(1<<slot)) != 0
+	if slot < wordBits {
+		return (m.lo & (1 << uint64(slot))) != 0
+	}
+
+	w, b := slot/wordBits-1, slot%wordBits
+	return w < len(m.hi) && (m.hi[w]&(1<<uint64(b))) != 0
 }
@@ -0,0 +1,183 @@
+package match
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBitMask(t *testing.T) {
+	for _, width := range []int{1, 63, 64, 65, 80, 128, 129, 200} {
+		t.Run(fmt.Sprintf("Width%d", width), func(t *testing.T) {
+			var m bitMaskT
+
+			if !m.Zeros() {
+				t.Fatalf("Expected zeros on empty mask")
+			}
+
+			for i := range width {
+				if m.FirstN(width) {
+					t.Fatalf("Expected !FirstN(%v) with %v slots set", width, i)
+				}
+				m.Set(i)
+				if !m.IsSet(i) {
+					t.Fatalf("Expected slot %v set", i)
+				}
+				if !m.FirstN(i + 1) {
+					t.Fatalf("Expected FirstN(%v)", i+1)
+				}
+			}
+
+			if !m.FirstN(width) {
+				t.Fatalf("Expected FirstN(%v)", width)
+			}
+			if m.FirstN(width + 1) {
+				t.Fatalf("Expected !FirstN(%v)", width+1)
+			}
+
+			last := width - 1
+			m.Clr(last)
+			if m.IsSet(last) || m.FirstN(width) || !m.FirstN(last) {
+				t.Fatalf("Expected slot %v clear", last)
+			}
+
+			// Clear beyond the allocated width is a noop.
+			m.Clr(width + 1000)
+			if m.IsSet(width + 1000) {
+				t.Fatalf("Expected slot %v clear", width+1000)
+			}
+
+			m.Reset()
+			if !m.Zeros() {
+				t.Fatalf("Expected zeros after reset")
+			}
+		})
+	}
+}
+
+func TestBitMaskSparse(t *testing.T) {
+	var m bitMaskT
+	m.Set(130)
+
+	if m.Zeros() {
+		t.Fatalf("Expected non-zero mask")
+	}
+	if m.lo != 0 || len(m.hi) != 2 {
+		t.Fatalf("Expected spill into second word, got %b %v", m.lo, m.hi)
+	}
+
+	m.Clr(130)
+	if !m.Zeros() {
+		t.Fatalf("Expected zeros after clear")
+	}
+}
+
+func makeWideTerms(n int) []TermT {
+	terms := make([]TermT, n)
+	for i := range n {
+		terms[i] = makeRaw(fmt.Sprintf("term %03d;", i))
+	}
+	return terms
+}
+
+// Matchers must behave identically on either side of the 64 term fast path.
+func TestWideTerms(t *testing.T) {
+	tests := map[string]struct {
+		inverse bool
+		set     bool
+	}{
+		"MatchSeq":   {},
+		"MatchSet":   {set: true},
+		"InverseSeq": {inverse: true},
+		"InverseSet": {inverse: true, set: true},
+	}
+
+	for name, tc := range tests {
+		for _, width := range []int{63, 64, 65, 80, 200} {
+			t.Run(fmt.Sprintf("%s/%d", name, width), func(t *testing.T) {
+				var (
+					sm  Matcher
+					err error
+				)
+				switch {
+				case tc.inverse && tc.set:
+					sm, err = NewInverseSet(10000, makeWideTerms(width), nil)
+				case tc.inverse:
+					sm, err = NewInverseSeq(10000, makeWideTerms(width), nil)
+				case tc.set:
+					sm, err = NewMatchSet(10000, makeWideTerms(width)...)
+				default:
+					sm, err = NewMatchSeq(10000, makeWideTerms(width)...)
+				}
+				if err != nil {
+					t.Fatalf("Expected err == nil, got %v", err)
+				}
+
+				var clock int64
+				scan := func(i int) Hits {
+					clock += 1
+					return sm.Scan(LogEntry{Timestamp: clock, Line: fmt.Sprintf("term %03d;", i)})
+				}
+
+				// Two passes to verify state is clean after a fire.
+				for pass := range 2 {
+					for i := range width - 1 {
+						if hits := scan(i); hits.Cnt != 0 {
+							t.Fatalf("Pass %v: Expected no fire on term %v", pass, i)
+						}
+					}
+
+					hits := scan(width - 1)
+					if hits.Cnt != 1 || len(hits.Logs) != width {
+						t.Fatalf("Pass %v: Expected 1 hit with %v logs, got %v %v", pass, width, hits.Cnt, len(hits.Logs))
+					}
+					for i, e := range hits.Logs {
+						if e.Line != fmt.Sprintf("term %03d;", i) {
+							t.Fatalf("Pass %v: Expected term %v at %v, got %q", pass, i, i, e.Line)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWideDupes(t *testing.T) {
+	// Duplicate terms straddle the 64 term boundary.
+	for _, width := range []int{64, 65, 80} {
+		t.Run(fmt.Sprintf("%d", width), func(t *testing.T) {
+			terms := makeWideTerms(width)
+			terms[width-1] = terms[0]
+
+			seq, err := NewMatchSeq(10000, terms...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+			if !seq.dupeMask.IsSet(0) || !seq.dupeMask.IsSet(width-1) {
+				t.Fatalf("Expected dupe mask on 0 and %v", width-1)
+			}
+
+			set, err := NewMatchSet(10000, terms...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			for i := range width - 1 {
+				e := LogEntry{Timestamp: int64(i + 1), Line: terms[i].Value}
+				if hits := seq.Scan(e); hits.Cnt != 0 {
+					t.Fatalf("Expected no seq fire on term %v", i)
+				}
+				if hits := set.Scan(e); hits.Cnt != 0 {
+					t.Fatalf("Expected no set fire on term %v", i)
+				}
+			}
+
+			e := LogEntry{Timestamp: int64(width), Line: terms[0].Value}
+			if hits := seq.Scan(e); hits.Cnt != 1 {
+				t.Errorf("Expected seq fire, got %v", hits.Cnt)
+			}
+			if hits := set.Scan(e); hits.Cnt != 1 {
+				t.Errorf("Expected set fire, got %v", hits.Cnt)
+			}
+		})
+	}
+}
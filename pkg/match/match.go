@@ -24,6 +24,7 @@ type Matcher interface {
 	Eval(int64) Hits
 	Scan(e entry.LogEntry) Hits
 	GarbageCollect(int64)
+	Stats() Stats
 }
 
 type LogEntry = entry.LogEntry
@@ -35,6 +36,8 @@ const (
 	TermRegex
 	TermJqJson
 	TermJqYaml
+	TermExpr       // Boolean expression over other term types; see expr.go
+	TermJqJsonFast // Like TermJqJson, without unmarshalling common predicates; see jqfast.go
 )
 
 func (t TermTypeT) String() string {
@@ -47,34 +50,91 @@ func (t TermTypeT) String() string {
 		return "jqYaml"
 	case TermRegex:
 		return "regex"
+	case TermExpr:
+		return "expr"
+	case TermJqJsonFast:
+		return "jqJsonFast"
 	default:
 		return "unknown"
 	}
 }
 
 type TermT struct {
-	Type  TermTypeT
-	Value string
+	Type    TermTypeT
+	Value   string
+	Extract string // Optional jq program yielding an object of fields to correlate on; jq terms only.
+	Stream  string // Optional; restrict the term to entries on this stream, eg. "stderr".
+	Capture bool   // Optional; correlate on the named groups of the regex; regex terms only.
 }
 
 type MatchFunc func(string) bool
 
-func (tt TermT) NewMatcher() (m MatchFunc, err error) {
+// EntryMatchFunc matches on the entire LogEntry, including its stream.
+type EntryMatchFunc func(LogEntry) bool
+
+// NewEntryMatcher compiles the term into a match on the entire LogEntry.
+// Unlike NewMatcher, the resulting function honors TermT.Stream.
+func (tt TermT) NewEntryMatcher() (EntryMatchFunc, error) {
+	m, err := tt.NewMatcher()
+	if err != nil {
+		return nil, err
+	}
+	return entryMatcher(m, tt.Stream), nil
+}
+
+// Wrap a line match with the stream constraint, if any.
+func entryMatcher(m MatchFunc, stream string) EntryMatchFunc {
+	if stream == "" {
+		return func(e LogEntry) bool {
+			return m(e.Line)
+		}
+	}
+
+	// Check the stream first; it is cheaper than the line match.
+	return func(e LogEntry) bool {
+		return e.Stream == stream && m(e.Line)
+	}
+}
+
+func (tt TermT) NewMatcher() (MatchFunc, error) {
+	return tt.compile(nil)
+}
+
+// Compile the term; jq terms decode lines through pc, which may be nil.
+func (tt TermT) compile(pc *parseCacheT) (m MatchFunc, err error) {
 
 	if tt.Value == "" {
 		err = ErrTermEmpty
 		return
 	}
 
+	if tt.Capture && tt.Type != TermRegex {
+		err = ErrTermCapture
+		return
+	}
+
+	if tt.Extract != "" {
+		if _, err = makeJqCapture(tt, nil); err == ErrTermExtract {
+			return
+		} else if err != nil {
+			err = fmt.Errorf("%w type:'%s' extract:'%s': %w", ErrTermCompile, tt.Type.String(), tt.Extract, err)
+			return
+		}
+	}
+
 	switch tt.Type {
-	case TermJqJson, TermJqYaml:
-		if m, err = makeJqMatch(tt); err != nil {
+	case TermJqJson, TermJqYaml, TermJqJsonFast:
+		if m, err = makeJqMatch(tt, pc); err != nil {
 			err = fmt.Errorf("%w type:'%s' value:'%s': %w", ErrTermCompile, tt.Type.String(), tt.Value, err)
 		}
 	case TermRegex:
 		if m, err = makeRegexMatch(tt.Value); err != nil {
 			err = fmt.Errorf("%w type:'%s' value:'%s': %w", ErrTermCompile, tt.Type.String(), tt.Value, err)
 		}
+	case TermExpr:
+		if m, err = makeExprMatch(tt.Value, pc); err != nil {
+			err = fmt.Errorf("%w type:'%s' value:'%s': %w", ErrTermCompile, tt.Type.String(), tt.Value, err)
+		}
 	case TermRaw:
 		m = makeRawMatch(tt.Value)
 	default:
@@ -84,24 +144,39 @@ func (tt TermT) NewMatcher() (m MatchFunc, err error) {
 	return
 }
 
+// Hits holds the frames emitted by a matcher; see frame.go.  Logs and Meta
+// are flat across frames; use Frame or All to split them.
 type Hits struct {
-	Cnt  int
-	Logs []LogEntry
+	Cnt    int
+	Logs   []LogEntry
+	Meta   []HitMeta  // Metadata per entry in Logs; nil unless enabled with WithHitMeta.
+	Frames []HitFrame // One per firing; nil if built by hand.
 }
 
 func (h *Hits) PopFront() []LogEntry {
+	return h.PopFrame().Logs
+}
+
+// PopFrame removes and returns the first frame.
+func (h *Hits) PopFrame() HitFrame {
 	if h.Cnt <= 0 {
-		return nil
+		return HitFrame{}
 	}
 
 	var (
-		sz   = len(h.Logs) / h.Cnt
-		logs = h.Logs[:sz]
+		f  = h.Frame(0)
+		sz = len(f.Logs)
 	)
 
 	h.Cnt -= 1
 	h.Logs = h.Logs[sz:]
-	return logs
+	if len(h.Frames) > 0 {
+		h.Frames = h.Frames[1:]
+	}
+	if len(h.Meta) > 0 {
+		h.Meta = h.Meta[sz:]
+	}
+	return f
 }
 
 func (h Hits) Last() []LogEntry {
@@ -109,15 +184,7 @@ func (h Hits) Last() []LogEntry {
 }
 
 func (h Hits) Index(i int) []LogEntry {
-	if i >= h.Cnt {
-		return nil
-	}
-	var (
-		nLogs = len(h.Logs)
-		sz    = nLogs / h.Cnt
-		off   = i * sz
-	)
-	return h.Logs[off : off+sz]
+	return h.Frame(i).Logs
 }
 
 func IsRegex(v string) bool {
@@ -142,26 +209,14 @@ func makeRegexMatch(term string) (MatchFunc, error) {
 }
 
 func makeJsonUnmarshal() func(string) (any, error) {
-	// memorize unmarshaller; this avoids unmarshalling
-	// multiple times if there is more than one Jq matcher installed
-
-	var (
-		lastLine  string
-		lastError error
-		lastValue any
-	)
-
-	return func(line string) (any, error) {
-		if line == lastLine {
-			return lastValue, lastError
-		}
-		lastLine = line
-		lastError = json.Unmarshal([]byte(line), &lastValue)
-		return lastValue, lastError
-	}
+	return memoUnmarshal(json.Unmarshal)
 }
 
 func makeYamlUnmarshal() func(string) (any, error) {
+	return memoUnmarshal(yaml.Unmarshal)
+}
+
+func memoUnmarshal(decode func([]byte, any) error) func(string) (any, error) {
 	// memorize unmarshaller; this avoids unmarshalling
 	// multiple times if there is more than one Jq matcher installed
 
@@ -176,7 +231,7 @@ func makeYamlUnmarshal() func(string) (any, error) {
 			return lastValue, lastError
 		}
 		lastLine = line
-		lastError = yaml.Unmarshal([]byte(line), &lastValue)
+		lastError = decode([]byte(line), &lastValue)
 		return lastValue, lastError
 	}
 }
@@ -197,15 +252,9 @@ func NewJqJson(term string) (MatchFunc, error) {
 	return _makeJqMatch(term, code, unmarshal), nil
 }
 
-func makeJqMatch(term TermT) (MatchFunc, error) {
-	var unmarshal unmarshalFuncT
-
-	switch term.Type {
-	case TermJqJson:
-		unmarshal = makeJsonUnmarshal()
-	case TermJqYaml:
-		unmarshal = makeYamlUnmarshal()
-	default:
+func makeJqMatch(term TermT, pc *parseCacheT) (MatchFunc, error) {
+	unmarshal := pc.unmarshal(term.Type)
+	if unmarshal == nil {
 		return nil, errors.New("unknown jq format")
 	}
 
@@ -219,7 +268,12 @@ func makeJqMatch(term TermT) (MatchFunc, error) {
 		return nil, err
 	}
 
-	return _makeJqMatch(term.Value, code, unmarshal), nil
+	m := _makeJqMatch(term.Value, code, unmarshal)
+	if term.Type == TermJqJsonFast {
+		m = makeJqFastMatch(query, m)
+	}
+
+	return m, nil
 }
 
 type unmarshalFuncT func(string) (any, error)
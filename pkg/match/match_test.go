@@ -27,6 +27,110 @@ func TestMatchJson(t *testing.T) {
 	}
 }
 
+func TestMatchStream(t *testing.T) {
+	tt := TermT{
+		Type:   TermRaw,
+		Value:  "panic",
+		Stream: "stderr",
+	}
+
+	m, err := tt.NewEntryMatcher()
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	if !m(LogEntry{Line: "panic", Stream: "stderr"}) {
+		t.Errorf("Expected match, got fail.")
+	}
+	if m(LogEntry{Line: "panic", Stream: "stdout"}) {
+		t.Errorf("Expected no match on stdout, got match.")
+	}
+	if m(LogEntry{Line: "ok", Stream: "stderr"}) {
+		t.Errorf("Expected no match, got match.")
+	}
+}
+
+// Every matcher must honor the stream constraint on its terms.
+func TestMatchStreamMatchers(t *testing.T) {
+	var (
+		engine = NewEngine()
+		fatal  = TermT{Type: TermRaw, Value: "panic", Stream: "stderr"}
+		exit   = makeRaw("exit")
+		reset  = []ResetT{{Term: TermT{Type: TermRaw, Value: "reset", Stream: "stderr"}}}
+	)
+
+	tests := map[string]struct {
+		kind   string
+		cached bool
+	}{
+		"MatchSingle":       {kind: "single"},
+		"MatchSingleCached": {kind: "single", cached: true},
+		"MatchSeq":          {kind: "seq"},
+		"MatchSeqCached":    {kind: "seq", cached: true},
+		"MatchSet":          {kind: "set"},
+		"MatchSetCached":    {kind: "set", cached: true},
+		"InverseSeq":        {kind: "inverseSeq"},
+		"InverseSeqCached":  {kind: "inverseSeq", cached: true},
+		"InverseSet":        {kind: "inverseSet"},
+		"InverseSetCached":  {kind: "inverseSet", cached: true},
+		"MatchCount":        {kind: "count"},
+		"MatchCountCached":  {kind: "count", cached: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []OptT
+			if tc.cached {
+				opts = append(opts, WithTermCache(engine.Terms()))
+			}
+
+			var (
+				sm  Matcher
+				err error
+			)
+
+			switch tc.kind {
+			case "single":
+				sm, err = NewMatchSingleOpts(fatal, opts...)
+			case "seq":
+				sm, err = NewMatchSeqOpts(10, []TermT{fatal, exit}, opts...)
+			case "set":
+				sm, err = NewMatchSetOpts(10, []TermT{exit, fatal}, opts...)
+			case "inverseSeq":
+				sm, err = NewInverseSeqOpts(10, []TermT{fatal, exit}, reset, opts...)
+			case "inverseSet":
+				sm, err = NewInverseSetOpts(10, []TermT{exit, fatal}, reset, opts...)
+			case "count":
+				sm, err = NewMatchCount(10, 1, fatal, opts...)
+			}
+			if err != nil {
+				t.Fatalf("Expected nil error, got: %v", err)
+			}
+
+			var (
+				clock int64
+				cnt   int
+			)
+			for _, e := range []LogEntry{
+				{Line: "panic", Stream: "stdout"},
+				{Line: "exit", Stream: "stdout"},
+				{Line: "reset", Stream: "stdout"},
+				{Line: "panic", Stream: "stderr"},
+				{Line: "exit", Stream: "stdout"},
+			} {
+				clock += 1
+				e.Timestamp = clock
+				cnt += sm.Scan(e).Cnt
+			}
+			cnt += sm.Eval(clock + 100).Cnt
+
+			if cnt != 1 {
+				t.Errorf("Expected 1 hit, got %v", cnt)
+			}
+		})
+	}
+}
+
 func TestMatchJsonString(t *testing.T) {
 	tt := TermT{
 		Type:  TermJqJson,
@@ -0,0 +1,124 @@
+package match
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Hit metadata explains why a matcher fired.  With WithHitMeta, every entry
+// of a hit frame is paired with a HitMeta naming the term it satisfied and
+// the fields the term captured, and the byte spans of the term's match are
+// appended to the entry's Matches.  Raw and regex terms have spans; jq and
+// expr terms match the line as a whole and add none.  Metadata is computed
+// only when a hit fires, so scanning costs nothing extra.
+
+const NoTerm = -1 // HitMeta.Term of a context entry that satisfied no term
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+type HitMeta struct {
+	Term   int     // Index of the term the entry satisfied, or NoTerm
+	Fields []Field // Fields captured by the term; nil if none
+	Count  int     // Repetitions of the step the entry satisfied (MatchPattern); zero if the step does not repeat
+}
+
+type spanFuncT func(string) [][]int
+
+type explainT struct {
+	term    int // Index of the term as passed to the constructor
+	span    spanFuncT
+	capture captureFuncT
+}
+
+// Per internal term; nil if hit metadata is disabled.
+type hitMetaT []explainT
+
+// Build the explainers for src; index[i] is the constructor index of src[i],
+// or nil if they are the same.  Returns nil unless enabled in o.
+func newHitMeta(o optsT, src []TermT, index []int) (hitMetaT, error) {
+	if !o.hitMeta {
+		return nil, nil
+	}
+
+	hm := make(hitMetaT, len(src))
+	for i, term := range src {
+		capture, err := term.newCapture(o.parseCache())
+		if err != nil {
+			return nil, err
+		}
+
+		hm[i] = explainT{term: i, span: term.newSpan(), capture: capture}
+		if index != nil {
+			hm[i].term = index[i]
+		}
+	}
+
+	return hm, nil
+}
+
+// Returns nil if the term has no spans.
+func (tt TermT) newSpan() spanFuncT {
+	switch tt.Type {
+	case TermRaw:
+		return func(line string) (spans [][]int) {
+			for off := 0; ; {
+				i := strings.Index(line[off:], tt.Value)
+				if i < 0 {
+					return
+				}
+				off += i
+				spans = append(spans, []int{off, off + len(tt.Value)})
+				off += len(tt.Value)
+			}
+		}
+	case TermRegex:
+		// Already validated by the matcher.
+		if exp, err := regexp.Compile(tt.Value); err == nil {
+			return func(line string) [][]int {
+				return exp.FindAllStringIndex(line, -1)
+			}
+		}
+	}
+	return nil
+}
+
+// Append e to hits as a match of internal term idx.
+func (hm hitMetaT) add(hits *Hits, e LogEntry, idx int) {
+	if hm == nil {
+		hits.Logs = append(hits.Logs, e)
+		return
+	}
+
+	var (
+		ex   = hm[idx]
+		meta = HitMeta{Term: ex.term}
+	)
+
+	if ex.span != nil {
+		if spans := ex.span(e.Line); spans != nil {
+			// Clip; the entry may share Matches with a buffered assert.
+			e.Matches = append(slices.Clip(e.Matches), spans...)
+		}
+	}
+
+	if ex.capture != nil {
+		for _, f := range ex.capture(e.Line) {
+			meta.Fields = append(meta.Fields, Field{Name: f.name, Value: f.value})
+		}
+	}
+
+	hits.Logs = append(hits.Logs, e)
+	hits.Meta = append(hits.Meta, meta)
+}
+
+// Append e to hits as context that satisfied no term.
+func (hm hitMetaT) addContext(hits *Hits, e LogEntry) {
+	hits.Logs = append(hits.Logs, e)
+	if hm != nil {
+		hits.Meta = append(hits.Meta, HitMeta{Term: NoTerm})
+	}
+}
@@ -0,0 +1,141 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHitMetaSeq(t *testing.T) {
+	sm, err := NewMatchSeqOpts(10, []TermT{
+		makeRaw("alpha"),
+		captureTerm(`pod=(?P<pod>\w+)`),
+		{Type: TermJqJson, Value: `.level == "error"`, Extract: `{code: .code}`},
+	}, WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha and alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "restart pod=web", Matches: [][]int{{0, 7}}})
+	hits := sm.Scan(LogEntry{Timestamp: 3, Line: `{"level": "error", "code": "E1"}`})
+
+	if hits.Cnt != 1 || len(hits.Logs) != 3 || len(hits.Meta) != 3 {
+		t.Fatalf("Expected 1 hit with 3 annotated entries, got %v", hits)
+	}
+
+	var (
+		wantMeta = []HitMeta{
+			{Term: 0},
+			{Term: 1, Fields: []Field{{Name: "pod", Value: "web"}}},
+			{Term: 2, Fields: []Field{{Name: "code", Value: "E1"}}},
+		}
+		wantMatches = [][][]int{
+			{{0, 5}, {10, 15}},
+			{{0, 7}, {8, 15}}, // Existing matches are kept
+			nil,               // jq has no spans
+		}
+	)
+
+	if !reflect.DeepEqual(hits.Meta, wantMeta) {
+		t.Errorf("Expected meta %v, got %v", wantMeta, hits.Meta)
+	}
+	for i, e := range hits.Logs {
+		if !reflect.DeepEqual(e.Matches, wantMatches[i]) {
+			t.Errorf("Entry %d: expected matches %v, got %v", i, wantMatches[i], e.Matches)
+		}
+	}
+}
+
+func TestHitMetaSetDupes(t *testing.T) {
+	sm, err := NewMatchSetOpts(10, makeTermsA("alpha", "beta", "alpha"), WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+	hits := sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+
+	if hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit, got %v", hits.Cnt)
+	}
+
+	// Dupes report the index of the first occurrence.
+	want := []HitMeta{{Term: 0}, {Term: 0}, {Term: 1}}
+	if !reflect.DeepEqual(hits.Meta, want) {
+		t.Errorf("Expected meta %v, got %v", want, hits.Meta)
+	}
+}
+
+func TestHitMetaInverse(t *testing.T) {
+	iq, err := NewInverseSeqOpts(10, makeTermsA("alpha", "beta"), nil, WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	for i, line := range []string{"alpha", "x beta", "alpha", "beta"} {
+		appendHits(&hits, iq.Scan(LogEntry{Timestamp: int64(i + 1), Line: line}))
+	}
+
+	if hits.Cnt != 2 || len(hits.Meta) != 4 {
+		t.Fatalf("Expected 2 annotated hits, got %v", hits)
+	}
+
+	if hits.Meta[1].Term != 1 || !reflect.DeepEqual(hits.Logs[1].Matches, [][]int{{2, 6}}) {
+		t.Errorf("Expected beta span, got %v %v", hits.Meta[1], hits.Logs[1].Matches)
+	}
+
+	// PopFront keeps Meta aligned with Logs.
+	hits.PopFront()
+	if len(hits.Meta) != 2 || hits.Logs[0].Timestamp != 3 || hits.Meta[0].Term != 0 {
+		t.Errorf("Expected second frame, got %v", hits)
+	}
+}
+
+func TestHitMetaAbsence(t *testing.T) {
+	am, err := NewMatchAbsence(10, makeRaw("alpha"), WithStartTerm(makeRaw("start")), WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	am.Scan(LogEntry{Timestamp: 1, Line: "start"})
+	hits := am.Eval(20)
+	if hits.Cnt != 1 || !reflect.DeepEqual(hits.Meta, []HitMeta{{Term: NoTerm}}) {
+		t.Fatalf("Expected context entry, got %v", hits)
+	}
+
+	am.Scan(LogEntry{Timestamp: 21, Line: "start"})
+	am.Scan(LogEntry{Timestamp: 22, Line: "alpha"})
+	hits = am.Eval(40)
+	if hits.Cnt != 1 || !reflect.DeepEqual(hits.Meta, []HitMeta{{Term: 0}}) {
+		t.Fatalf("Expected term entry, got %v", hits)
+	}
+}
+
+func TestHitMetaPartition(t *testing.T) {
+	pm, err := NewMatchPartition(KeyT{Type: KeyRegex, Value: `id=(\w+)`}, func() (Matcher, error) {
+		return NewMatchCount(10, 2, makeRaw("fail"), WithHitMeta(true))
+	})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 1, Line: "fail id=a"})
+	hits := pm.Scan(LogEntry{Timestamp: 2, Line: "fail id=a"})
+	if hits.Cnt != 1 || len(hits.Meta) != 2 || len(hits.Logs[1].Matches) != 1 {
+		t.Fatalf("Expected annotated hit, got %v", hits)
+	}
+}
+
+func TestHitMetaDisabled(t *testing.T) {
+	sm, err := NewMatchSingle(makeRaw("alpha"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	hits := sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	if hits.Cnt != 1 || hits.Meta != nil || hits.Logs[0].Matches != nil {
+		t.Fatalf("Expected no metadata, got %v", hits)
+	}
+}
@@ -0,0 +1,73 @@
+package match
+
+import (
+	"errors"
+)
+
+var (
+	ErrNilMatcher = errors.New("nil matcher")
+)
+
+// A frame is a hit emitted by a nested matcher.  The parent treats the
+// frame as a single synthetic event that spans [Start, Stop].
+
+type nestTermT struct {
+	matcher Matcher
+	frames  []HitFrame
+}
+
+func newNestTerms(terms []Matcher) ([]nestTermT, error) {
+	switch {
+	case len(terms) > maxTerms:
+		return nil, ErrTooManyTerms
+	case len(terms) == 0:
+		return nil, ErrNoTerms
+	}
+
+	nTerms := make([]nestTermT, len(terms))
+	for i, m := range terms {
+		if m == nil {
+			return nil, ErrNilMatcher
+		}
+		nTerms[i].matcher = m
+	}
+	return nTerms, nil
+}
+
+// Queue the frames of hits on the term; returns the number queued.
+func (t *nestTermT) queue(hits Hits) (cnt int) {
+	for _, f := range hits.All() {
+		if len(f.Logs) > 0 {
+			t.frames = append(t.frames, f)
+			cnt += 1
+		}
+	}
+	return
+}
+
+// Drop frames that start before the deadline; they cannot be part of
+// a frame that completes at or after the current clock.
+func (t *nestTermT) gc(deadline int64) (cnt int) {
+	for _, f := range t.frames {
+		if f.Start >= deadline {
+			break
+		}
+		cnt += 1
+	}
+
+	if cnt > 0 {
+		t.drop(0, cnt)
+	}
+	return
+}
+
+func (t *nestTermT) drop(idx, cnt int) {
+	switch {
+	case idx > 0 || cnt < len(t.frames):
+		t.frames = append(t.frames[:idx], t.frames[idx+cnt:]...)
+	case cap(t.frames) <= capThreshold:
+		t.frames = t.frames[:0]
+	default:
+		t.frames = nil
+	}
+}
@@ -0,0 +1,130 @@
+package match
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// NestedSeq is a sequence whose terms are themselves matchers.  Each hit
+// emitted by a term matcher is treated as a synthetic event spanning the
+// timestamps of its frame.  The sequence fires when a frame from each term
+// is found in order; a frame must start at or after the previous frame stops.
+// The window covers the whole nested frame: from the start of the first term's
+// frame to the stop of the last term's frame.
+//
+// Leaf terms can be wrapped with NewMatchSingle.  Each term must be a distinct
+// matcher instance; the NestedSeq owns the term matchers once constructed.
+
+type NestedSeq struct {
+	clock  int64
+	window int64
+	terms  []nestTermT
+	trace  tracerT
+}
+
+func NewNestedSeq(window int64, terms ...Matcher) (*NestedSeq, error) {
+	return NewNestedSeqOpts(window, terms)
+}
+
+// NewNestedSeqOpts is NewNestedSeq with options.
+func NewNestedSeqOpts(window int64, terms []Matcher, opts ...OptT) (*NestedSeq, error) {
+	nTerms, err := newNestTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NestedSeq{
+		window: window,
+		terms:  nTerms,
+		trace:  newTracer(parseOpts(opts), len(nTerms), nil),
+	}, nil
+}
+
+func (r *NestedSeq) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("NestedSeq: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+	r.clock = e.Timestamp
+
+	r.gc(e.Timestamp)
+
+	for i := range r.terms {
+		r.trace.frames(i, r.terms[i].queue(r.terms[i].matcher.Scan(e)))
+	}
+
+	return r.fire()
+}
+
+// Eval is forwarded to the term matchers, which may fire on clock (ie. inverse matchers).
+func (r *NestedSeq) Eval(clock int64) (hits Hits) {
+	for i := range r.terms {
+		r.trace.frames(i, r.terms[i].queue(r.terms[i].matcher.Eval(clock)))
+	}
+	return r.fire()
+}
+
+func (r *NestedSeq) GarbageCollect(clock int64) {
+	for i := range r.terms {
+		r.terms[i].matcher.GarbageCollect(clock)
+	}
+	r.gc(clock)
+}
+
+func (r *NestedSeq) gc(clock int64) {
+	deadline := clock - r.window
+	for i := range r.terms {
+		r.trace.gc(clock, i, r.terms[i].gc(deadline))
+	}
+}
+
+func (r *NestedSeq) fire() (hits Hits) {
+	var (
+		nTerms = len(r.terms)
+		picks  = make([]int, nTerms)
+	)
+
+LOOP:
+	for len(r.terms[0].frames) > 0 {
+
+		// Greedy;  pick the first frame on each term that follows the previous pick.
+		// Frames are queued in the order they fire, so the first qualifying frame
+		// has the earliest stop, which leaves the most room for subsequent terms.
+		prevStop := r.terms[0].frames[0].Stop
+		for i := 1; i < nTerms; i++ {
+			picks[i] = -1
+			for j, f := range r.terms[i].frames {
+				if f.Start >= prevStop {
+					picks[i] = j
+					prevStop = f.Stop
+					break
+				}
+			}
+			if picks[i] < 0 {
+				// Cannot complete the sequence yet.
+				break LOOP
+			}
+		}
+
+		if prevStop-r.terms[0].frames[0].Start > r.window {
+			// The first frame cannot complete within the window; drop it and retry.
+			r.trace.drop(r.clock, DropWindow, 0, 1)
+			r.terms[0].drop(0, 1)
+			continue
+		}
+
+		for i := range r.terms {
+			hits.Logs = append(hits.Logs, r.terms[i].frames[picks[i]].Logs...)
+			r.terms[i].drop(picks[i], 1)
+		}
+		hits.closeFrame(r.window)
+		r.trace.hit(r.clock, hits)
+	}
+
+	return
+}
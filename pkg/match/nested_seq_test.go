@@ -0,0 +1,195 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+)
+
+func TestNestedSeq(t *testing.T) {
+	type step = stepT[NestedSeq]
+
+	var tests = map[string]struct {
+		window int64
+		build  func(t *testing.T) []Matcher
+		steps  []step
+	}{
+		"Singles": {
+			// -1-------- alpha
+			// --2------- beta
+			// Behaves like a simple sequence.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{single(t, "alpha"), single(t, "beta")}
+			},
+			steps: []step{
+				{line: "beta"},
+				{line: "alpha"},
+				{line: "beta", cb: matchStamps(2, 3)},
+			},
+		},
+
+		"SetThenSeq": {
+			// Set {X,Y} followed by sequence {A,B}.
+			// -1-------- Y
+			// --2------- X
+			// ---3------ A
+			// ----4----- B
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{
+					set(t, 5, "X", "Y"),
+					seq(t, 5, "A", "B"),
+				}
+			},
+			steps: []step{
+				{line: "Y"},
+				{line: "X"},
+				{line: "A"},
+				{line: "B", cb: matchLines("X", "Y", "A", "B")},
+			},
+		},
+
+		"NestedOutOfOrder": {
+			// Sequence {A,B} completes before set {X,Y};
+			// the nested frames overlap so should not fire.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{
+					set(t, 5, "X", "Y"),
+					seq(t, 5, "A", "B"),
+				}
+			},
+			steps: []step{
+				{line: "X"},
+				{line: "A"},
+				{line: "Y"},
+				{line: "B"},
+			},
+		},
+
+		"WindowCoversNestedFrame": {
+			// Set {X,Y} starts at 1, sequence {A,B} stops at 12.
+			// The whole frame is 11 wide, which exceeds the window of 10.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{
+					set(t, 5, "X", "Y"),
+					seq(t, 5, "A", "B"),
+				}
+			},
+			steps: []step{
+				{line: "X", stamp: 1},
+				{line: "Y", stamp: 2},
+				{line: "A", stamp: 8},
+				{line: "B", stamp: 12},
+				{line: "X", stamp: 13},
+				{line: "Y", stamp: 14},
+				{line: "A", stamp: 15},
+				{line: "B", stamp: 16, cb: matchStamps(13, 14, 15, 16)},
+			},
+		},
+
+		"GarbageCollect": {
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{single(t, "alpha"), single(t, "beta")}
+			},
+			steps: []step{
+				{line: "alpha", stamp: 1},
+				{postF: garbageCollect[*NestedSeq](12)},
+				{line: "beta", stamp: 12},
+			},
+		},
+
+		"InverseTerm": {
+			// Inverse sequence term fires on Eval once its reset window expires.
+			window: 20,
+			build: func(t *testing.T) []Matcher {
+				inv, err := NewInverseSeq(
+					5,
+					makeTermsA("A", "B"),
+					[]ResetT{{Term: makeRaw("reset"), Window: 5, Absolute: true}},
+				)
+				if err != nil {
+					t.Fatalf("Expected err == nil, got %v", err)
+				}
+				return []Matcher{inv, single(t, "C")}
+			},
+			steps: []step{
+				{line: "A", stamp: 1},
+				{line: "B", stamp: 2},
+				{line: "C", stamp: 3},
+				{line: "C", stamp: 8, cb: matchLines("A", "B", "C")},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewNestedSeq(tc.window, tc.build(t)...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestNestedSeqBadTerms(t *testing.T) {
+	if _, err := NewNestedSeq(10); err != ErrNoTerms {
+		t.Fatalf("Expected err == ErrNoTerms, got %v", err)
+	}
+	if _, err := NewNestedSeq(10, nil); err != ErrNilMatcher {
+		t.Fatalf("Expected err == ErrNilMatcher, got %v", err)
+	}
+}
+
+func single(t *testing.T, term string) Matcher {
+	t.Helper()
+	m, err := NewMatchSingle(makeRaw(term))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	return m
+}
+
+func seq(t *testing.T, window int64, terms ...string) Matcher {
+	t.Helper()
+	m, err := NewMatchSeq(window, makeTerms(terms)...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	return m
+}
+
+func set(t *testing.T, window int64, terms ...string) Matcher {
+	t.Helper()
+	m, err := NewMatchSet(window, makeTerms(terms)...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	return m
+}
@@ -0,0 +1,123 @@
+package match
+
+import (
+	"math"
+
+	"github.com/rs/zerolog/log"
+)
+
+// NestedSet is a set whose terms are themselves matchers.  Each hit emitted
+// by a term matcher is treated as a synthetic event spanning the timestamps
+// of its frame.  The set fires when every term has a frame and the combined
+// frame, from the earliest start to the latest stop, fits in the window.
+//
+// Leaf terms can be wrapped with NewMatchSingle.  Each term must be a distinct
+// matcher instance; the NestedSet owns the term matchers once constructed.
+
+type NestedSet struct {
+	clock  int64
+	window int64
+	terms  []nestTermT
+	trace  tracerT
+}
+
+func NewNestedSet(window int64, terms ...Matcher) (*NestedSet, error) {
+	return NewNestedSetOpts(window, terms)
+}
+
+// NewNestedSetOpts is NewNestedSet with options.
+func NewNestedSetOpts(window int64, terms []Matcher, opts ...OptT) (*NestedSet, error) {
+	nTerms, err := newNestTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NestedSet{
+		window: window,
+		terms:  nTerms,
+		trace:  newTracer(parseOpts(opts), len(nTerms), nil),
+	}, nil
+}
+
+func (r *NestedSet) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("NestedSet: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+	r.clock = e.Timestamp
+
+	r.gc(e.Timestamp)
+
+	for i := range r.terms {
+		r.trace.frames(i, r.terms[i].queue(r.terms[i].matcher.Scan(e)))
+	}
+
+	return r.fire()
+}
+
+// Eval is forwarded to the term matchers, which may fire on clock (ie. inverse matchers).
+func (r *NestedSet) Eval(clock int64) (hits Hits) {
+	for i := range r.terms {
+		r.trace.frames(i, r.terms[i].queue(r.terms[i].matcher.Eval(clock)))
+	}
+	return r.fire()
+}
+
+func (r *NestedSet) GarbageCollect(clock int64) {
+	for i := range r.terms {
+		r.terms[i].matcher.GarbageCollect(clock)
+	}
+	r.gc(clock)
+}
+
+func (r *NestedSet) gc(clock int64) {
+	deadline := clock - r.window
+	for i := range r.terms {
+		r.trace.gc(clock, i, r.terms[i].gc(deadline))
+	}
+}
+
+func (r *NestedSet) fire() (hits Hits) {
+
+	for {
+		var (
+			minIdx int
+			tStart int64 = math.MaxInt64
+			tStop  int64 = math.MinInt64
+		)
+
+		for i, term := range r.terms {
+			if len(term.frames) == 0 {
+				return
+			}
+			f := term.frames[0]
+			if f.Start < tStart {
+				tStart = f.Start
+				minIdx = i
+			}
+			if f.Stop > tStop {
+				tStop = f.Stop
+			}
+		}
+
+		if tStop-tStart > r.window {
+			// The earliest frame cannot complete within the window; drop it and retry.
+			r.trace.drop(r.clock, DropWindow, minIdx, 1)
+			r.terms[minIdx].drop(0, 1)
+			continue
+		}
+
+		for i := range r.terms {
+			hits.Logs = append(hits.Logs, r.terms[i].frames[0].Logs...)
+			r.terms[i].drop(0, 1)
+		}
+		hits.closeFrame(r.window)
+		r.trace.hit(r.clock, hits)
+	}
+}
@@ -0,0 +1,100 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+)
+
+func TestNestedSet(t *testing.T) {
+	type step = stepT[NestedSet]
+
+	var tests = map[string]struct {
+		window int64
+		build  func(t *testing.T) []Matcher
+		steps  []step
+	}{
+		"Singles": {
+			// --1------- alpha
+			// -2-------- beta
+			// Behaves like a simple set.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{single(t, "alpha"), single(t, "beta")}
+			},
+			steps: []step{
+				{line: "beta"},
+				{line: "alpha", cb: matchStamps(2, 1)},
+			},
+		},
+
+		"SeqAndSeq": {
+			// Sequence {A,B} and sequence {C,D} in any order.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{
+					seq(t, 5, "A", "B"),
+					seq(t, 5, "C", "D"),
+				}
+			},
+			steps: []step{
+				{line: "C"},
+				{line: "D"},
+				{line: "A"},
+				{line: "B", cb: matchStamps(3, 4, 1, 2)},
+			},
+		},
+
+		"WindowCoversNestedFrame": {
+			// Combined frame from 1 to 12 exceeds the window.
+			// Earliest frame is dropped; next frame fires.
+			window: 10,
+			build: func(t *testing.T) []Matcher {
+				return []Matcher{
+					seq(t, 5, "A", "B"),
+					seq(t, 5, "C", "D"),
+				}
+			},
+			steps: []step{
+				{line: "A", stamp: 1},
+				{line: "B", stamp: 2},
+				{line: "C", stamp: 11},
+				{line: "D", stamp: 12},
+				{line: "A", stamp: 13},
+				{line: "B", stamp: 14, cb: matchStamps(13, 14, 11, 12)},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewNestedSet(tc.window, tc.build(t)...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(entry.LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package match
+
+// Options are shared across matchers; a matcher ignores options that do not apply to it.
+
+type optsT struct {
+	tumbling   bool
+	samples    int
+	startTerm  *TermT
+	maxKeys    int
+	idle       int64
+	dedupe     int64
+	cache      *TermCache
+	hitMeta    bool
+	tracer     TraceFunc
+	maxAsserts int
+	memLimit   int
+	eviction   EvictT
+	order      OrderT
+	selection  SelectT
+	maxFrames  int
+	maxRuns    int
+	maxSearch  int
+	gaps       []GapT
+}
+
+type OptT func(*optsT)
+
+// Use a tumbling window instead of a sliding window (MatchCount).
+func WithTumbling(tumbling bool) OptT {
+	return func(o *optsT) {
+		o.tumbling = tumbling
+	}
+}
+
+// Maximum number of matches retained for the hit frame (MatchCount).
+func WithSamples(samples int) OptT {
+	return func(o *optsT) {
+		o.samples = samples
+	}
+}
+
+// Arm the matcher on a start term rather than the first clock (MatchAbsence).
+func WithStartTerm(term TermT) OptT {
+	return func(o *optsT) {
+		o.startTerm = &term
+	}
+}
+
+// Maximum number of partitions before the least recently used is evicted (MatchPartition).
+func WithMaxKeys(n int) OptT {
+	return func(o *optsT) {
+		o.maxKeys = n
+	}
+}
+
+// Evict partitions that have not seen an entry for idle nanoseconds (MatchPartition).
+func WithIdle(idle int64) OptT {
+	return func(o *optsT) {
+		o.idle = idle
+	}
+}
+
+// Dedupe the hits of each partition over window nanoseconds (MatchPartition); see partition.go.
+func WithDedupe(window int64) OptT {
+	return func(o *optsT) {
+		o.dedupe = window
+	}
+}
+
+// Compile terms through a cache shared with other matchers (all).
+func WithTermCache(cache *TermCache) OptT {
+	return func(o *optsT) {
+		o.cache = cache
+	}
+}
+
+// Annotate hits with the matching term, spans and captured fields (all but nested); see meta.go.
+func WithHitMeta(enable bool) OptT {
+	return func(o *optsT) {
+		o.hitMeta = enable
+	}
+}
+
+// Report state changes to fn (all); see trace.go.
+func WithTracer(fn TraceFunc) OptT {
+	return func(o *optsT) {
+		o.tracer = fn
+	}
+}
+
+// Cap the asserts buffered across terms (MatchSet, InverseSet); see limit.go.
+func WithMaxAsserts(n int) OptT {
+	return func(o *optsT) {
+		o.maxAsserts = n
+	}
+}
+
+// Cap the estimated bytes of asserts buffered across terms (MatchSet, InverseSet); see limit.go.
+func WithMemoryLimit(limit int) OptT {
+	return func(o *optsT) {
+		o.memLimit = limit
+	}
+}
+
+// Which asserts to evict when over a cap; defaults to EvictOldest (MatchSet, InverseSet).
+func WithEviction(policy EvictT) OptT {
+	return func(o *optsT) {
+		o.eviction = policy
+	}
+}
+
+// How equal timestamps are ordered; defaults to OrderLenient (MatchSeq, InverseSeq); see order.go.
+func WithOrder(order OrderT) OptT {
+	return func(o *optsT) {
+		o.order = order
+	}
+}
+
+// Which buffered asserts make up a frame; defaults to SelectEarliest (MatchSeq, MatchSet); see select.go.
+func WithSelect(selection SelectT) OptT {
+	return func(o *optsT) {
+		o.selection = selection
+	}
+}
+
+// Cap the frames emitted per scan under SelectAll; defaults to 1024 (MatchSeq, MatchSet); see select.go.
+func WithMaxFrames(n int) OptT {
+	return func(o *optsT) {
+		o.maxFrames = n
+	}
+}
+
+// Cap the partial matches kept; defaults to 1024 (MatchPattern); see pattern.go.
+func WithMaxRuns(n int) OptT {
+	return func(o *optsT) {
+		o.maxRuns = n
+	}
+}
+
+// Cap the candidate matches visited per correlation search; defaults to 4096 (MatchSeq, MatchSet); see correlate.go.
+func WithMaxSearch(n int) OptT {
+	return func(o *optsT) {
+		o.maxSearch = n
+	}
+}
+
+// Bound the delay between consecutive terms; gaps[i] applies from term i to i+1 (MatchSeq, InverseSeq); see gap.go.
+func WithGaps(gaps ...GapT) OptT {
+	return func(o *optsT) {
+		o.gaps = gaps
+	}
+}
+
+// Compile a term, through the term cache if one is installed.
+func (o optsT) newMatcher(term TermT) (EntryMatchFunc, error) {
+	if o.cache == nil {
+		return term.NewEntryMatcher()
+	}
+
+	m, err := o.cache.matcher(term)
+	if err != nil {
+		return nil, err
+	}
+	return entryMatcher(m, term.Stream), nil
+}
+
+// The parse cache of the term cache, if one is installed.
+func (o optsT) parseCache() *parseCacheT {
+	if o.cache == nil {
+		return nil
+	}
+	return o.cache.docs
+}
+
+func parseOpts(opts []OptT) optsT {
+	o := optsT{
+		samples:   defCountSamples,
+		maxFrames: defMaxFrames,
+		maxRuns:   defMaxRuns,
+		maxSearch: defMaxSearch,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.samples < 2 {
+		// Need at least first and last
+		o.samples = 2
+	}
+	if o.maxFrames < 1 {
+		o.maxFrames = 1
+	}
+	if o.maxRuns < 1 {
+		o.maxRuns = 1
+	}
+	if o.maxSearch < 1 {
+		o.maxSearch = 1
+	}
+	return o
+}
@@ -0,0 +1,73 @@
+package match
+
+// The ordering policy decides whether an assert on one term of a sequence
+// may precede an assert on the next.  OrderLenient treats equal timestamps
+// as in order, which tolerates low resolution clocks but lets two entries
+// stamped in the same tick match in either order.  OrderStrict requires each
+// term to be stamped strictly later than the previous one.  OrderInput
+// breaks equal timestamps by input order, using a sequence number assigned
+// to each scanned entry.
+//
+// The policy applies when a term is activated, when miniGC prunes asserts
+// that cannot follow the previous term, and when correlated chains are
+// searched.  Under OrderStrict and OrderInput an entry never precedes
+// itself, so the same entry cannot fill two dupe terms; the dupe detection
+// by line and timestamp is only used by OrderLenient.
+
+type OrderT uint8
+
+const (
+	OrderLenient OrderT = iota // Equal timestamps are in order
+	OrderStrict                // Timestamps must increase
+	OrderInput                 // Equal timestamps are in input order
+)
+
+func (o OrderT) String() string {
+	switch o {
+	case OrderLenient:
+		return "lenient"
+	case OrderStrict:
+		return "strict"
+	case OrderInput:
+		return "input"
+	default:
+		return "unknown"
+	}
+}
+
+type orderT struct {
+	policy OrderT
+	seq    uint64 // Sequence number of the entry being scanned
+}
+
+// Assign the next sequence number to the entry being scanned.
+func (o *orderT) next() {
+	o.seq += 1
+}
+
+func (o orderT) lenient() bool {
+	return o.policy == OrderLenient
+}
+
+// Whether a, asserted on one term, may precede b on the next.
+func (o orderT) before(a, b assertT) bool {
+	switch o.policy {
+	case OrderStrict:
+		return a.Timestamp < b.Timestamp
+	case OrderInput:
+		return a.Timestamp < b.Timestamp || a.Timestamp == b.Timestamp && a.seq < b.seq
+	default:
+		return a.Timestamp <= b.Timestamp
+	}
+}
+
+// Whether a may precede the entry being scanned.
+func (o orderT) follows(a assertT, e LogEntry) bool {
+	return o.before(a, assertT{LogEntry: e, seq: o.seq})
+}
+
+// Buffer the entry being scanned as an assert tagged with its sequence number.
+func (o orderT) push(t *termT, e LogEntry) {
+	t.push(e)
+	t.asserts[len(t.asserts)-1].seq = o.seq
+}
@@ -0,0 +1,165 @@
+package match
+
+import (
+	"testing"
+)
+
+func TestOrderSeqTie(t *testing.T) {
+	tests := map[string]struct {
+		order OrderT
+		cnt   int
+	}{
+		"lenient": {order: OrderLenient, cnt: 1},
+		"strict":  {order: OrderStrict, cnt: 0},
+		"input":   {order: OrderInput, cnt: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "beta"), WithOrder(tc.order))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			if hits := sm.Scan(LogEntry{Timestamp: 1, Line: "beta"}); hits.Cnt != tc.cnt {
+				t.Errorf("Expected %d hits, got %v", tc.cnt, hits)
+			}
+		})
+	}
+}
+
+// After GC, a beta scanned before an alpha with the same stamp must not
+// follow it unless ties are lenient.
+func TestOrderSeqMiniGC(t *testing.T) {
+	tests := map[string]struct {
+		order OrderT
+		cnt   int
+	}{
+		"lenient": {order: OrderLenient, cnt: 1},
+		"strict":  {order: OrderStrict, cnt: 0},
+		"input":   {order: OrderInput, cnt: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "beta", "gamma"), WithOrder(tc.order))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			sm.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+			sm.Scan(LogEntry{Timestamp: 5, Line: "alpha"})
+
+			hits := sm.Scan(LogEntry{Timestamp: 12, Line: "gamma"})
+			if hits.Cnt != tc.cnt {
+				t.Errorf("Expected %d hits, got %v", tc.cnt, hits)
+			}
+		})
+	}
+}
+
+func TestOrderSeqDupes(t *testing.T) {
+	tests := map[string]struct {
+		order OrderT
+		cnt   int
+	}{
+		"lenient": {order: OrderLenient, cnt: 1},
+		"strict":  {order: OrderStrict, cnt: 0},
+		"input":   {order: OrderInput, cnt: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "alpha", "beta"), WithOrder(tc.order))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			// The second alpha is stamped with the first.
+			sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+
+			hits := sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+			if hits.Cnt != tc.cnt {
+				t.Errorf("Expected %d hits, got %v", tc.cnt, hits)
+			}
+		})
+	}
+}
+
+func TestOrderSeqCorrelated(t *testing.T) {
+	sm, err := NewMatchSeqOpts(10, []TermT{captureTerm(`alpha id=(?P<id>\d+)`), captureTerm(`beta id=(?P<id>\d+)`)}, WithOrder(OrderStrict))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha id=1"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "alpha id=2"})
+	if hits := sm.Scan(LogEntry{Timestamp: 2, Line: "beta id=2"}); hits.Cnt != 0 {
+		t.Errorf("Expected no hit on equal stamps, got %v", hits)
+	}
+
+	hits := sm.Scan(LogEntry{Timestamp: 3, Line: "beta id=2"})
+	if hits.Cnt != 1 || hits.Logs[0].Line != "alpha id=2" {
+		t.Errorf("Expected hit on alpha id=2, got %v", hits)
+	}
+}
+
+func TestOrderInverseSeq(t *testing.T) {
+	tests := map[string]struct {
+		order OrderT
+		cnt   int
+	}{
+		"lenient": {order: OrderLenient, cnt: 1},
+		"strict":  {order: OrderStrict, cnt: 0},
+		"input":   {order: OrderInput, cnt: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is, err := NewInverseSeqOpts(10, makeTermsA("alpha", "beta", "gamma"), []ResetT{
+				{Term: makeRaw("reset")},
+			}, WithOrder(tc.order))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			is.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			is.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+			is.Scan(LogEntry{Timestamp: 5, Line: "alpha"})
+			is.Scan(LogEntry{Timestamp: 13, Line: "gamma"})
+
+			if hits := is.Eval(100); hits.Cnt != tc.cnt {
+				t.Errorf("Expected %d hits, got %v", tc.cnt, hits)
+			}
+		})
+	}
+}
+
+// Sequence numbers survive a snapshot; a tie in input order still matches.
+func TestOrderSnapshot(t *testing.T) {
+	var (
+		factory = func() (*MatchSeq, error) {
+			return NewMatchSeqOpts(10, makeTermsA("alpha", "beta", "gamma"), WithOrder(OrderInput))
+		}
+		orig, _     = factory()
+		restored, _ = factory()
+	)
+
+	orig.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	orig.Scan(LogEntry{Timestamp: 5, Line: "alpha"})
+	orig.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+
+	if err := restored.Restore(orig.Snapshot()); err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	for _, m := range []*MatchSeq{orig, restored} {
+		hits := m.Scan(LogEntry{Timestamp: 12, Line: "gamma"})
+		if hits.Cnt != 1 || hits.Logs[0].Timestamp != 5 {
+			t.Errorf("Expected hit on alpha 5, got %v", hits)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package match
+
+// A parseCacheT shares decoded documents across jq terms.  Each decoder
+// memoizes the last line, so as long as every term inspects an entry before
+// the next is scanned, as with Engine.Scan, a line is decoded at most once
+// per format regardless of how many jq terms, captures and partition keys
+// inspect it.  Installed on a TermCache; a nil cache gives every term its
+// own decoder.
+
+type parseCacheT struct {
+	json unmarshalFuncT
+	yaml unmarshalFuncT
+}
+
+func newParseCache() *parseCacheT {
+	return &parseCacheT{
+		json: makeJsonUnmarshal(),
+		yaml: makeYamlUnmarshal(),
+	}
+}
+
+// Returns the decoder for a jq term type, or nil if the type is not jq.
+func (pc *parseCacheT) unmarshal(tt TermTypeT) unmarshalFuncT {
+	switch tt {
+	case TermJqJson, TermJqJsonFast:
+		if pc == nil {
+			return makeJsonUnmarshal()
+		}
+		return pc.json
+	case TermJqYaml:
+		if pc == nil {
+			return makeYamlUnmarshal()
+		}
+		return pc.yaml
+	}
+	return nil
+}
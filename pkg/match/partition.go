@@ -0,0 +1,349 @@
+package match
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrKeyType    = errors.New("unknown key type")
+	ErrNilFactory = errors.New("nil matcher factory")
+)
+
+const defMaxKeys = 4096
+
+// MatchPartition keeps an independent matcher per key, where the key is
+// extracted from each LogEntry.  This allows a single rule to track thousands
+// of pods, requests, etc. in an aggregated log.
+//
+// Entries without a key are ignored.  Hits are labeled with the key of the
+// partition that fired in HitFrame.Key.
+//
+// Cardinality is bounded; when a new key would exceed the limit set with
+// WithMaxKeys, the least recently used partition is evicted.  Partitions that
+// have not seen an entry within the duration set by WithIdle are evicted on
+// GarbageCollect.  Eviction drops any partial match; the idle duration should
+// exceed the window of the partitioned matcher.
+//
+// With WithDedupe, each partition keeps its own Dedupe so that a hit on one
+// key does not suppress a hit on another.  Hits pass through the Dedupe of
+// their partition; a pending hit fires on a later Scan or Eval of the
+// partition once its active window expires on the log clock.  The Dedupe goes
+// with the partition on eviction.
+
+type KeyTypeT int
+
+const (
+	KeyStream KeyTypeT = iota
+	KeyRegex
+	KeyJqJson
+	KeyJqYaml
+)
+
+func (t KeyTypeT) String() string {
+	switch t {
+	case KeyStream:
+		return "stream"
+	case KeyRegex:
+		return "regex"
+	case KeyJqJson:
+		return "jqJson"
+	case KeyJqYaml:
+		return "jqYaml"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyT specifies how to extract the partition key.  A regex key uses the first
+// capture group, or the entire match if the expression has no groups.  A jq key
+// uses the first result of the program.  Value is ignored for a stream key.
+type KeyT struct {
+	Type  KeyTypeT
+	Value string
+}
+
+// Returns a new, empty matcher for a partition.
+type FactoryFunc func() (Matcher, error)
+
+type keyFuncT func(LogEntry) (string, bool)
+
+type partT struct {
+	key     string
+	clock   int64
+	matcher Matcher
+	dedupe  *Dedupe // nil unless WithDedupe
+}
+
+type MatchPartition struct {
+	clock   int64
+	idle    int64
+	dedupe  int64
+	maxKeys int
+	keyF    keyFuncT
+	factory FactoryFunc
+	spare   Matcher
+	lru     *list.List // Front is most recently used
+	parts   map[string]*list.Element
+	trace   tracerT
+	retired Stats // Counters of evicted partitions
+}
+
+func NewMatchPartition(key KeyT, factory FactoryFunc, opts ...OptT) (*MatchPartition, error) {
+	if factory == nil {
+		return nil, ErrNilFactory
+	}
+
+	o := parseOpts(opts)
+
+	keyF, err := key.newKeyFunc(o.parseCache())
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the first matcher up front to surface any errors.
+	spare, err := factory()
+	if err != nil {
+		return nil, err
+	}
+
+	maxKeys := o.maxKeys
+	if maxKeys <= 0 {
+		maxKeys = defMaxKeys
+	}
+
+	return &MatchPartition{
+		idle:    o.idle,
+		dedupe:  o.dedupe,
+		maxKeys: maxKeys,
+		keyF:    keyF,
+		factory: factory,
+		spare:   spare,
+		lru:     list.New(),
+		parts:   make(map[string]*list.Element),
+		trace:   newTracer(o, 0, nil),
+	}, nil
+}
+
+func (r *MatchPartition) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("MatchPartition: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+	r.clock = e.Timestamp
+
+	key, ok := r.keyF(e)
+	if !ok {
+		return
+	}
+
+	part := r.get(key)
+	if part == nil {
+		return
+	}
+	part.clock = e.Timestamp
+
+	return part.dedupeHits(e.Timestamp, labelHits(part.matcher.Scan(e), key))
+}
+
+// Evaluate every partition; hits are concatenated in least recently used order.
+func (r *MatchPartition) Eval(clock int64) (hits Hits) {
+	if clock < r.clock {
+		return
+	}
+	r.clock = clock
+
+	for el := r.lru.Back(); el != nil; el = el.Prev() {
+		part := el.Value.(*partT)
+		appendHits(&hits, part.dedupeHits(clock, labelHits(part.matcher.Eval(clock), part.key)))
+	}
+	return
+}
+
+// Evict idle partitions and garbage collect the remainder.
+func (r *MatchPartition) GarbageCollect(clock int64) {
+	if r.idle > 0 {
+		deadline := clock - r.idle
+		for el := r.lru.Back(); el != nil; el = r.lru.Back() {
+			if el.Value.(*partT).clock >= deadline {
+				break
+			}
+			r.evict(el)
+		}
+	}
+
+	for el := r.lru.Front(); el != nil; el = el.Next() {
+		el.Value.(*partT).matcher.GarbageCollect(clock)
+	}
+}
+
+// Number of active partitions.
+func (r *MatchPartition) Len() int {
+	return r.lru.Len()
+}
+
+// Returns the partition for key, creating it if necessary.
+func (r *MatchPartition) get(key string) *partT {
+	if el, ok := r.parts[key]; ok {
+		r.lru.MoveToFront(el)
+		return el.Value.(*partT)
+	}
+
+	if r.lru.Len() >= r.maxKeys {
+		r.evict(r.lru.Back())
+	}
+
+	m := r.spare
+	r.spare = nil
+	if m == nil {
+		var err error
+		if m, err = r.factory(); err != nil {
+			// The factory succeeded at construction; this should not happen.
+			log.Error().Err(err).Str("key", key).Msg("MatchPartition: Fail create matcher.")
+			return nil
+		}
+	}
+
+	part := &partT{key: key, matcher: m}
+	if r.dedupe > 0 {
+		part.dedupe = NewDedupe(time.Duration(r.dedupe))
+	}
+	r.parts[key] = r.lru.PushFront(part)
+	return part
+}
+
+func (r *MatchPartition) evict(el *list.Element) {
+	part := r.lru.Remove(el).(*partT)
+	delete(r.parts, part.key)
+	r.trace.evict(r.clock, part.key)
+
+	// The buffered state goes with the matcher.
+	st := part.matcher.Stats()
+	st.Asserts, st.Resets, st.Bytes = 0, 0, 0
+	r.retired.add(st)
+}
+
+// Pass hits through the Dedupe of the partition, if any.
+func (part *partT) dedupeHits(clock int64, hits Hits) (out Hits) {
+	if part.dedupe == nil {
+		return hits
+	}
+
+	if f, _ := part.dedupe.MaybeFireFrame(clock, hits); f.Logs != nil {
+		appendFrame(&out, f)
+	}
+	return
+}
+
+func labelHits(hits Hits, key string) Hits {
+	for i := range hits.Frames {
+		hits.Frames[i].Key = key
+	}
+	return hits
+}
+
+func appendHits(dst *Hits, src Hits) {
+	dst.Cnt += src.Cnt
+	dst.Logs = append(dst.Logs, src.Logs...)
+	dst.Meta = append(dst.Meta, src.Meta...)
+	dst.Frames = append(dst.Frames, src.Frames...)
+}
+
+func appendFrame(dst *Hits, f HitFrame) {
+	dst.Cnt += 1
+	dst.Logs = append(dst.Logs, f.Logs...)
+	dst.Meta = append(dst.Meta, f.Meta...)
+	dst.Frames = append(dst.Frames, f)
+}
+
+func (k KeyT) newKeyFunc(pc *parseCacheT) (keyFuncT, error) {
+	switch k.Type {
+	case KeyStream:
+		return func(e LogEntry) (string, bool) {
+			return e.Stream, e.Stream != ""
+		}, nil
+	case KeyRegex:
+		return makeRegexKey(k.Value)
+	case KeyJqJson, KeyJqYaml:
+		return makeJqKey(k, pc)
+	default:
+		return nil, ErrKeyType
+	}
+}
+
+func makeRegexKey(term string) (keyFuncT, error) {
+	if term == "" {
+		return nil, ErrTermEmpty
+	}
+
+	exp, err := regexp.Compile(term)
+	if err != nil {
+		return nil, fmt.Errorf("%w type:'%s' value:'%s': %w", ErrTermCompile, KeyRegex.String(), term, err)
+	}
+
+	group := 0
+	if exp.NumSubexp() > 0 {
+		group = 1
+	}
+
+	return func(e LogEntry) (string, bool) {
+		m := exp.FindStringSubmatch(e.Line)
+		if m == nil || m[group] == "" {
+			return "", false
+		}
+		return m[group], true
+	}, nil
+}
+
+func makeJqKey(k KeyT, pc *parseCacheT) (keyFuncT, error) {
+	if k.Value == "" {
+		return nil, ErrTermEmpty
+	}
+
+	unmarshal := pc.unmarshal(TermJqJson)
+	if k.Type == KeyJqYaml {
+		unmarshal = pc.unmarshal(TermJqYaml)
+	}
+
+	code, err := compileJq(k.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w type:'%s' value:'%s': %w", ErrTermCompile, k.Type.String(), k.Value, err)
+	}
+
+	return func(e LogEntry) (string, bool) {
+		v, err := unmarshal(e.Line)
+		if err != nil {
+			return "", false
+		}
+
+		res, ok := code.Run(v).Next()
+		switch res := res.(type) {
+		case nil, error:
+			return "", false
+		case string:
+			return res, ok && res != ""
+		default:
+			return fmt.Sprint(res), ok
+		}
+	}, nil
+}
+
+func compileJq(term string) (*gojq.Code, error) {
+	query, err := gojq.Parse(term)
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(query)
+}
@@ -0,0 +1,225 @@
+package match
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func seqFactory(window int64, terms ...string) FactoryFunc {
+	return func() (Matcher, error) {
+		return NewMatchSeq(window, makeTerms(terms)...)
+	}
+}
+
+func frameKeys(hits Hits) (out []string) {
+	for _, f := range hits.All() {
+		out = append(out, f.Key)
+	}
+	return
+}
+
+func matchKeys(keys ...string) func(*testing.T, int, Hits) {
+	return func(t *testing.T, step int, hits Hits) {
+		t.Helper()
+		if got := frameKeys(hits); !slices.Equal(got, keys) {
+			t.Errorf("Step %v: Expected keys %v, got %v", step, keys, got)
+		}
+	}
+}
+
+func checkParts(n int) func(*testing.T, int, *MatchPartition) {
+	return func(t *testing.T, step int, sm *MatchPartition) {
+		t.Helper()
+		if sm.Len() != n {
+			t.Errorf("Step %v: Expected %v partitions, got %v", step, n, sm.Len())
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	type step = stepT[MatchPartition]
+
+	var tests = map[string]struct {
+		key     KeyT
+		factory FactoryFunc
+		opts    []OptT
+		steps   []step
+	}{
+		"Regex": {
+			// Beta on pod b must not complete alpha on pod a.
+			key:     KeyT{Type: KeyRegex, Value: `pod=(\w+)`},
+			factory: seqFactory(10, "alpha", "beta"),
+			steps: []step{
+				{line: "alpha pod=a"},
+				{line: "beta pod=b"},
+				{line: "alpha pod=b"},
+				{line: "beta pod=b", cb: matchKeys("b")},
+				{line: "beta pod=a", cb: matchStamps(1, 5)},
+			},
+		},
+
+		"NoKey": {
+			key:     KeyT{Type: KeyRegex, Value: `pod=(\w+)`},
+			factory: seqFactory(10, "alpha", "beta"),
+			steps: []step{
+				{line: "alpha"},
+				{line: "beta", postF: checkParts(0)},
+			},
+		},
+
+		"JqJson": {
+			key:     KeyT{Type: KeyJqJson, Value: `.pod`},
+			factory: seqFactory(10, "alpha", "beta"),
+			steps: []step{
+				{line: `{"msg": "alpha", "pod": "a"}`},
+				{line: `{"msg": "alpha", "pod": "b"}`},
+				{line: `{"msg": "beta", "pod": "a"}`, cb: matchKeys("a")},
+				{line: `{"msg": "beta"}`, postF: checkParts(2)},
+			},
+		},
+
+		"MaxKeys": {
+			// Pod a is least recently used and is evicted by pod c.
+			key:     KeyT{Type: KeyRegex, Value: `pod=(\w+)`},
+			factory: seqFactory(10, "alpha", "beta"),
+			opts:    []OptT{WithMaxKeys(2)},
+			steps: []step{
+				{line: "alpha pod=a"},
+				{line: "alpha pod=b"},
+				{line: "alpha pod=c", postF: checkParts(2)},
+				{line: "beta pod=a"},
+				{line: "beta pod=c", cb: matchStamps(3, 5)},
+			},
+		},
+
+		"Idle": {
+			key:     KeyT{Type: KeyRegex, Value: `pod=(\w+)`},
+			factory: seqFactory(100, "alpha", "beta"),
+			opts:    []OptT{WithIdle(5)},
+			steps: []step{
+				{line: "alpha pod=a", stamp: 1},
+				{line: "alpha pod=b", stamp: 4},
+				{postF: garbageCollect[*MatchPartition](7)},
+				{postF: checkParts(1)},
+				{line: "beta pod=a", stamp: 8},
+				{line: "beta pod=b", stamp: 9, cb: matchStamps(4, 9)},
+			},
+		},
+
+		"Eval": {
+			// Inverse sequence fires on Eval once the reset window lapses.
+			key: KeyT{Type: KeyRegex, Value: `pod=(\w+)`},
+			factory: func() (Matcher, error) {
+				return NewInverseSeq(10, makeTermsA("alpha", "beta"), []ResetT{{Term: makeRaw("reset"), Window: 5, Absolute: true}})
+			},
+			steps: []step{
+				{line: "alpha pod=a", stamp: 1},
+				{line: "beta pod=a", stamp: 2},
+				{line: "alpha pod=b", stamp: 3},
+				{line: "beta pod=b", stamp: 4},
+				{postF: checkEval[*MatchPartition](10, matchKeys("a", "b"))},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchPartition(tc.key, tc.factory, tc.opts...)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var clock int64
+			for idx, step := range tc.steps {
+				clock += 1
+				stamp := clock
+				if step.stamp != 0 {
+					stamp = step.stamp
+					clock = stamp
+				}
+
+				if step.line != "" {
+					hits := sm.Scan(LogEntry{Timestamp: stamp, Line: step.line})
+					if step.cb == nil {
+						checkNoFire(t, idx+1, hits)
+					} else {
+						step.cb(t, idx+1, hits)
+					}
+				}
+
+				if step.postF != nil {
+					step.postF(t, idx+1, sm)
+				}
+			}
+		})
+	}
+}
+
+func TestPartitionStream(t *testing.T) {
+	sm, err := NewMatchPartition(KeyT{Type: KeyStream}, seqFactory(10, "alpha", "beta"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha", Stream: "stdout"})
+	if hits := sm.Scan(LogEntry{Timestamp: 2, Line: "beta", Stream: "stderr"}); hits.Cnt != 0 {
+		t.Fatalf("Expected no hits, got %v", hits.Cnt)
+	}
+
+	hits := sm.Scan(LogEntry{Timestamp: 3, Line: "beta", Stream: "stdout"})
+	if hits.Cnt != 1 || !slices.Equal(frameKeys(hits), []string{"stdout"}) {
+		t.Fatalf("Expected 1 hit on stdout, got %v %v", hits.Cnt, frameKeys(hits))
+	}
+
+	if f := hits.PopFrame(); f.Key != "stdout" || hits.Cnt != 0 {
+		t.Errorf("Expected PopFrame to return the keyed frame, got %v", f)
+	}
+}
+
+func TestPartitionErrors(t *testing.T) {
+	if _, err := NewMatchPartition(KeyT{Type: KeyStream}, nil); err != ErrNilFactory {
+		t.Errorf("Expected ErrNilFactory, got %v", err)
+	}
+	if _, err := NewMatchPartition(KeyT{Type: KeyTypeT(99)}, seqFactory(10, "a")); err != ErrKeyType {
+		t.Errorf("Expected ErrKeyType, got %v", err)
+	}
+	if _, err := NewMatchPartition(KeyT{Type: KeyRegex, Value: "(["}, seqFactory(10, "a")); !errors.Is(err, ErrTermCompile) {
+		t.Errorf("Expected ErrTermCompile, got %v", err)
+	}
+	if _, err := NewMatchPartition(KeyT{Type: KeyStream}, seqFactory(10)); err != ErrNoTerms {
+		t.Errorf("Expected ErrNoTerms, got %v", err)
+	}
+}
+
+func TestPartitionDedupe(t *testing.T) {
+	factory := func() (Matcher, error) {
+		return NewMatchSingle(makeRaw("fail"))
+	}
+
+	pm, err := NewMatchPartition(KeyT{Type: KeyStream}, factory, WithDedupe(10))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 1, Line: "fail", Stream: "a"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 2, Line: "fail", Stream: "b"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 3, Line: "fail", Stream: "a"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 4, Line: "fail", Stream: "a"}))
+
+	// Each key fires once; the latest of a is pending.
+	if got := frameKeys(hits); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("Expected keys [a b], got %v", got)
+	}
+
+	// The pending hit of a fires once its window expires.
+	if hits := pm.Eval(10); hits.Cnt != 0 {
+		t.Errorf("Expected nothing before expiry, got %v", frameStamps(hits))
+	}
+	hits = pm.Eval(11)
+	if !slices.Equal(frameKeys(hits), []string{"a"}) || !reflect.DeepEqual(frameStamps(hits), [][]int64{{4}}) {
+		t.Errorf("Expected pending hit on a at 4, got %v %v", frameKeys(hits), frameStamps(hits))
+	}
+}
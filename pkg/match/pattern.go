@@ -0,0 +1,522 @@
+package match
+
+import (
+	"errors"
+	"math"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MatchPattern is a sequence whose steps may have alternatives, be skipped or
+// repeat, eg. A → (B | C) → D? → E or A → B{3,} → C.  It fires when every
+// required step has matched in order within the window.
+//
+// An entry satisfies the first step it can reach from a partial match: the
+// next step, or a later one if every step in between is optional.  Within a
+// step, the first alternative that matches wins.  The first step may be
+// optional; the last may not, since the pattern fires as soon as its last
+// step matches.
+//
+// A step repeats between Min and Max times, as in {Min,Max}; Max may be
+// Unbounded.  Once a step has its minimum, an entry that can move the match
+// on to a later step does so; otherwise it repeats the step up to its
+// maximum.  A repeated last step fires on its minimum.  An optional step that
+// repeats takes a minimum of one, ie. {0,Max}.
+//
+// The matcher keeps a run per partial match.  A run holds the first and the
+// latest entry of each step it matched and a count of the repetitions in
+// between, so a run is bounded by the number of steps whatever the
+// repetitions.  Every run advances on each entry, in the order the runs
+// started; the first to complete fires.  Runs that reach the same step and
+// count accept the same entries from then on, so only two are kept: the
+// oldest, which fires first on any entry that would complete both, and the
+// newest, which outlives it in the window.  Those in between are merged, ie.
+// dropped.  Counts past the minimum of an unbounded step are all the same, so
+// there are at most twice as many runs as steps plus their minimum
+// repetitions, whatever the input.  At most
+// WithMaxRuns runs are kept; the oldest are evicted beyond that.  The entries
+// of the frame are consumed: any other run that holds one is cut back to
+// before it.  Repetitions in between are not kept, and may count towards
+// another run.  Runs that started more than window before the clock are
+// garbage collected.
+//
+// Frames vary in size as optional steps may be skipped, so frames always carry
+// Meta, with or without WithHitMeta.  HitMeta.Term numbers the terms of all
+// steps in order, eg. for A → (B | C) → E, C is term 2; Step maps it back to
+// the step and alternative.  Stats.Matches is indexed the same way.  A step
+// that may repeat contributes its first entry and, if repeated, its latest;
+// both carry the number of repetitions in HitMeta.Count.
+//
+// Entries are taken in input order; WithOrder, WithGaps and WithSelect do not
+// apply, and captured fields are not correlated.
+
+var (
+	ErrStepEmpty    = errors.New("step has no terms")
+	ErrStepOptional = errors.New("last step cannot be optional")
+	ErrStepRepeat   = errors.New("invalid step repetition")
+)
+
+const (
+	Unbounded  = -1   // StepT.Max of a step that may repeat without limit
+	defMaxRuns = 1024 // See WithMaxRuns
+)
+
+type StepT struct {
+	Terms    []TermT // Alternatives; any one satisfies the step
+	Optional bool    // The step may be skipped
+	Min      int     // Minimum repetitions; zero is one
+	Max      int     // Maximum repetitions, or Unbounded; zero is Min
+}
+
+type patStepT struct {
+	first    int // Index of the first alternative in MatchPattern.matchers
+	cnt      int // Number of alternatives
+	min      int
+	max      int
+	optional bool
+}
+
+// Whether the step may match more than once.
+func (s patStepT) repeats() bool {
+	return s.max > 1
+}
+
+func newPatStep(step StepT, first int) (patStepT, error) {
+	s := patStepT{
+		first:    first,
+		cnt:      len(step.Terms),
+		min:      max(step.Min, 1),
+		max:      step.Max,
+		optional: step.Optional,
+	}
+
+	switch {
+	case step.Min < 0 || step.Max < Unbounded:
+		return s, ErrStepRepeat
+	case step.Optional && step.Min > 1:
+		return s, ErrStepRepeat
+	case step.Max == Unbounded:
+		s.max = math.MaxInt
+	case step.Max == 0:
+		s.max = s.min
+	case step.Max < s.min:
+		return s, ErrStepRepeat
+	}
+
+	return s, nil
+}
+
+type entryHitT struct {
+	LogEntry
+	seq  uint64 // Scan sequence; identifies the entry across runs
+	term int
+}
+
+type stepHitT struct {
+	first entryHitT
+	last  entryHitT // Latest repetition; unset unless cnt > 1
+	cnt   int
+	step  int
+}
+
+// Entries held; the first and, if repeated, the latest.
+func (h *stepHitT) entries() []entryHitT {
+	if h.cnt > 1 {
+		return []entryHitT{h.first, h.last}
+	}
+	return []entryHitT{h.first}
+}
+
+func (h *stepHitT) size() int {
+	if h.cnt > 1 {
+		return h.first.Size() + h.last.Size()
+	}
+	return h.first.Size()
+}
+
+type runT struct {
+	hits []stepHitT // One per step matched, in order
+}
+
+// Runs with equal keys accept the same entries from here on.
+type runKeyT struct {
+	step int
+	cnt  int
+}
+
+// Past its minimum, the count of an unbounded step no longer matters.
+func (r *MatchPattern) key(run runT) runKeyT {
+	var (
+		h    = run.hits[len(run.hits)-1]
+		step = r.steps[h.step]
+		cnt  = h.cnt
+	)
+
+	if step.max == math.MaxInt {
+		cnt = min(cnt, step.min)
+	}
+	return runKeyT{step: h.step, cnt: cnt}
+}
+
+// Next step to match, or the step being repeated.
+func (run *runT) pos() int {
+	if len(run.hits) == 0 {
+		return 0
+	}
+	return run.hits[len(run.hits)-1].step + 1
+}
+
+type MatchPattern struct {
+	clock    int64
+	window   int64
+	seq      uint64
+	bytes    int
+	steps    []patStepT
+	matchers []EntryMatchFunc
+	cache    []int8 // Per term result of the current entry; 0 if not yet run
+	runs     []runT // In the order they started
+	maxRuns  int
+	seen     map[runKeyT]struct{} // Scratch for merge
+	last     map[runKeyT]int      // Scratch for merge
+	meta     hitMetaT
+	trace    tracerT
+}
+
+func NewMatchPattern(window int64, steps []StepT, opts ...OptT) (*MatchPattern, error) {
+	var (
+		o        = parseOpts(opts)
+		nSteps   = len(steps)
+		stepL    = make([]patStepT, nSteps)
+		terms    []TermT
+		matchers []EntryMatchFunc
+	)
+
+	switch {
+	case nSteps > maxTerms:
+		return nil, ErrTooManyTerms
+	case nSteps == 0:
+		return nil, ErrNoTerms
+	case steps[nSteps-1].Optional:
+		return nil, ErrStepOptional
+	}
+
+	for i, step := range steps {
+		if len(step.Terms) == 0 {
+			return nil, ErrStepEmpty
+		}
+
+		s, err := newPatStep(step, len(terms))
+		if err != nil {
+			return nil, err
+		}
+		stepL[i] = s
+
+		for _, term := range step.Terms {
+			m, err := o.newMatcher(term)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+			terms = append(terms, term)
+		}
+	}
+
+	meta, err := newHitMeta(o, terms, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Frames need the term of each entry regardless; see above.
+	if meta == nil {
+		meta = make(hitMetaT, len(terms))
+		for i := range meta {
+			meta[i].term = i
+		}
+	}
+
+	return &MatchPattern{
+		window:   window,
+		steps:    stepL,
+		matchers: matchers,
+		cache:    make([]int8, len(terms)),
+		maxRuns:  o.maxRuns,
+		seen:     make(map[runKeyT]struct{}),
+		last:     make(map[runKeyT]int),
+		meta:     meta,
+		trace:    newTracer(o, len(terms), nil),
+	}, nil
+}
+
+// Step returns the step and alternative of term, as numbered in HitMeta.Term.
+func (r *MatchPattern) Step(term int) (step, alt int) {
+	for i, s := range r.steps {
+		if term < s.first+s.cnt {
+			return i, term - s.first
+		}
+	}
+	return NoTerm, NoTerm
+}
+
+func (r *MatchPattern) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
+	if e.Timestamp < r.clock {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("MatchPattern: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
+		return
+	}
+	r.clock = e.Timestamp
+	r.seq += 1
+	clear(r.cache)
+
+	for term := range r.matchers {
+		if r.match(term, e) {
+			r.trace.match(term)
+		}
+	}
+
+	r.maybeGC(e.Timestamp)
+
+	var moved bool
+	for i := range r.runs {
+		if r.advance(&r.runs[i], e) {
+			if r.done(r.runs[i]) {
+				return r.fire(i)
+			}
+			moved = true
+		}
+	}
+
+	// Start a new run on the entry.
+	var run runT
+	if r.advance(&run, e) {
+		r.runs = append(r.runs, run)
+		if r.done(run) {
+			return r.fire(len(r.runs) - 1)
+		}
+		moved = true
+	}
+
+	if moved {
+		r.merge()
+		r.limit()
+	}
+	return
+}
+
+// Whether the last step of run has its minimum.
+func (r *MatchPattern) done(run runT) bool {
+	last := len(r.steps) - 1
+	h := run.hits[len(run.hits)-1]
+	return h.step == last && h.cnt >= r.steps[last].min
+}
+
+// Whether e satisfies term; the result is cached for the current entry.
+func (r *MatchPattern) match(term int, e LogEntry) bool {
+	if r.cache[term] == 0 {
+		r.cache[term] = -1
+		if r.matchers[term](e) {
+			r.cache[term] = 1
+		}
+	}
+	return r.cache[term] > 0
+}
+
+// The first alternative of step s that e satisfies.
+func (r *MatchPattern) matchStep(s int, e LogEntry) (int, bool) {
+	step := r.steps[s]
+	for term := step.first; term < step.first+step.cnt; term++ {
+		if r.match(term, e) {
+			return term, true
+		}
+	}
+	return NoTerm, false
+}
+
+// Advance run on e to the first step it can reach, or else repeat the
+// current step; false if neither.
+func (r *MatchPattern) advance(run *runT, e LogEntry) bool {
+	var cur *stepHitT
+	if n := len(run.hits); n > 0 {
+		cur = &run.hits[n-1]
+	}
+
+	// The current step must have its minimum before the run moves on.
+	if cur == nil || cur.cnt >= r.steps[cur.step].min {
+		for s := run.pos(); s < len(r.steps); s++ {
+			if term, ok := r.matchStep(s, e); ok {
+				h := entryHitT{LogEntry: e, seq: r.seq, term: term}
+				run.hits = append(run.hits, stepHitT{first: h, cnt: 1, step: s})
+				r.bytes += e.Size()
+				r.trace.assert(r.clock, term, e)
+				return true
+			}
+
+			if !r.steps[s].optional {
+				break
+			}
+		}
+	}
+
+	if cur == nil || cur.cnt >= r.steps[cur.step].max {
+		return false
+	}
+
+	term, ok := r.matchStep(cur.step, e)
+	if !ok {
+		return false
+	}
+
+	r.bytes -= cur.size()
+	cur.last = entryHitT{LogEntry: e, seq: r.seq, term: term}
+	cur.cnt += 1
+	r.bytes += cur.size()
+	r.trace.assert(r.clock, term, e)
+	return true
+}
+
+// Fire the run at idx and consume its entries.
+func (r *MatchPattern) fire(idx int) (hits Hits) {
+	var (
+		done = r.runs[idx]
+		used = make(map[uint64]struct{}, len(done.hits))
+	)
+
+	hits.Logs = make([]LogEntry, 0, len(done.hits))
+	for _, h := range done.hits {
+		r.bytes -= h.size()
+		for _, e := range h.entries() {
+			r.meta.add(&hits, e.LogEntry, e.term)
+			if r.steps[h.step].repeats() {
+				hits.Meta[len(hits.Meta)-1].Count = h.cnt
+			}
+			used[e.seq] = struct{}{}
+		}
+	}
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, hits)
+
+	// Cut back runs that share an entry with the frame.
+	runs := r.runs[:0]
+	for i, run := range r.runs {
+		if i == idx {
+			continue
+		}
+
+	HITS:
+		for k, h := range run.hits {
+			for _, e := range h.entries() {
+				if _, ok := used[e.seq]; ok {
+					run = r.cut(run, k)
+					break HITS
+				}
+			}
+		}
+
+		if len(run.hits) > 0 {
+			runs = append(runs, run)
+		}
+	}
+
+	clear(r.runs[len(runs):])
+	r.runs = runs
+	r.merge()
+	return
+}
+
+// Drop the hits of run from k on.
+func (r *MatchPattern) cut(run runT, k int) runT {
+	r.drop(run.hits[k:], DropStale)
+	run.hits = run.hits[:k]
+	return run
+}
+
+func (r *MatchPattern) drop(hits []stepHitT, reason DropReasonT) {
+	for _, h := range hits {
+		r.bytes -= h.size()
+		for _, e := range h.entries() {
+			r.trace.drop(r.clock, reason, e.term, 1)
+		}
+	}
+}
+
+// Drop runs that have the key of both an older and a newer run.
+func (r *MatchPattern) merge() {
+	clear(r.last)
+	clear(r.seen)
+	for i, run := range r.runs {
+		r.last[r.key(run)] = i
+	}
+
+	runs := r.runs[:0]
+	for i, run := range r.runs {
+		k := r.key(run)
+		if _, ok := r.seen[k]; ok && r.last[k] != i {
+			r.drop(run.hits, DropStale)
+			continue
+		}
+		r.seen[k] = struct{}{}
+		runs = append(runs, run)
+	}
+
+	clear(r.runs[len(runs):])
+	r.runs = runs
+}
+
+// Evict the oldest runs over maxRuns.
+func (r *MatchPattern) limit() {
+	cnt := len(r.runs) - r.maxRuns
+	if cnt <= 0 {
+		return
+	}
+
+	for _, run := range r.runs[:cnt] {
+		r.drop(run.hits, DropLimit)
+	}
+
+	n := copy(r.runs, r.runs[cnt:])
+	clear(r.runs[n:])
+	r.runs = r.runs[:n]
+}
+
+func (r *MatchPattern) maybeGC(clock int64) {
+	if len(r.runs) == 0 || clock-r.runs[0].hits[0].first.Timestamp <= r.window {
+		return
+	}
+	r.GarbageCollect(clock)
+}
+
+// Remove all runs that started more than window before clock.
+func (r *MatchPattern) GarbageCollect(clock int64) {
+	var (
+		cnt      int
+		deadline = clock - r.window
+	)
+
+	for _, run := range r.runs {
+		if run.hits[0].first.Timestamp >= deadline {
+			break
+		}
+		for _, h := range run.hits {
+			r.bytes -= h.size()
+			for _, e := range h.entries() {
+				r.trace.gc(clock, e.term, 1)
+			}
+		}
+		cnt += 1
+	}
+
+	if cnt > 0 {
+		n := copy(r.runs, r.runs[cnt:])
+		clear(r.runs[n:])
+		r.runs = r.runs[:n]
+	}
+}
+
+// Because match pattern is edge triggered, there won't be hits.
+func (r *MatchPattern) Eval(clock int64) (h Hits) {
+	return
+}
@@ -0,0 +1,451 @@
+package match
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func anyOf(terms ...string) StepT {
+	return StepT{Terms: makeTermsA(terms...)}
+}
+
+func optional(terms ...string) StepT {
+	return StepT{Terms: makeTermsA(terms...), Optional: true}
+}
+
+func frameTerms(hits Hits) (out [][]int) {
+	for i := range hits.Cnt {
+		var terms []int
+		for _, m := range hits.Frame(i).Meta {
+			terms = append(terms, m.Term)
+		}
+		out = append(out, terms)
+	}
+	return
+}
+
+func TestPattern(t *testing.T) {
+	// alpha → (beta | gamma) → delta? → epsilon
+	steps := []StepT{anyOf("alpha"), anyOf("beta", "gamma"), optional("delta"), anyOf("epsilon")}
+
+	tests := map[string]struct {
+		lines  []string
+		stamps [][]int64
+		terms  [][]int
+	}{
+		"first": {
+			lines:  []string{"alpha", "beta", "delta", "epsilon"},
+			stamps: [][]int64{{0, 1, 2, 3}},
+			terms:  [][]int{{0, 1, 3, 4}},
+		},
+		"second": {
+			lines:  []string{"alpha", "gamma", "delta", "epsilon"},
+			stamps: [][]int64{{0, 1, 2, 3}},
+			terms:  [][]int{{0, 2, 3, 4}},
+		},
+		"skip": {
+			lines:  []string{"alpha", "gamma", "epsilon"},
+			stamps: [][]int64{{0, 1, 2}},
+			terms:  [][]int{{0, 2, 4}},
+		},
+		"missing": {
+			lines: []string{"alpha", "delta", "epsilon"},
+		},
+		"outOfOrder": {
+			lines: []string{"beta", "alpha", "epsilon"},
+		},
+		"dupes": {
+			lines:  []string{"alpha", "beta", "beta", "delta", "delta", "epsilon", "epsilon"},
+			stamps: [][]int64{{0, 1, 3, 5}},
+			terms:  [][]int{{0, 1, 3, 4}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pm, err := NewMatchPattern(10, steps)
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var hits Hits
+			for i, line := range tc.lines {
+				appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+			}
+
+			if got := frameStamps(hits); !reflect.DeepEqual(got, tc.stamps) {
+				t.Errorf("Expected stamps %v, got %v", tc.stamps, got)
+			}
+			if got := frameTerms(hits); !reflect.DeepEqual(got, tc.terms) {
+				t.Errorf("Expected terms %v, got %v", tc.terms, got)
+			}
+		})
+	}
+}
+
+func TestPatternStep(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), anyOf("beta", "gamma"), anyOf("epsilon")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	for term, want := range [][2]int{{0, 0}, {1, 0}, {1, 1}, {2, 0}, {NoTerm, NoTerm}} {
+		if step, alt := pm.Step(term); step != want[0] || alt != want[1] {
+			t.Errorf("Term %d: expected %v, got %d:%d", term, want, step, alt)
+		}
+	}
+}
+
+func TestPatternLeadingOptional(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{optional("alpha"), anyOf("beta")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 1, Line: "beta"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 2, Line: "alpha"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 3, Line: "beta"}))
+
+	want := [][]int64{{1}, {2, 3}}
+	if got := frameStamps(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if st := pm.Stats(); st.Asserts != 0 || st.Bytes != 0 {
+		t.Errorf("Expected nothing buffered, got %+v", st)
+	}
+}
+
+// Runs in the same state keep the oldest and the newest; those between merge.
+func TestPatternMerge(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), anyOf("beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	for i, line := range []string{"alpha", "alpha", "alpha", "beta", "gamma"} {
+		appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+	}
+
+	want := [][]int64{{0, 3, 4}}
+	if got := frameStamps(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// The second alpha is merged; the newest run is cut back to its alpha.
+	st := pm.Stats()
+	if st.Hits != 1 || st.DropStale != 2 || st.Asserts != 1 {
+		t.Errorf("Expected the second alpha merged, got %+v", st)
+	}
+}
+
+// The newest run in a state fires once the oldest leaves the window.
+func TestPatternMergeWindow(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), anyOf("beta")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 0, Line: "alpha"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 8, Line: "alpha"}))
+	appendHits(&hits, pm.Scan(LogEntry{Timestamp: 12, Line: "beta"}))
+
+	want := [][]int64{{8, 12}}
+	if got := frameStamps(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestPatternMaxRuns(t *testing.T) {
+	var evicted int
+	trace := func(ev TraceEvent) {
+		if ev.Kind == TraceDrop && ev.Reason == DropLimit {
+			evicted += ev.Count
+		}
+	}
+
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), repeat(1, 5, "beta"), anyOf("gamma")}, WithMaxRuns(2), WithTracer(trace))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	for i, line := range []string{"alpha", "beta", "alpha", "beta", "alpha", "gamma"} {
+		appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+	}
+
+	// The first run is evicted with its three entries.
+	want := [][]int64{{2, 3, 5}}
+	if got := frameStamps(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if st := pm.Stats(); evicted != 3 || st.DropLimit != 3 {
+		t.Errorf("Expected 3 evicted, got %d %+v", evicted, st)
+	}
+}
+
+func TestPatternWindow(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), optional("beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 0, Line: "alpha"})
+	pm.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+	pm.Scan(LogEntry{Timestamp: 8, Line: "alpha"})
+
+	if hits := pm.Scan(LogEntry{Timestamp: 11, Line: "gamma"}); !reflect.DeepEqual(frameStamps(hits), [][]int64{{8, 11}}) {
+		t.Errorf("Expected [[8 11]], got %v", frameStamps(hits))
+	}
+
+	if st := pm.Stats(); st.DropGC != 2 || st.Asserts != 0 {
+		t.Errorf("Expected the first run collected, got %+v", st)
+	}
+}
+
+func TestPatternHitMeta(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), anyOf("beta", "gamma")}, WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	hits := pm.Scan(LogEntry{Timestamp: 2, Line: "gamma"})
+
+	if got := frameTerms(hits); !reflect.DeepEqual(got, [][]int{{0, 2}}) {
+		t.Errorf("Expected [[0 2]], got %v", got)
+	}
+	if f := hits.Frame(0); len(f.Logs[1].Matches) != 1 {
+		t.Errorf("Expected gamma span, got %v", f.Logs[1].Matches)
+	}
+}
+
+func repeat(min, max int, terms ...string) StepT {
+	return StepT{Terms: makeTermsA(terms...), Min: min, Max: max}
+}
+
+func frameCounts(hits Hits) (out [][]int) {
+	for i := range hits.Cnt {
+		var cnts []int
+		for _, m := range hits.Frame(i).Meta {
+			cnts = append(cnts, m.Count)
+		}
+		out = append(out, cnts)
+	}
+	return
+}
+
+func TestPatternRepeat(t *testing.T) {
+	tests := map[string]struct {
+		step   StepT
+		lines  []string
+		stamps [][]int64
+		counts [][]int
+	}{
+		"exact": {
+			step:   repeat(3, 0, "beta"),
+			lines:  []string{"alpha", "beta", "beta", "beta", "gamma"},
+			stamps: [][]int64{{0, 1, 3, 4}},
+			counts: [][]int{{0, 3, 3, 0}},
+		},
+		"exactShort": {
+			step:  repeat(3, 0, "beta"),
+			lines: []string{"alpha", "beta", "beta", "gamma"},
+		},
+		"exactOver": {
+			step:  repeat(2, 0, "beta"),
+			lines: []string{"alpha", "beta", "beta", "beta", "gamma"},
+			// The third beta cannot repeat the step, nor be skipped.
+			stamps: [][]int64{{0, 1, 2, 4}},
+			counts: [][]int{{0, 2, 2, 0}},
+		},
+		"range": {
+			step:   repeat(2, 3, "beta"),
+			lines:  []string{"alpha", "beta", "beta", "beta", "beta", "gamma"},
+			stamps: [][]int64{{0, 1, 3, 5}},
+			counts: [][]int{{0, 3, 3, 0}},
+		},
+		"atLeast": {
+			step:   repeat(3, Unbounded, "beta"),
+			lines:  []string{"alpha", "beta", "beta", "beta", "beta", "beta", "gamma"},
+			stamps: [][]int64{{0, 1, 5, 6}},
+			counts: [][]int{{0, 5, 5, 0}},
+		},
+		"once": {
+			step:   repeat(1, Unbounded, "beta"),
+			lines:  []string{"alpha", "beta", "gamma"},
+			stamps: [][]int64{{0, 1, 2}},
+			counts: [][]int{{0, 1, 0}},
+		},
+		"optional": {
+			step:   StepT{Terms: makeTermsA("beta"), Optional: true, Max: 2},
+			lines:  []string{"alpha", "gamma", "alpha", "beta", "beta", "gamma"},
+			stamps: [][]int64{{0, 1}, {2, 3, 4, 5}},
+			counts: [][]int{{0, 0}, {0, 2, 2, 0}},
+		},
+		"alternatives": {
+			step:   repeat(3, Unbounded, "beta", "delta"),
+			lines:  []string{"alpha", "beta", "delta", "delta", "gamma"},
+			stamps: [][]int64{{0, 1, 3, 4}},
+			counts: [][]int{{0, 3, 3, 0}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pm, err := NewMatchPattern(100, []StepT{anyOf("alpha"), tc.step, anyOf("gamma")})
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			var hits Hits
+			for i, line := range tc.lines {
+				appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+			}
+
+			if got := frameStamps(hits); !reflect.DeepEqual(got, tc.stamps) {
+				t.Errorf("Expected stamps %v, got %v", tc.stamps, got)
+			}
+			if got := frameCounts(hits); !reflect.DeepEqual(got, tc.counts) {
+				t.Errorf("Expected counts %v, got %v", tc.counts, got)
+			}
+		})
+	}
+}
+
+// A repeated last step fires on its minimum.
+func TestPatternRepeatLast(t *testing.T) {
+	pm, err := NewMatchPattern(100, []StepT{anyOf("alpha"), repeat(3, Unbounded, "beta")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	for i, line := range []string{"alpha", "beta", "beta", "beta", "beta"} {
+		appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+	}
+
+	if got := frameStamps(hits); !reflect.DeepEqual(got, [][]int64{{0, 1, 3}}) {
+		t.Errorf("Expected [[0 1 3]], got %v", got)
+	}
+}
+
+// Memory does not grow with the repetitions.
+func TestPatternRepeatBounded(t *testing.T) {
+	pm, err := NewMatchPattern(1_000_000, []StepT{anyOf("alpha"), repeat(3, Unbounded, "beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 0, Line: "alpha"})
+	for i := range 10_000 {
+		pm.Scan(LogEntry{Timestamp: int64(i + 1), Line: "beta"})
+	}
+
+	st := pm.Stats()
+	if st.Asserts != 3 || st.Matches[1] != 10_000 {
+		t.Errorf("Expected first and last beta buffered, got %+v", st)
+	}
+
+	hits := pm.Scan(LogEntry{Timestamp: 10_001, Line: "gamma"})
+	if got := frameCounts(hits); !reflect.DeepEqual(got, [][]int{{0, 10_000, 10_000, 0}}) {
+		t.Errorf("Expected a count of 10000, got %v", got)
+	}
+	if st := pm.Stats(); st.Asserts != 0 || st.Bytes != 0 {
+		t.Errorf("Expected nothing buffered, got %+v", st)
+	}
+}
+
+// Runs do not grow with interleaved starts and repetitions.
+func TestPatternRepeatRuns(t *testing.T) {
+	pm, err := NewMatchPattern(1_000_000, []StepT{anyOf("alpha"), repeat(3, Unbounded, "beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var clock int64
+	for range 10_000 {
+		pm.Scan(LogEntry{Timestamp: clock, Line: "alpha"})
+		pm.Scan(LogEntry{Timestamp: clock + 1, Line: "beta"})
+		clock += 2
+	}
+
+	if n := len(pm.runs); n > 8 {
+		t.Errorf("Expected at most 8 runs, got %d", n)
+	}
+
+	hits := pm.Scan(LogEntry{Timestamp: clock, Line: "gamma"})
+	if got := frameCounts(hits); !reflect.DeepEqual(got, [][]int{{0, 10_000, 10_000, 0}}) {
+		t.Errorf("Expected a count of 10000, got %v", got)
+	}
+}
+
+// A later run past the minimum fires once the older one leaves the window.
+func TestPatternRepeatWindow(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), repeat(3, Unbounded, "beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var (
+		hits  Hits
+		lines = []string{"alpha", "beta", "beta", "alpha", "beta", "beta", "beta", "gamma"}
+		stamp = []int64{0, 1, 2, 5, 6, 7, 8, 14}
+	)
+
+	for i, line := range lines {
+		appendHits(&hits, pm.Scan(LogEntry{Timestamp: stamp[i], Line: line}))
+	}
+
+	if got := frameStamps(hits); !reflect.DeepEqual(got, [][]int64{{5, 6, 8, 14}}) {
+		t.Errorf("Expected [[5 6 8 14]], got %v", got)
+	}
+	if got := frameCounts(hits); !reflect.DeepEqual(got, [][]int{{0, 3, 3, 0}}) {
+		t.Errorf("Expected a count of 3, got %v", got)
+	}
+}
+
+// A run that shares a kept repetition with a frame is cut back.
+func TestPatternRepeatConsume(t *testing.T) {
+	pm, err := NewMatchPattern(100, []StepT{anyOf("alpha"), repeat(3, Unbounded, "beta"), anyOf("gamma")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var hits Hits
+	for i, line := range []string{"alpha", "beta", "alpha", "beta", "beta", "gamma", "beta", "beta", "beta", "gamma"} {
+		appendHits(&hits, pm.Scan(LogEntry{Timestamp: int64(i), Line: line}))
+	}
+
+	want := [][]int64{{0, 1, 4, 5}, {2, 6, 8, 9}}
+	if got := frameStamps(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := map[string]struct {
+		steps []StepT
+		err   error
+	}{
+		"none":     {err: ErrNoTerms},
+		"empty":    {steps: []StepT{anyOf("alpha"), {}}, err: ErrStepEmpty},
+		"optional": {steps: []StepT{anyOf("alpha"), optional("beta")}, err: ErrStepOptional},
+		"term":     {steps: []StepT{{Terms: []TermT{{Type: TermRegex, Value: "("}}}}, err: ErrTermCompile},
+		"minMax":   {steps: []StepT{repeat(3, 2, "alpha")}, err: ErrStepRepeat},
+		"negative": {steps: []StepT{repeat(-1, 0, "alpha")}, err: ErrStepRepeat},
+		"maxRange": {steps: []StepT{repeat(1, -2, "alpha")}, err: ErrStepRepeat},
+		"optMin":   {steps: []StepT{{Terms: makeTermsA("alpha"), Optional: true, Min: 2}, anyOf("beta")}, err: ErrStepRepeat},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMatchPattern(10, tc.steps); !errors.Is(err, tc.err) {
+				t.Errorf("Expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
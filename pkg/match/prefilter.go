@@ -0,0 +1,160 @@
+package match
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prequel-dev/prequel-logmatch/internal/pkg/ahocorasick"
+)
+
+// The prefilter finds the literals required by raw and regex terms in a single
+// Aho-Corasick pass over the line.  A term whose literal is absent cannot match,
+// so its MatchFunc is skipped.  A raw term matches if and only if its literal is
+// present, so it is never evaluated at all.
+
+type prefilterT struct {
+	lits  []string
+	ids   map[string]int
+	ac    *ahocorasick.Automaton // nil if a literal was added since the last build
+	line  string
+	valid bool
+	gen   uint32
+	found []uint32 // found[id] == gen if lits[id] is in line
+}
+
+// Register a literal; returns its id.
+func (p *prefilterT) add(lit string) int {
+	if id, ok := p.ids[lit]; ok {
+		return id
+	}
+	if p.ids == nil {
+		p.ids = make(map[string]int)
+	}
+
+	id := len(p.lits)
+	p.ids[lit] = id
+	p.lits = append(p.lits, lit)
+	p.found = append(p.found, 0)
+	p.ac = nil
+	return id
+}
+
+// Returns true if literal id is present in line.
+func (p *prefilterT) present(id int, line string) bool {
+	if !p.valid || p.line != line {
+		p.scan(line)
+	}
+	return p.found[id] == p.gen
+}
+
+func (p *prefilterT) scan(line string) {
+	if p.ac == nil {
+		p.ac = ahocorasick.Build(p.lits)
+	}
+
+	p.gen += 1
+	if p.gen == 0 {
+		// Wrapped; stale marks would alias the new generation.
+		clear(p.found)
+		p.gen = 1
+	}
+
+	p.line = line
+	p.valid = true
+	p.ac.Scan(line, func(id int) {
+		p.found[id] = p.gen
+	})
+}
+
+// Returns the literal that every match of term must contain, and whether the
+// literal alone decides the match.  Returns "" if there is no such literal.
+func requiredLiteral(term TermT) (lit string, exact bool) {
+	switch term.Type {
+	case TermRaw:
+		return term.Value, true
+	case TermRegex:
+		re, err := syntax.Parse(term.Value, syntax.Perl)
+		if err != nil {
+			return "", false
+		}
+		lit = requiredRegexLiteral(re.Simplify())
+		if strings.ContainsRune(lit, utf8.RuneError) {
+			// The regexp matches invalid UTF-8 in the line as RuneError;
+			// the encoded literal would not be found.
+			return "", false
+		}
+		return lit, false
+	}
+	return "", false
+}
+
+// Returns the longest literal required by any match of re.
+func requiredRegexLiteral(re *syntax.Regexp) string {
+	if s, ok := exactLiteral(re); ok {
+		return s
+	}
+
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredRegexLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredRegexLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var (
+			best string
+			run  strings.Builder
+		)
+
+		// Adjacent exact subexpressions form a single literal.
+		flush := func() {
+			if run.Len() > len(best) {
+				best = run.String()
+			}
+			run.Reset()
+		}
+
+		for _, sub := range re.Sub {
+			if s, ok := exactLiteral(sub); ok {
+				run.WriteString(s)
+				continue
+			}
+			flush()
+			if s := requiredRegexLiteral(sub); len(s) > len(best) {
+				best = s
+			}
+		}
+		flush()
+		return best
+	}
+
+	return ""
+}
+
+// Returns the single string matched by re, if any.
+func exactLiteral(re *syntax.Regexp) (string, bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return "", false
+		}
+		return string(re.Rune), true
+	case syntax.OpEmptyMatch:
+		return "", true
+	case syntax.OpCapture:
+		return exactLiteral(re.Sub[0])
+	case syntax.OpConcat:
+		var sb strings.Builder
+		for _, sub := range re.Sub {
+			s, ok := exactLiteral(sub)
+			if !ok {
+				return "", false
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,143 @@
+package match
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRequiredLiteral(t *testing.T) {
+	var tests = map[string]struct {
+		term  TermT
+		lit   string
+		exact bool
+	}{
+		"Raw":         {term: makeRaw("alpha beta"), lit: "alpha beta", exact: true},
+		"Literal":     {term: regexTerm("alpha"), lit: "alpha"},
+		"Concat":      {term: regexTerm(`pod \w+ OOMKilled`), lit: " OOMKilled"},
+		"Capture":     {term: regexTerm(`req=(?P<req>abc)def`), lit: "req=abcdef"},
+		"Plus":        {term: regexTerm(`(abc)+`), lit: "abc"},
+		"Repeat":      {term: regexTerm(`(abcd){2,3}x`), lit: "abcdabcd"},
+		"Optional":    {term: regexTerm(`(abc)?x`), lit: "x"},
+		"Star":        {term: regexTerm(`(abc)*`), lit: ""},
+		"Alternate":   {term: regexTerm(`alpha|beta`), lit: ""},
+		"FoldCase":    {term: regexTerm(`(?i)alpha`), lit: ""},
+		"Class":       {term: regexTerm(`[ab]c`), lit: "c"},
+		"Anchors":     {term: regexTerm(`^start\b`), lit: "start"},
+		"Unicode":     {term: regexTerm(`héllo\d`), lit: "héllo"},
+		"RuneError":   {term: regexTerm("�abc"), lit: ""},
+		"Jq":          {term: TermT{Type: TermJqJson, Value: ".a"}, lit: ""},
+		"EmptyRegexp": {term: regexTerm(`()`), lit: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lit, exact := requiredLiteral(tc.term)
+			if lit != tc.lit || exact != tc.exact {
+				t.Errorf("Expected %q %v, got %q %v", tc.lit, tc.exact, lit, exact)
+			}
+		})
+	}
+}
+
+// The prefiltered term cache must produce exactly the same results as
+// compiling each term on its own.
+func TestPrefilterEquivalence(t *testing.T) {
+	var (
+		rng   = rand.New(rand.NewSource(7))
+		words = []string{"alpha", "beta", "gamma", "pod", "OOM", "req=", "é", "\xff", "12", " "}
+		terms = []TermT{
+			regexTerm(`alpha`),
+			regexTerm(`alpha|beta`),
+			regexTerm(`(?i)oom`),
+			regexTerm(`req=(?P<req>\d+)`),
+			regexTerm(`^pod\b`),
+			regexTerm(`gamma$`),
+			regexTerm(`(beta){2}`),
+			regexTerm(`(alpha)?beta`),
+			regexTerm(`é\d`),
+			regexTerm(`.`),
+			regexTerm(`pod.*OOM`),
+			regexTerm(`[^a]lpha`),
+			regexTerm(`\x{FFFD}`),
+		}
+	)
+
+	for _, w := range words {
+		terms = append(terms, makeRaw(w), makeRaw(w+w))
+	}
+
+	cache := NewTermCache()
+
+	var (
+		direct = make([]MatchFunc, len(terms))
+		cached = make([]MatchFunc, len(terms))
+	)
+
+	for i, term := range terms {
+		var err error
+		if direct[i], err = term.NewMatcher(); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		if cached[i], err = cache.matcher(term); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+	}
+
+	for range 5000 {
+		var sb strings.Builder
+		for range rng.Intn(8) {
+			sb.WriteString(words[rng.Intn(len(words))])
+		}
+		line := sb.String()
+
+		for i, term := range terms {
+			if got, want := cached[i](line), direct[i](line); got != want {
+				t.Fatalf("Term %q on line %q: expected %v, got %v", term.Value, line, want, got)
+			}
+		}
+	}
+}
+
+// Terms added after the automaton is built must be picked up.
+func TestPrefilterLateTerm(t *testing.T) {
+	cache := NewTermCache()
+
+	alpha, _ := cache.matcher(makeRaw("alpha"))
+	if !alpha("alpha") {
+		t.Fatalf("Expected match on alpha")
+	}
+
+	beta, _ := cache.matcher(makeRaw("beta"))
+	if !beta("alpha beta") || !alpha("alpha beta") {
+		t.Fatalf("Expected match on alpha beta")
+	}
+}
+
+func BenchmarkPrefilterMiss(b *testing.B) {
+	cache := NewTermCache()
+
+	var matchers []MatchFunc
+	for i := range 500 {
+		m, err := cache.matcher(regexTerm(fmt.Sprintf(`error code=%d \w+`, i)))
+		if err != nil {
+			b.Fatalf("Expected err == nil, got %v", err)
+		}
+		matchers = append(matchers, m)
+	}
+
+	lines := []string{
+		"2024-01-01T00:00:00Z INFO request served in 12ms path=/healthz",
+		"2024-01-01T00:00:01Z INFO request served in 10ms path=/metrics",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		line := lines[i%len(lines)]
+		for _, m := range matchers {
+			m(line)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package match
+
+import (
+	"errors"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/scanner"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrLateness = errors.New("invalid lateness")
+)
+
+// MatchReorder tolerates entries that arrive out of order by up to lateness.
+// Entries are held in a scanner.ReorderT and passed to the wrapped matcher in
+// timestamp order once the clock has moved lateness past them, so hits are
+// delayed by lateness.  Entries later than that are rejected and counted as
+// out of order; Eval and GarbageCollect are passed on lateness behind the
+// clock.  Call Flush at the end of a stream to release the held entries.
+
+type MatchReorder struct {
+	clock    int64
+	lateness int64
+	held     int // Entries held in the reorder buffer
+	bytes    int // Estimated size of held entries
+	matcher  Matcher
+	reorder  *scanner.ReorderT
+	hits     Hits // Hits of entries released by the current call
+	trace    tracerT
+}
+
+func NewMatchReorder(lateness int64, m Matcher, opts ...OptT) (*MatchReorder, error) {
+	switch {
+	case m == nil:
+		return nil, ErrNilMatcher
+	case lateness <= 0:
+		return nil, ErrLateness
+	}
+
+	r := &MatchReorder{
+		lateness: lateness,
+		matcher:  m,
+		trace:    newTracer(parseOpts(opts), 0, nil),
+	}
+
+	reorder, err := scanner.NewReorder(lateness, r.release)
+	if err != nil {
+		return nil, err
+	}
+	r.reorder = reorder
+
+	return r, nil
+}
+
+func (r *MatchReorder) release(e LogEntry) bool {
+	r.held -= 1
+	r.bytes -= e.Size()
+	appendHits(&r.hits, r.matcher.Scan(e))
+	return false
+}
+
+// Take the hits released by the current call.
+func (r *MatchReorder) take() (hits Hits) {
+	hits, r.hits = r.hits, Hits{}
+	return
+}
+
+func (r *MatchReorder) Scan(e LogEntry) Hits {
+	r.trace.scan()
+
+	// Same test as the reorder buffer, which drops the entry silently.
+	if e.Timestamp < r.clock-r.lateness {
+		log.Warn().
+			Str("line", e.Line).
+			Int64("stamp", e.Timestamp).
+			Int64("clock", r.clock).
+			Msg("MatchReorder: Late event.")
+		r.trace.outOfOrder(r.clock, e)
+		return Hits{}
+	}
+
+	r.clock = max(r.clock, e.Timestamp)
+	r.held += 1
+	r.bytes += e.Size()
+	r.reorder.Append(e)
+
+	return r.take()
+}
+
+// Release entries lateness behind clock and evaluate the matcher there.
+func (r *MatchReorder) Eval(clock int64) Hits {
+	if clock > r.clock {
+		r.clock = clock
+		r.reorder.AdvanceClock(clock)
+	}
+
+	appendHits(&r.hits, r.matcher.Eval(r.clock-r.lateness))
+	return r.take()
+}
+
+func (r *MatchReorder) GarbageCollect(clock int64) {
+	r.matcher.GarbageCollect(clock - r.lateness)
+}
+
+// Flush releases every held entry, eg. at the end of a stream.  The clock
+// starts over; later entries older than those released will be rejected by
+// the wrapped matcher.
+func (r *MatchReorder) Flush() Hits {
+	r.reorder.Flush()
+	r.clock = 0
+	return r.take()
+}
+
+// Stats of the wrapped matcher.  Lines and OutOfOrder include entries
+// rejected as late; held entries are counted as buffered.
+func (r *MatchReorder) Stats() Stats {
+	st := r.matcher.Stats()
+	st.Lines = r.trace.stats.Lines
+	st.OutOfOrder += r.trace.stats.OutOfOrder
+	st.Asserts += r.held
+	st.Bytes += r.bytes
+	return st
+}
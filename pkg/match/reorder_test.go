@@ -0,0 +1,115 @@
+package match
+
+import (
+	"testing"
+)
+
+func TestReorderSeq(t *testing.T) {
+	sm, err := NewMatchSeq(10, makeTermsA("alpha", "beta")...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	rm, err := NewMatchReorder(5, sm)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// Beta arrives before alpha; reordered within the lateness.
+	var hits Hits
+	appendHits(&hits, rm.Scan(LogEntry{Timestamp: 3, Line: "beta"}))
+	appendHits(&hits, rm.Scan(LogEntry{Timestamp: 1, Line: "alpha"}))
+	if hits.Cnt != 0 {
+		t.Fatalf("Expected hit delayed by lateness, got %v", hits)
+	}
+
+	if st := rm.Stats(); st.Asserts != 2 || st.Lines != 2 {
+		t.Errorf("Expected 2 held, got %+v", st)
+	}
+
+	appendHits(&hits, rm.Scan(LogEntry{Timestamp: 8, Line: "noise"}))
+	if hits.Cnt != 1 || hits.Logs[0].Timestamp != 1 || hits.Logs[1].Timestamp != 3 {
+		t.Fatalf("Expected hit on alpha, beta, got %v", hits)
+	}
+
+	if st := rm.Stats(); st.Asserts != 1 || st.Hits != 1 {
+		t.Errorf("Expected noise held, got %+v", st)
+	}
+}
+
+func TestReorderLate(t *testing.T) {
+	var tl traceLogT
+	sm, err := NewMatchSeq(10, makeTermsA("alpha", "beta")...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	rm, err := NewMatchReorder(5, sm, tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	rm.Scan(LogEntry{Timestamp: 10, Line: "beta"})
+	rm.Scan(LogEntry{Timestamp: 4, Line: "alpha"})
+
+	st := rm.Stats()
+	if st.OutOfOrder != 1 || st.Lines != 2 || st.Asserts != 1 {
+		t.Errorf("Expected late alpha rejected, got %+v", st)
+	}
+
+	tl.check(t, "outOfOrder:-1:0:alpha")
+
+	if hits := rm.Flush(); hits.Cnt != 0 {
+		t.Errorf("Expected no hit, got %v", hits)
+	}
+	if st := rm.Stats(); st.Asserts != 0 || st.Bytes != 0 {
+		t.Errorf("Expected nothing held, got %+v", st)
+	}
+}
+
+func TestReorderEval(t *testing.T) {
+	is, err := NewInverseSeq(10, makeTermsA("alpha", "beta"), []ResetT{
+		{Term: makeRaw("reset")},
+	})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	rm, err := NewMatchReorder(5, is)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// The reset arrives late but within the lateness; it must still cancel.
+	rm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	rm.Scan(LogEntry{Timestamp: 4, Line: "beta"})
+	rm.Scan(LogEntry{Timestamp: 2, Line: "reset"})
+
+	if hits := rm.Eval(100); hits.Cnt != 0 {
+		t.Errorf("Expected reset to cancel, got %v", hits)
+	}
+
+	rm.Scan(LogEntry{Timestamp: 101, Line: "alpha"})
+	rm.Scan(LogEntry{Timestamp: 102, Line: "beta"})
+
+	// Evaluated lateness behind the clock; beta is still held.
+	if hits := rm.Eval(106); hits.Cnt != 0 {
+		t.Errorf("Expected no hit while beta is held, got %v", hits)
+	}
+
+	hits := rm.Eval(110)
+	if hits.Cnt != 1 || hits.Logs[0].Timestamp != 101 {
+		t.Errorf("Expected hit on alpha 101, got %v", hits)
+	}
+}
+
+func TestReorderBadArgs(t *testing.T) {
+	sm, _ := NewMatchSingle(makeRaw("alpha"))
+
+	if _, err := NewMatchReorder(0, sm); err != ErrLateness {
+		t.Errorf("Expected ErrLateness, got %v", err)
+	}
+	if _, err := NewMatchReorder(5, nil); err != ErrNilMatcher {
+		t.Errorf("Expected ErrNilMatcher, got %v", err)
+	}
+}
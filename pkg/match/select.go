@@ -0,0 +1,203 @@
+package match
+
+import (
+	"errors"
+)
+
+// The selection strategy decides which buffered asserts make up a frame
+// once a MatchSeq or MatchSet can fire, and what is left buffered after.
+//
+//	SelectEarliest    Pair the earliest assert of each term; only the
+//	                  asserts in the frame are consumed.  The default.
+//	SelectLatest      Pair the latest asserts, giving the tightest frame
+//	                  that ends in the triggering entry.  The asserts in the
+//	                  frame and any older asserts on their terms are consumed.
+//	SelectNonOverlap  Pair the earliest asserts, then discard everything
+//	                  buffered; the next frame starts after this one ends.
+//	SelectAll         Fire a frame for every combination that ends in the
+//	                  triggering entry.  Nothing is consumed; asserts are
+//	                  kept until they age out of the window.
+//
+// For a sequence the asserts of a frame must be in order and fit any gaps;
+// see order.go and gap.go.
+// SelectAll may emit as many frames as the product of the asserts buffered
+// per term; only the frames that hold the triggering entry are enumerated,
+// and no more than WithMaxFrames are emitted per scan.  Bound it further
+// with a tight window or, on a set, WithMaxAsserts.
+// Asserts discarded by SelectLatest and SelectNonOverlap are counted as
+// stale.  Correlated terms support SelectEarliest and SelectNonOverlap only.
+
+var (
+	ErrSelectCorrelate = errors.New("selection not supported with correlated terms")
+)
+
+const defMaxFrames = 1024 // SelectAll frames per scan; see WithMaxFrames
+
+type SelectT uint8
+
+const (
+	SelectEarliest   SelectT = iota // Earliest asserts; consume the frame
+	SelectLatest                    // Latest asserts; consume the frame and older
+	SelectNonOverlap                // Earliest asserts; consume all
+	SelectAll                       // Every combination; consume nothing
+)
+
+func (s SelectT) String() string {
+	switch s {
+	case SelectEarliest:
+		return "earliest"
+	case SelectLatest:
+		return "latest"
+	case SelectNonOverlap:
+		return "nonOverlapping"
+	case SelectAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+func checkSelect(s SelectT, correlate bool) error {
+	if correlate && (s == SelectLatest || s == SelectAll) {
+		return ErrSelectCorrelate
+	}
+	return nil
+}
+
+// Whether a is used by any of picks[from:] on terms.
+func picked(terms []termT, picks []int, from int, a assertT) bool {
+	for k := from; k < len(picks); k++ {
+		if terms[k].asserts[picks[k]].seq == a.seq {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick the latest assert of each term before the last such that each links
+// to the next and no entry is used twice.  Returns the assert index for each
+// preceding term, or nil.
+func latestSeq(terms []termT, last assertT, order orderT, gaps gapsT) []int {
+	var (
+		n     = len(terms) - 1
+		picks = make([]int, n)
+	)
+
+	// Asserts are buffered in order; the latest candidate is tried first.
+	var walk func(i int, next assertT) bool
+	walk = func(i int, next assertT) bool {
+		if i < 0 {
+			return true
+		}
+
+		m := terms[i].asserts
+		for j := len(m) - 1; j >= 0; j-- {
+			if !gaps.link(order, i, m[j], next) || m[j].seq == last.seq || picked(terms, picks, i+1, m[j]) {
+				continue
+			}
+			picks[i] = j
+			if walk(i-1, m[j]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !walk(n-1, last) {
+		return nil
+	}
+	return picks
+}
+
+// Visit every chain of asserts, one from each term before the last, that
+// links in order and ends in last; picks holds the assert index per term.
+// Stops early if fn returns false.
+func walkSeq(terms []termT, last assertT, order orderT, gaps gapsT, fn func(picks []int) bool) {
+	var (
+		n     = len(terms) - 1
+		picks = make([]int, n)
+	)
+
+	var walk func(i int, prev *assertT) bool
+	walk = func(i int, prev *assertT) bool {
+		if i == n {
+			return fn(picks)
+		}
+
+		for j, a := range terms[i].asserts {
+			switch {
+			case !order.before(a, last):
+				return true // Buffered in order; none after can precede last
+			case prev != nil && !gaps.link(order, i-1, *prev, a):
+				continue
+			case i == n-1 && !gaps.link(order, i, a, last):
+				continue
+			case a.seq == last.seq:
+				continue
+			}
+
+			picks[i] = j
+			if picked(terms, picks[:i], 0, a) {
+				continue
+			}
+			if !walk(i+1, &terms[i].asserts[j]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	walk(0, nil)
+}
+
+// Visit every way of picking cnt(i) asserts, in buffered order, from each
+// term such that the newest assert of at least one fresh term is picked.
+// Each frame is visited once: under the first fresh term whose newest assert
+// it picks, which pins that assert and rules out the newest asserts of the
+// fresh terms before it.  Stops early if fn returns false.
+func walkSet(terms []termT, cnt func(int) int, fresh bitMaskT, fn func(picks [][]int) bool) {
+	var (
+		picks = make([][]int, len(terms))
+		pin   int
+	)
+
+	// Number of asserts of term i open to a free pick.
+	avail := func(i int) int {
+		n := len(terms[i].asserts)
+		if i <= pin && fresh.IsSet(i) {
+			n -= 1
+		}
+		return n
+	}
+
+	var walk func(i, from int) bool
+	walk = func(i, from int) bool {
+		switch {
+		case i == len(terms):
+			return fn(picks)
+		case i == pin && len(picks[i]) == cnt(i)-1:
+			picks[i] = append(picks[i], len(terms[i].asserts)-1)
+			ok := walk(i+1, 0)
+			picks[i] = picks[i][:len(picks[i])-1]
+			return ok
+		case len(picks[i]) == cnt(i):
+			return walk(i+1, 0)
+		}
+
+		for j := from; j < avail(i); j++ {
+			picks[i] = append(picks[i], j)
+			ok := walk(i, j+1)
+			picks[i] = picks[i][:len(picks[i])-1]
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	for pin = range terms {
+		if fresh.IsSet(pin) && !walk(0, 0) {
+			return
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func frameStamps(hits Hits) (out [][]int64) {
+	for i := range hits.Cnt {
+		var stamps []int64
+		for _, e := range hits.Frame(i).Logs {
+			stamps = append(stamps, e.Timestamp)
+		}
+		out = append(out, stamps)
+	}
+	return
+}
+
+func TestSelect(t *testing.T) {
+	tests := map[string]struct {
+		set       bool
+		selection SelectT
+		first     [][]int64 // Frames fired by beta at 3
+		second    [][]int64 // Frames fired by beta at 4
+	}{
+		"seq/earliest": {
+			selection: SelectEarliest,
+			first:     [][]int64{{1, 3}},
+			second:    [][]int64{{2, 4}},
+		},
+		"seq/latest": {
+			selection: SelectLatest,
+			first:     [][]int64{{2, 3}},
+		},
+		"seq/nonOverlapping": {
+			selection: SelectNonOverlap,
+			first:     [][]int64{{1, 3}},
+		},
+		"seq/all": {
+			selection: SelectAll,
+			first:     [][]int64{{1, 3}, {2, 3}},
+			second:    [][]int64{{1, 4}, {2, 4}},
+		},
+		"set/earliest": {
+			set:       true,
+			selection: SelectEarliest,
+			first:     [][]int64{{1, 3}},
+			second:    [][]int64{{2, 4}},
+		},
+		"set/latest": {
+			set:       true,
+			selection: SelectLatest,
+			first:     [][]int64{{2, 3}},
+		},
+		"set/nonOverlapping": {
+			set:       true,
+			selection: SelectNonOverlap,
+			first:     [][]int64{{1, 3}},
+		},
+		"set/all": {
+			set:       true,
+			selection: SelectAll,
+			first:     [][]int64{{1, 3}, {2, 3}},
+			second:    [][]int64{{1, 4}, {2, 4}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				m   Matcher
+				err error
+			)
+			if tc.set {
+				m, err = NewMatchSetOpts(10, makeTermsA("alpha", "beta"), WithSelect(tc.selection))
+			} else {
+				m, err = NewMatchSeqOpts(10, makeTermsA("alpha", "beta"), WithSelect(tc.selection))
+			}
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			m.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			m.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+
+			if got := frameStamps(m.Scan(LogEntry{Timestamp: 3, Line: "beta"})); !reflect.DeepEqual(got, tc.first) {
+				t.Errorf("Expected first %v, got %v", tc.first, got)
+			}
+			if got := frameStamps(m.Scan(LogEntry{Timestamp: 4, Line: "beta"})); !reflect.DeepEqual(got, tc.second) {
+				t.Errorf("Expected second %v, got %v", tc.second, got)
+			}
+			if st := m.Stats(); st.Hits != int64(len(tc.first)+len(tc.second)) {
+				t.Errorf("Expected hits counted per frame, got %+v", st)
+			}
+		})
+	}
+}
+
+func TestSelectSeqChain(t *testing.T) {
+	tests := map[string]struct {
+		selection SelectT
+		want      [][]int64
+	}{
+		"earliest": {selection: SelectEarliest, want: [][]int64{{1, 2, 5}}},
+		"latest":   {selection: SelectLatest, want: [][]int64{{3, 4, 5}}},
+		"all":      {selection: SelectAll, want: [][]int64{{1, 2, 5}, {1, 4, 5}, {3, 4, 5}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "beta", "gamma"), WithSelect(tc.selection))
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+			sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+			sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+			sm.Scan(LogEntry{Timestamp: 4, Line: "beta"})
+
+			if got := frameStamps(sm.Scan(LogEntry{Timestamp: 5, Line: "gamma"})); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// Dupe terms never share an entry within a frame.
+func TestSelectAllDupes(t *testing.T) {
+	sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "alpha", "beta"), WithSelect(SelectAll))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+
+	want := [][]int64{{1, 2, 4}, {1, 3, 4}, {2, 3, 4}}
+	if got := frameStamps(sm.Scan(LogEntry{Timestamp: 4, Line: "beta"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// Only frames that hold the fresh entry fire; each fires once.
+func TestSelectAllSet(t *testing.T) {
+	sm, err := NewMatchSetOpts(10, makeTermsA("alpha", "alpha", "beta"), WithSelect(SelectAll))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+
+	want := [][]int64{{1, 2, 4}, {1, 3, 4}, {2, 3, 4}}
+	if got := frameStamps(sm.Scan(LogEntry{Timestamp: 4, Line: "beta"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	want = [][]int64{{1, 5, 4}, {2, 5, 4}, {3, 5, 4}}
+	if got := frameStamps(sm.Scan(LogEntry{Timestamp: 5, Line: "alpha"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// An entry fresh on several terms.
+func TestSelectAllSetShared(t *testing.T) {
+	sm, err := NewMatchSetOpts(10, makeTermsA("alpha", "beta"), WithSelect(SelectAll))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+
+	want := [][]int64{{3, 2}, {3, 3}, {1, 3}}
+	if got := frameStamps(sm.Scan(LogEntry{Timestamp: 3, Line: "alpha beta"})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestSelectAllMaxFrames(t *testing.T) {
+	tests := map[string]struct {
+		set bool
+	}{
+		"seq": {},
+		"set": {set: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				m   Matcher
+				err error
+			)
+			if tc.set {
+				m, err = NewMatchSetOpts(10, makeTermsA("alpha", "beta"), WithSelect(SelectAll), WithMaxFrames(2))
+			} else {
+				m, err = NewMatchSeqOpts(10, makeTermsA("alpha", "beta"), WithSelect(SelectAll), WithMaxFrames(2))
+			}
+			if err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			for i := range 5 {
+				m.Scan(LogEntry{Timestamp: int64(i), Line: "alpha"})
+			}
+
+			want := [][]int64{{0, 5}, {1, 5}}
+			if got := frameStamps(m.Scan(LogEntry{Timestamp: 5, Line: "beta"})); !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestSelectCorrelate(t *testing.T) {
+	terms := []TermT{captureTerm(`alpha id=(?P<id>\d+)`), captureTerm(`beta id=(?P<id>\d+)`)}
+
+	for _, s := range []SelectT{SelectLatest, SelectAll} {
+		if _, err := NewMatchSeqOpts(10, terms, WithSelect(s)); err != ErrSelectCorrelate {
+			t.Errorf("%v: expected ErrSelectCorrelate, got %v", s, err)
+		}
+		if _, err := NewMatchSetOpts(10, terms, WithSelect(s)); err != ErrSelectCorrelate {
+			t.Errorf("%v: expected ErrSelectCorrelate, got %v", s, err)
+		}
+	}
+
+	sm, err := NewMatchSetOpts(10, terms, WithSelect(SelectNonOverlap))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha id=1"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "alpha id=1"})
+	if hits := sm.Scan(LogEntry{Timestamp: 3, Line: "beta id=1"}); hits.Cnt != 1 {
+		t.Fatalf("Expected hit, got %v", hits)
+	}
+	if hits := sm.Scan(LogEntry{Timestamp: 4, Line: "beta id=1"}); hits.Cnt != 0 {
+		t.Errorf("Expected no overlapping hit, got %v", hits)
+	}
+}
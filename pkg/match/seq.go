@@ -12,21 +12,48 @@ import (
 // The machine is edge triggered, state can only change on a new event.  As such,
 // it works properly when scanning a log that is not aligned with real time.
 //
-// Note: The matcher does not currently enforce strict ordering on match.  This means
+// Note: By default the matcher does not enforce strict ordering on match.  This means
 // that if two matches in a sequence have the same timestamp, it will be considered a match.
 // This is done to account for imprecise clocks; a clock with low resolution might emit
 // two events with the same timestamp when in real time they are sequential.
+// WithOrder selects a stricter policy; see order.go.  WithGaps bounds the
+// delay between consecutive terms; see gap.go.
+//
+// If more than one term captures fields, the sequence fires only on a chain of
+// matches whose captured fields agree; see correlate.go.  The earliest
+// agreeing match of each term is used.
+//
+// WithSelect picks which buffered matches make up a frame; see select.go.
+//
+// A term that must repeat is better expressed as a quantified step of a
+// MatchPattern than as duplicate terms; see pattern.go.
 
 type MatchSeq struct {
-	clock    int64
-	window   int64
-	nActive  int
-	dupeMask bitMaskT
-	terms    []termT
+	clock     int64
+	window    int64
+	nActive   int
+	correlate bool
+	dupeMask  bitMaskT
+	gapMark   int64
+	order     orderT
+	gaps      gapsT
+	selection SelectT
+	maxFrames int
+	maxSearch int
+	terms     []termT
+	matched   []bool // Per term result of the current entry
+	meta      hitMetaT
+	trace     tracerT
 }
 
 func NewMatchSeq(window int64, terms ...TermT) (*MatchSeq, error) {
+	return NewMatchSeqOpts(window, terms)
+}
+
+// NewMatchSeqOpts is NewMatchSeq with options.
+func NewMatchSeqOpts(window int64, terms []TermT, opts ...OptT) (*MatchSeq, error) {
 	var (
+		o        = parseOpts(opts)
 		nTerms   = len(terms)
 		termL    = make([]termT, nTerms)
 		dupes    = make(map[TermT]int, nTerms)
@@ -50,7 +77,7 @@ func NewMatchSeq(window int64, terms ...TermT) (*MatchSeq, error) {
 	}
 
 	for i, term := range terms {
-		if m, err := term.NewMatcher(); err != nil {
+		if m, err := o.newMatcher(term); err != nil {
 			return nil, err
 		} else {
 			termL[i].matcher = m
@@ -60,14 +87,44 @@ func NewMatchSeq(window int64, terms ...TermT) (*MatchSeq, error) {
 		}
 	}
 
+	correlate, err := installCaptures(termL, terms, o.parseCache())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSelect(o.selection, correlate); err != nil {
+		return nil, err
+	}
+
+	gaps, err := newGaps(o.gaps, nTerms)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := newHitMeta(o, terms, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	return &MatchSeq{
-		window:   window,
-		terms:    termL,
-		dupeMask: dupeMask,
+		window:    window,
+		terms:     termL,
+		matched:   make([]bool, nTerms),
+		correlate: correlate,
+		dupeMask:  dupeMask,
+		gapMark:   disableGC,
+		order:     orderT{policy: o.order},
+		gaps:      gaps,
+		selection: o.selection,
+		maxFrames: o.maxFrames,
+		maxSearch: o.maxSearch,
+		meta:      meta,
+		trace:     newTracer(o, nTerms, nil),
 	}, nil
 }
 
 func (r *MatchSeq) Scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
 
 	if e.Timestamp < r.clock {
 		log.Warn().
@@ -75,21 +132,41 @@ func (r *MatchSeq) Scan(e LogEntry) (hits Hits) {
 			Int64("stamp", e.Timestamp).
 			Int64("clock", r.clock).
 			Msg("MatchSeq: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
 		return
 	}
 	r.clock = e.Timestamp
+	r.order.next()
 
 	r.maybeGC(e.Timestamp)
 
+	// Count every term, not only those the state machine can take.
+	for i := range r.terms {
+		if r.matched[i] = r.terms[i].matcher(e); r.matched[i] {
+			r.trace.match(i)
+		}
+	}
+
 	for i := range r.nActive {
-		if r.terms[i].matcher(e.Line) {
-			r.terms[i].asserts = append(r.terms[i].asserts, e)
+		if r.matched[i] && (i == 0 || r.gaps == nil || r.gaps.linked(r.order, r.terms, i-1, e)) {
+			r.push(i, e)
 		}
 	}
 
-	if !r.terms[r.nActive].matcher(e.Line) {
+	switch {
+	case !r.matched[r.nActive]:
 		// No match on active term; NOOP.
 		return
+	case r.nActive > 0 && !r.gaps.linked(r.order, r.terms, r.nActive-1, e):
+		// Cannot follow the previous term; NOOP.
+		return
+	}
+
+	if r.nActive == len(r.terms)-1 {
+		r.trace.assert(r.clock, r.nActive, e)
+		if r.correlate {
+			return r.fireCorrelated(e)
+		}
 	}
 
 	// We matched the active term
@@ -97,21 +174,68 @@ func (r *MatchSeq) Scan(e LogEntry) (hits Hits) {
 
 	if r.nActive < len(r.terms) {
 		// Not all terms are matched; append current for later.
-		r.terms[r.nActive-1].asserts = append(r.terms[r.nActive-1].asserts, e)
+		r.push(r.nActive-1, e)
 		return
 	}
 
 	// We have a full frame; fire and prune.
-	hits.Cnt = 1
-	hits.Logs = make([]LogEntry, 0, len(r.terms))
+	return r.fire(e)
+}
 
-	for i := range len(r.terms) - 1 {
-		hits.Logs = append(hits.Logs, r.terms[i].asserts[0])
-		shiftLeft(r.terms, i, 1)
-	}
+func (r *MatchSeq) push(idx int, e LogEntry) {
+	r.order.push(&r.terms[idx], e)
+	r.trace.assert(r.clock, idx, e)
+	r.gapMark = min(r.gapMark, r.gaps.expiry(idx, e.Timestamp))
+}
+
+func (r *MatchSeq) fire(e LogEntry) (hits Hits) {
+	var (
+		last = len(r.terms) - 1
+		trig = assertT{LogEntry: e, seq: r.order.seq}
+	)
+
+	switch r.selection {
+	case SelectLatest:
+		picks := latestSeq(r.terms, trig, r.order, r.gaps)
+		if picks == nil {
+			// Cannot happen while the first asserts form a chain; fall back to them.
+			picks = make([]int, last)
+		}
+		r.addFrame(&hits, picks, e)
+
+		// Older asserts are superseded by the picks.
+		for i, pos := range picks {
+			if pos > 0 {
+				r.trace.drop(r.clock, DropStale, i, pos)
+			}
+			shiftLeft(r.terms, i, pos+1)
+		}
+
+	case SelectAll:
+		walkSeq(r.terms, trig, r.order, r.gaps, func(picks []int) bool {
+			r.addFrame(&hits, picks, e)
+			return hits.Cnt < r.maxFrames
+		})
+
+	default:
+		hits.Logs = make([]LogEntry, 0, len(r.terms))
+
+		for i := range last {
+			r.meta.add(&hits, r.terms[i].asserts[0].LogEntry, i)
+			shiftLeft(r.terms, i, 1)
+		}
 
-	// And the final event that triggered this hit
-	hits.Logs = append(hits.Logs, e)
+		// And the final event that triggered this hit
+		r.meta.add(&hits, e, last)
+		hits.closeFrame(r.window)
+		r.trace.hit(r.clock, hits)
+
+		if r.selection == SelectNonOverlap {
+			r.trace.dropTerms(r.clock, DropStale, r.terms, 0)
+			r.reset()
+			return
+		}
+	}
 
 	// Fixup state
 	r.miniGC()
@@ -119,8 +243,59 @@ func (r *MatchSeq) Scan(e LogEntry) (hits Hits) {
 	return
 }
 
+// Append a frame of the asserts at picks, ending in e.
+func (r *MatchSeq) addFrame(hits *Hits, picks []int, e LogEntry) {
+	for i, pos := range picks {
+		r.meta.add(hits, r.terms[i].asserts[pos].LogEntry, i)
+	}
+	r.meta.add(hits, e, len(r.terms)-1)
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, *hits)
+}
+
+// The final term matched; fire if a chain of preceding asserts agrees with it.
+func (r *MatchSeq) fireCorrelated(e LogEntry) (hits Hits) {
+	var (
+		last = len(r.terms) - 1
+		a    = r.terms[last].newAssert(e)
+	)
+
+	a.seq = r.order.seq
+	picks, over := correlateSeq(r.terms, a, r.order, r.gaps, r.maxSearch)
+
+	if over {
+		// The entry was not buffered; see correlate.go.
+		r.trace.drop(r.clock, DropLimit, last, 1)
+		return
+	}
+
+	if picks == nil {
+		return
+	}
+
+	hits.Logs = make([]LogEntry, 0, len(r.terms))
+
+	for i, pos := range picks {
+		r.meta.add(&hits, r.terms[i].asserts[pos].LogEntry, i)
+		removeAssert(r.terms, i, pos)
+	}
+
+	r.meta.add(&hits, e, last)
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, hits)
+
+	if r.selection == SelectNonOverlap {
+		r.trace.dropTerms(r.clock, DropStale, r.terms, 0)
+		r.reset()
+		return
+	}
+
+	r.miniGC()
+	return
+}
+
 func (r *MatchSeq) maybeGC(clock int64) {
-	if r.nActive == 0 || clock-r.terms[0].asserts[0].Timestamp < r.window {
+	if r.nActive == 0 || clock-r.terms[0].asserts[0].Timestamp < r.window && clock < r.gapMark {
 		return
 	}
 
@@ -145,6 +320,7 @@ func (r *MatchSeq) GarbageCollect(clock int64) {
 	}
 
 	if cnt > 0 {
+		r.trace.gc(clock, 0, cnt)
 		shiftLeft(r.terms, 0, cnt)
 	}
 
@@ -154,6 +330,7 @@ func (r *MatchSeq) GarbageCollect(clock int64) {
 func (r *MatchSeq) miniGC() {
 
 	if len(r.terms[0].asserts) == 0 {
+		r.trace.dropTerms(r.clock, DropStale, r.terms, 1)
 		r.reset()
 		return
 	}
@@ -173,7 +350,7 @@ func (r *MatchSeq) miniGC() {
 	// Do not allocate if not processing dupes.
 	// Dupe detection is used to prune duplicate terms
 	// that are incorrectly activated due to garbage collection.
-	if !r.dupeMask.Zeros() {
+	if !r.dupeMask.Zeros() && r.order.lenient() {
 		dupes = make(map[dupeT]struct{}, len(r.terms))
 		if r.dupeMask.IsSet(0) {
 			term := r.terms[0].asserts[0]
@@ -190,6 +367,7 @@ func (r *MatchSeq) miniGC() {
 	for i := 1; i < r.nActive; i++ {
 
 		if forceClear {
+			r.trace.drop(r.clock, DropStale, i, len(r.terms[i].asserts))
 			resetTerm(r.terms, i)
 			continue
 		}
@@ -202,6 +380,11 @@ func (r *MatchSeq) miniGC() {
 		for _, term := range m {
 
 			switch {
+			case !r.order.lenient():
+				// Drop asserts that cannot follow the previous term.
+				if r.order.before(r.terms[i-1].asserts[0], term) {
+					break TERMLOOP
+				}
 			case term.Timestamp < zeroMatch:
 			case r.dupeMask.IsSet(i):
 				dupe := dupeT{
@@ -220,13 +403,14 @@ func (r *MatchSeq) miniGC() {
 		}
 
 		if cnt > 0 {
+			r.trace.drop(r.clock, DropStale, i, cnt)
 			shiftLeft(r.terms, i, cnt)
 		}
 
 		if len(r.terms[i].asserts) > 0 {
 			nActive++
 
-			if r.dupeMask.IsSet(i) {
+			if dupes != nil && r.dupeMask.IsSet(i) {
 				term := r.terms[i].asserts[0]
 				dupes[dupeT{
 					Line:      term.Line,
@@ -240,18 +424,25 @@ func (r *MatchSeq) miniGC() {
 	}
 
 	r.nActive = nActive
+
+	if r.gaps != nil {
+		r.pruneGaps()
+	}
+}
+
+// Drop asserts that cannot be part of a chain that fits the gaps.
+func (r *MatchSeq) pruneGaps() {
+	r.nActive, r.gapMark = r.gaps.prune(r.terms, r.nActive, r.clock, r.order, func(idx, cnt int) {
+		r.trace.drop(r.clock, DropStale, idx, cnt)
+	})
 }
 
 func (r *MatchSeq) reset() {
 	for i := range r.terms {
-		m := r.terms[i].asserts
-		if cap(m) <= capThreshold {
-			r.terms[i].asserts = m[:0]
-		} else {
-			r.terms[i].asserts = nil
-		}
+		resetTerm(r.terms, i)
 	}
 	r.nActive = 0
+	r.gapMark = disableGC
 }
 
 // Because match sequence is edge triggered, there won't be hits.
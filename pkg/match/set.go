@@ -8,22 +8,44 @@ import (
 
 const disableGC int64 = math.MaxInt64
 
+// MatchSet fires when every term has matched within the window, in any order.
+//
+// If more than one term captures fields, the set fires only on a frame whose
+// captured fields agree; see correlate.go.
+//
+// WithSelect picks which buffered matches make up a frame; see select.go.
+
 type MatchSet struct {
-	clock   int64
-	window  int64
-	gcMark  int64
-	hotMask bitMaskT
-	terms   []termT
-	dupeMap map[int]int
+	clock     int64
+	window    int64
+	gcMark    int64
+	correlate bool
+	selection SelectT
+	maxFrames int
+	maxSearch int
+	hotMask   bitMaskT
+	terms     []termT
+	dupeMap   map[int]int
+	meta      hitMetaT
+	trace     tracerT
+	limit     limitT
 }
 
 func NewMatchSet(window int64, setTerms ...TermT) (*MatchSet, error) {
+	return NewMatchSetOpts(window, setTerms)
+}
+
+// NewMatchSetOpts is NewMatchSet with options.
+func NewMatchSetOpts(window int64, setTerms []TermT, opts ...OptT) (*MatchSet, error) {
 
 	var (
+		o       = parseOpts(opts)
 		dupeMap map[int]int
 		nTerms  = len(setTerms)
 		dupes   = make(map[TermT]int, nTerms)
 		terms   = make([]termT, 0, nTerms)
+		src     = make([]TermT, 0, nTerms)
+		index   = make([]int, 0, nTerms)
 	)
 
 	switch {
@@ -45,12 +67,14 @@ func NewMatchSet(window int64, setTerms ...TermT) (*MatchSet, error) {
 
 		if cnt >= 1 {
 
-			m, err := term.NewMatcher()
+			m, err := o.newMatcher(term)
 			if err != nil {
 				return nil, err
 			}
 
 			terms = append(terms, termT{matcher: m})
+			src = append(src, term)
+			index = append(index, i)
 
 			if cnt > 1 {
 
@@ -66,21 +90,54 @@ func NewMatchSet(window int64, setTerms ...TermT) (*MatchSet, error) {
 		}
 	}
 
+	correlate, err := installCaptures(terms, src, o.parseCache())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSelect(o.selection, correlate); err != nil {
+		return nil, err
+	}
+
+	meta, err := newHitMeta(o, src, index)
+	if err != nil {
+		return nil, err
+	}
+
 	return &MatchSet{
-		terms:   terms,
-		window:  window,
-		gcMark:  disableGC,
-		dupeMap: dupeMap, // 8 bytes overhead if nil, same as a bitmask
+		terms:     terms,
+		window:    window,
+		gcMark:    disableGC,
+		correlate: correlate,
+		selection: o.selection,
+		maxFrames: o.maxFrames,
+		maxSearch: o.maxSearch,
+		dupeMap:   dupeMap, // 8 bytes overhead if nil, same as a bitmask
+		meta:      meta,
+		trace:     newTracer(o, nTerms, index),
+		limit:     newLimit(o),
 	}, nil
 }
 
 func (r *MatchSet) Scan(e LogEntry) (hits Hits) {
+	hits = r.scan(e)
+
+	// After firing, so that a complete frame is not broken up.
+	if r.limit.enabled() {
+		r.limit.enforce(r.terms, r.evicted)
+	}
+	return
+}
+
+func (r *MatchSet) scan(e LogEntry) (hits Hits) {
+	r.trace.scan()
 	if e.Timestamp < r.clock {
 		log.Warn().
 			Str("line", e.Line).
 			Int64("stamp", e.Timestamp).
 			Int64("clock", r.clock).
 			Msg("MatchSet: Out of order event.")
+		r.trace.outOfOrder(r.clock, e)
 		return
 	}
 	r.clock = e.Timestamp
@@ -89,10 +146,15 @@ func (r *MatchSet) Scan(e LogEntry) (hits Hits) {
 
 	// For a set, must scan all terms.
 	// Cannot short circuit like a sequence.
+	var fresh bitMaskT
 	for i, term := range r.terms {
-		if term.matcher(e.Line) {
+		if term.matcher(e) {
+			fresh.Set(i)
+			r.trace.match(i)
+
 			// Append the match to the assert list
-			r.terms[i].asserts = append(r.terms[i].asserts, e)
+			r.terms[i].push(e)
+			r.trace.assert(r.clock, i, e)
 
 			// If not a dupe or we've hit the dupe count, set the hot mask
 			if dupeCnt, ok := r.dupeMap[i]; !ok || len(r.terms[i].asserts) >= dupeCnt {
@@ -110,27 +172,50 @@ func (r *MatchSet) Scan(e LogEntry) (hits Hits) {
 		return // no match
 	}
 
+	if r.correlate {
+		if fresh.Zeros() {
+			return // already searched on the previous match
+		}
+		return r.fireCorrelated(fresh)
+	}
+
+	if r.selection == SelectAll {
+		if fresh.Zeros() {
+			return // already fired on the previous match
+		}
+		return r.fireAll(fresh)
+	}
+
 	// We have a full frame; fire and prune.
-	hits.Cnt = 1
 	hits.Logs = make([]LogEntry, 0, len(r.terms)) // Not quite if dupes are present
 
 	r.gcMark = disableGC
 	for i, term := range r.terms {
 
-		hitCnt := 1
-		dupeCnt := r.dupeMap[i]
-		if dupeCnt > 0 {
-			hitCnt = dupeCnt
+		var (
+			pos     int
+			drop    int
+			hitCnt  = r.hitCnt(i)
+			dupeCnt = r.dupeMap[i]
+		)
+
+		switch r.selection {
+		case SelectLatest:
+			pos, drop = len(term.asserts)-hitCnt, len(term.asserts)
+		case SelectNonOverlap:
+			drop = len(term.asserts)
+		default:
+			drop = hitCnt
 		}
 
-		m := term.asserts
-		hits.Logs = append(hits.Logs, m[0:hitCnt]...)
-		if len(m) == hitCnt && cap(m) <= capThreshold {
-			m = m[:0]
-		} else {
-			m = m[hitCnt:]
+		for _, a := range term.asserts[pos : pos+hitCnt] {
+			r.meta.add(&hits, a.LogEntry, i)
 		}
-		r.terms[i].asserts = m
+		if stale := drop - hitCnt; stale > 0 {
+			r.trace.drop(r.clock, DropStale, i, stale)
+		}
+		shiftLeft(r.terms, i, drop)
+		m := r.terms[i].asserts
 
 		if len(m) == 0 {
 			r.hotMask.Clr(i)
@@ -147,9 +232,97 @@ func (r *MatchSet) Scan(e LogEntry) (hits Hits) {
 		}
 	}
 
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, hits)
 	return
 }
 
+// Number of asserts of term i in a frame.
+func (r *MatchSet) hitCnt(i int) int {
+	return max(r.dupeMap[i], 1)
+}
+
+// All terms are hot; fire a frame for every combination of asserts that
+// includes the entry just matched on the fresh terms.  Nothing is consumed.
+func (r *MatchSet) fireAll(fresh bitMaskT) (hits Hits) {
+	walkSet(r.terms, r.hitCnt, fresh, func(picks [][]int) bool {
+		for i, pos := range picks {
+			for _, j := range pos {
+				r.meta.add(&hits, r.terms[i].asserts[j].LogEntry, i)
+			}
+		}
+		hits.closeFrame(r.window)
+		r.trace.hit(r.clock, hits)
+		return hits.Cnt < r.maxFrames
+	})
+	return
+}
+
+// All terms are hot; fire if a frame of asserts agrees on captured fields.
+func (r *MatchSet) fireCorrelated(fresh bitMaskT) (hits Hits) {
+	picks, over := correlateSet(r.terms, r.hitCnt, r.maxSearch)
+
+	if over {
+		// Drop the entry that started the search; see correlate.go.
+		for i := range r.terms {
+			if fresh.IsSet(i) {
+				removeAssert(r.terms, i, len(r.terms[i].asserts)-1)
+				r.trace.drop(r.clock, DropLimit, i, 1)
+				if len(r.terms[i].asserts) < r.hitCnt(i) {
+					r.hotMask.Clr(i)
+				}
+			}
+		}
+		return
+	}
+
+	if picks == nil {
+		return
+	}
+
+	hits.Logs = make([]LogEntry, 0, len(r.terms))
+
+	r.gcMark = disableGC
+	for i, pos := range picks {
+		for _, j := range pos {
+			r.meta.add(&hits, r.terms[i].asserts[j].LogEntry, i)
+		}
+
+		// Remove in reverse to keep the remaining indices valid.
+		for k := len(pos) - 1; k >= 0; k-- {
+			removeAssert(r.terms, i, pos[k])
+		}
+
+		m := r.terms[i].asserts
+		if len(m) < max(r.dupeMap[i], 1) {
+			r.hotMask.Clr(i)
+		}
+		if len(m) > 0 && m[0].Timestamp < r.gcMark {
+			r.gcMark = m[0].Timestamp
+		}
+	}
+
+	hits.closeFrame(r.window)
+	r.trace.hit(r.clock, hits)
+
+	if r.selection == SelectNonOverlap {
+		r.trace.dropTerms(r.clock, DropStale, r.terms, 0)
+		for i := range r.terms {
+			resetTerm(r.terms, i)
+		}
+		r.hotMask = bitMaskT{}
+		r.gcMark = disableGC
+	}
+	return
+}
+
+func (r *MatchSet) evicted(idx, cnt int) {
+	r.trace.drop(r.clock, DropLimit, idx, cnt)
+	if len(r.terms[idx].asserts) < max(r.dupeMap[idx], 1) {
+		r.hotMask.Clr(idx)
+	}
+}
+
 func (r *MatchSet) maybeGC(clock int64) {
 	if (r.hotMask.Zeros() && r.dupeMap == nil) || clock-r.gcMark <= r.window {
 		return
@@ -177,6 +350,7 @@ func (r *MatchSet) GarbageCollect(clock int64) {
 		}
 
 		if cnt > 0 {
+			r.trace.gc(clock, i, cnt)
 			shiftLeft(r.terms, i, cnt)
 		}
 
@@ -5,23 +5,41 @@ import (
 )
 
 type MatchSingle struct {
-	matcher MatchFunc
+	matcher EntryMatchFunc
+	meta    hitMetaT
+	trace   tracerT
 }
 
 func NewMatchSingle(term TermT) (*MatchSingle, error) {
-	m, err := term.NewMatcher()
+	return NewMatchSingleOpts(term)
+}
+
+// NewMatchSingleOpts is NewMatchSingle with options.
+func NewMatchSingleOpts(term TermT, opts ...OptT) (*MatchSingle, error) {
+	o := parseOpts(opts)
+
+	m, err := o.newMatcher(term)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := newHitMeta(o, []TermT{term}, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &MatchSingle{matcher: m}, nil
+	return &MatchSingle{matcher: m, meta: meta, trace: newTracer(o, 1, nil)}, nil
 }
 
 func (r *MatchSingle) Scan(e entry.LogEntry) (hits Hits) {
-
-	if r.matcher(e.Line) {
-		hits.Cnt = 1
-		hits.Logs = []entry.LogEntry{e}
+	r.trace.scan()
+
+	if r.matcher(e) {
+		r.trace.match(0)
+		r.trace.assert(e.Timestamp, 0, e)
+		r.meta.add(&hits, e, 0)
+		hits.closeFrame(0)
+		r.trace.hit(e.Timestamp, hits)
 	}
 
 	return
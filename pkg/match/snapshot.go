@@ -0,0 +1,512 @@
+package match
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	"github.com/tinylib/msgp/msgp"
+)
+
+//go:generate msgp -io=false -unexported
+
+// Snapshots checkpoint the in-flight state of a matcher so that partial
+// matches survive a restart.  A snapshot is a versioned msgpack array holding
+// the clock, GC mark, active count, hot mask, buffered asserts per term,
+// reset timestamps and the input sequence numbers used by OrderInput.  It
+// does not hold the terms themselves; restore into a matcher built with the
+// same terms, resets and options.  Captured fields are recomputed from the
+// restored entries.
+//
+// Version 1 snapshots predate the ordering policy and hold no sequence
+// numbers.  They are restored as taken under OrderLenient: the asserts are
+// numbered in timestamp order, ties in term order, so an entry held by two
+// terms restores as two entries.
+//
+// The codec is generated from the tuple structs below; see snapshot_gen.go.
+
+var (
+	ErrSnapshot        = errors.New("invalid snapshot")
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+	ErrSnapshotShape   = errors.New("snapshot does not fit matcher")
+)
+
+const snapshotVersion = 2
+
+const (
+	kindSeq        = "seq"
+	kindSet        = "set"
+	kindInverseSeq = "inverseSeq"
+	kindInverseSet = "inverseSet"
+	kindDedupe     = "dedupe"
+)
+
+//msgp:tuple stateT stateV1T dedupeStateT frameT
+//msgp:ignore metaT
+
+type stateT struct {
+	Version int
+	Kind    string
+	Clock   int64
+	GCMark  int64
+	NActive int
+	HotLo   uint64
+	HotHi   []uint64
+	Terms   [][]entry.LogEntry
+	Resets  [][]int64
+	Seq     uint64     // Sequence number of the last entry scanned
+	Seqs    [][]uint64 // Sequence number of each assert
+}
+
+// stateT without the sequence numbers.
+type stateV1T struct {
+	Version int
+	Kind    string
+	Clock   int64
+	GCMark  int64
+	NActive int
+	HotLo   uint64
+	HotHi   []uint64
+	Terms   [][]entry.LogEntry
+	Resets  [][]int64
+}
+
+// Number the asserts in timestamp order; see above.
+func (v1 stateV1T) upgrade() stateT {
+	st := stateT{
+		Version: v1.Version,
+		Kind:    v1.Kind,
+		Clock:   v1.Clock,
+		GCMark:  v1.GCMark,
+		NActive: v1.NActive,
+		HotLo:   v1.HotLo,
+		HotHi:   v1.HotHi,
+		Terms:   v1.Terms,
+		Resets:  v1.Resets,
+		Seqs:    make([][]uint64, len(v1.Terms)),
+	}
+
+	type refT struct{ term, pos int }
+	var refs []refT
+	for i, logs := range v1.Terms {
+		st.Seqs[i] = make([]uint64, len(logs))
+		for j := range logs {
+			refs = append(refs, refT{term: i, pos: j})
+		}
+	}
+
+	slices.SortStableFunc(refs, func(a, b refT) int {
+		return cmp.Compare(v1.Terms[a.term][a.pos].Timestamp, v1.Terms[b.term][b.pos].Timestamp)
+	})
+
+	for _, ref := range refs {
+		st.Seq += 1
+		st.Seqs[ref.term][ref.pos] = st.Seq
+	}
+	return st
+}
+
+type dedupeStateT struct {
+	Version int
+	Kind    string
+	Active  int64
+	Pend    frameT
+}
+
+type frameT struct {
+	Start  int64
+	Stop   int64
+	Window int64
+	Key    string
+	Logs   []entry.LogEntry
+	Meta   []metaT `msg:",allownil"`
+}
+
+// HitMeta on the wire: [Term, Count, name, value, ...], without the Count if
+// it is zero, ie. an odd length.
+type metaT HitMeta
+
+func newState(kind string, terms []termT, resets []resetT) stateT {
+	st := stateT{
+		Version: snapshotVersion,
+		Kind:    kind,
+		Terms:   make([][]LogEntry, len(terms)),
+		Seqs:    make([][]uint64, len(terms)),
+	}
+	for i, term := range terms {
+		for _, a := range term.asserts {
+			st.Terms[i] = append(st.Terms[i], a.LogEntry)
+			st.Seqs[i] = append(st.Seqs[i], a.seq)
+		}
+	}
+	if len(resets) > 0 {
+		st.Resets = make([][]int64, len(resets))
+		for i, reset := range resets {
+			st.Resets[i] = reset.resets
+		}
+	}
+	return st
+}
+
+func (st *stateT) hot() bitMaskT {
+	return bitMaskT{lo: st.HotLo, hi: st.HotHi}
+}
+
+func (st *stateT) setHot(m bitMaskT) {
+	st.HotLo, st.HotHi = m.lo, m.hi
+}
+
+// Replace the asserts and resets with those of the snapshot.
+func (st stateT) install(terms []termT, resets []resetT) {
+	for i := range terms {
+		terms[i].asserts, terms[i].bytes = nil, 0
+		for j, e := range st.Terms[i] {
+			terms[i].push(e)
+			terms[i].asserts[j].seq = st.Seqs[i][j]
+		}
+	}
+	for i := range resets {
+		resets[i].resets = st.Resets[i]
+	}
+}
+
+func (st stateT) marshal() []byte {
+	// Never fails; the state has no fields that can.
+	b, _ := st.MarshalMsg(nil)
+	return b
+}
+
+// Read the version and check the kind that lead every snapshot.
+func readHeader(b []byte, kind string) (int, error) {
+	_, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrSnapshot, err)
+	}
+
+	version, b, err := msgp.ReadIntBytes(b)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("%w: %w", ErrSnapshot, err)
+	case version < 1 || version > snapshotVersion:
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+	}
+
+	k, _, err := msgp.ReadStringBytes(b)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("%w: %w", ErrSnapshot, err)
+	case k != kind:
+		return 0, fmt.Errorf("%w: kind '%s', expected '%s'", ErrSnapshotShape, k, kind)
+	}
+	return version, nil
+}
+
+// Decode a snapshot of kind taken from a matcher with nTerms and nResets.
+func unmarshalState(b []byte, kind string, nTerms, nResets int) (st stateT, err error) {
+	version, err := readHeader(b, kind)
+	if err != nil {
+		return
+	}
+
+	if version == 1 {
+		var v1 stateV1T
+		if _, err = v1.UnmarshalMsg(b); err != nil {
+			return st, fmt.Errorf("%w: %w", ErrSnapshot, err)
+		}
+		st = v1.upgrade()
+	} else if _, err = st.UnmarshalMsg(b); err != nil {
+		return st, fmt.Errorf("%w: %w", ErrSnapshot, err)
+	}
+
+	switch {
+	case len(st.Terms) != nTerms:
+		err = fmt.Errorf("%w: %d terms, expected %d", ErrSnapshotShape, len(st.Terms), nTerms)
+	case len(st.Seqs) != nTerms:
+		err = fmt.Errorf("%w: %d sequence terms, expected %d", ErrSnapshot, len(st.Seqs), nTerms)
+	case len(st.Resets) != nResets:
+		err = fmt.Errorf("%w: %d resets, expected %d", ErrSnapshotShape, len(st.Resets), nResets)
+	case st.NActive < 0 || st.NActive > nTerms:
+		err = fmt.Errorf("%w: %d active terms", ErrSnapshot, st.NActive)
+	}
+	if err != nil {
+		return
+	}
+
+	if err = st.validate(kind); err != nil {
+		return st, fmt.Errorf("%w: %w", ErrSnapshot, err)
+	}
+	return
+}
+
+// Check the invariants the matchers rely on, so that a corrupt snapshot
+// fails to restore rather than panics on a later Scan.
+func (st stateT) validate(kind string) error {
+	for i, logs := range st.Terms {
+		if len(st.Seqs[i]) != len(logs) {
+			return fmt.Errorf("%d sequence numbers for %d asserts on term %d", len(st.Seqs[i]), len(logs), i)
+		}
+
+		for j, e := range logs {
+			switch {
+			case e.Timestamp > st.Clock:
+				return fmt.Errorf("assert %d on term %d is after the clock", j, i)
+			case st.Seqs[i][j] > st.Seq:
+				return fmt.Errorf("assert %d on term %d is after the sequence", j, i)
+			case j == 0:
+			case e.Timestamp < logs[j-1].Timestamp || st.Seqs[i][j] < st.Seqs[i][j-1]:
+				return fmt.Errorf("assert %d on term %d is out of order", j, i)
+			}
+		}
+
+		// Sequences buffer asserts on the active terms only.
+		if kind == kindSeq || kind == kindInverseSeq {
+			if active := i < st.NActive; active != (len(logs) > 0) {
+				return fmt.Errorf("%d asserts on term %d with %d active", len(logs), i, st.NActive)
+			}
+		}
+	}
+
+	for i, stamps := range st.Resets {
+		for j, ts := range stamps {
+			if ts > st.Clock || j > 0 && ts < stamps[j-1] {
+				return fmt.Errorf("reset %d of term %d is out of order", j, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check that every hot term i holds need(i) asserts, as sets assume.
+func (st stateT) checkHot(need func(int) int) error {
+	hot := st.hot()
+	for i, logs := range st.Terms {
+		if hot.IsSet(i) && len(logs) < need(i) {
+			return fmt.Errorf("%w: hot mask disagrees with term %d", ErrSnapshot, i)
+		}
+	}
+	return nil
+}
+
+func (r *MatchSeq) Snapshot() []byte {
+	st := newState(kindSeq, r.terms, nil)
+	st.Clock = r.clock
+	st.NActive = r.nActive
+	st.Seq = r.order.seq
+	return st.marshal()
+}
+
+// Restore replaces the state of the matcher with a snapshot.  The matcher is
+// unchanged on error.
+func (r *MatchSeq) Restore(b []byte) error {
+	st, err := unmarshalState(b, kindSeq, len(r.terms), 0)
+	if err != nil {
+		return err
+	}
+	st.install(r.terms, nil)
+	r.clock = st.Clock
+	r.nActive = st.NActive
+	r.order.seq = st.Seq
+	if r.gaps != nil {
+		r.pruneGaps() // Recomputes the gap mark; the state is already pruned
+	}
+	return nil
+}
+
+func (r *MatchSet) Snapshot() []byte {
+	st := newState(kindSet, r.terms, nil)
+	st.Clock = r.clock
+	st.GCMark = r.gcMark
+	st.setHot(r.hotMask)
+	return st.marshal()
+}
+
+// Restore replaces the state of the matcher with a snapshot.  The matcher is
+// unchanged on error.
+func (r *MatchSet) Restore(b []byte) error {
+	st, err := unmarshalState(b, kindSet, len(r.terms), 0)
+	if err != nil {
+		return err
+	}
+	if err := st.checkHot(r.hitCnt); err != nil {
+		return err
+	}
+	st.install(r.terms, nil)
+	r.clock = st.Clock
+	r.gcMark = st.GCMark
+	r.hotMask = st.hot()
+	return nil
+}
+
+func (r *InverseSeq) Snapshot() []byte {
+	st := newState(kindInverseSeq, r.terms, r.resets)
+	st.Clock = r.clock
+	st.GCMark = r.gcMark
+	st.NActive = r.nActive
+	st.Seq = r.order.seq
+	return st.marshal()
+}
+
+// Restore replaces the state of the matcher with a snapshot.  The matcher is
+// unchanged on error.
+func (r *InverseSeq) Restore(b []byte) error {
+	st, err := unmarshalState(b, kindInverseSeq, len(r.terms), len(r.resets))
+	if err != nil {
+		return err
+	}
+	st.install(r.terms, r.resets)
+	r.clock = st.Clock
+	r.gcMark = st.GCMark
+	r.nActive = st.NActive
+	r.order.seq = st.Seq
+	if r.gaps != nil {
+		r.pruneGaps() // Recomputes the gap mark; the state is already pruned
+	}
+	return nil
+}
+
+func (r *InverseSet) Snapshot() []byte {
+	st := newState(kindInverseSet, r.terms, r.resets)
+	st.Clock = r.clock
+	st.GCMark = r.gcMark
+	st.setHot(r.hotMask)
+	return st.marshal()
+}
+
+// Restore replaces the state of the matcher with a snapshot.  The matcher is
+// unchanged on error.
+func (r *InverseSet) Restore(b []byte) error {
+	st, err := unmarshalState(b, kindInverseSet, len(r.terms), len(r.resets))
+	if err != nil {
+		return err
+	}
+	if err := st.checkHot(func(i int) int { return max(r.dupeMap[i], 1) }); err != nil {
+		return err
+	}
+	st.install(r.terms, r.resets)
+	r.clock = st.Clock
+	r.gcMark = st.GCMark
+	r.hotMask = st.hot()
+	return nil
+}
+
+func newFrame(f HitFrame) frameT {
+	wf := frameT{
+		Start:  f.Start,
+		Stop:   f.Stop,
+		Window: f.Window,
+		Key:    f.Key,
+		Logs:   f.Logs,
+	}
+	if f.Meta != nil {
+		wf.Meta = make([]metaT, len(f.Meta))
+		for i, m := range f.Meta {
+			wf.Meta[i] = metaT(m)
+		}
+	}
+	return wf
+}
+
+func (wf frameT) frame() HitFrame {
+	f := HitFrame{
+		Start:  wf.Start,
+		Stop:   wf.Stop,
+		Window: wf.Window,
+		Key:    wf.Key,
+		Logs:   wf.Logs,
+	}
+	if wf.Meta != nil {
+		f.Meta = make([]HitMeta, len(wf.Meta))
+		for i, m := range wf.Meta {
+			f.Meta[i] = HitMeta(m)
+		}
+	}
+	return f
+}
+
+func (m *metaT) MarshalMsg(b []byte) ([]byte, error) {
+	if m.Count == 0 {
+		b = msgp.AppendArrayHeader(b, uint32(1+2*len(m.Fields)))
+		b = msgp.AppendInt(b, m.Term)
+	} else {
+		b = msgp.AppendArrayHeader(b, uint32(2+2*len(m.Fields)))
+		b = msgp.AppendInt(b, m.Term)
+		b = msgp.AppendInt(b, m.Count)
+	}
+	for _, fld := range m.Fields {
+		b = msgp.AppendString(b, fld.Name)
+		b = msgp.AppendString(b, fld.Value)
+	}
+	return b, nil
+}
+
+func (m *metaT) UnmarshalMsg(b []byte) (o []byte, err error) {
+	var cnt uint32
+	if cnt, b, err = msgp.ReadArrayHeaderBytes(b); err != nil {
+		return
+	}
+	if cnt == 0 {
+		return b, fmt.Errorf("%d meta fields", cnt)
+	}
+
+	*m = metaT{}
+	if m.Term, b, err = msgp.ReadIntBytes(b); err != nil {
+		return
+	}
+	if cnt%2 == 0 {
+		if m.Count, b, err = msgp.ReadIntBytes(b); err != nil {
+			return
+		}
+	}
+	for range (cnt - 1) / 2 {
+		var fld Field
+		if fld.Name, b, err = msgp.ReadStringBytes(b); err != nil {
+			return
+		}
+		if fld.Value, b, err = msgp.ReadStringBytes(b); err != nil {
+			return
+		}
+		m.Fields = append(m.Fields, fld)
+	}
+	return b, nil
+}
+
+func (m *metaT) Msgsize() (s int) {
+	s = msgp.ArrayHeaderSize + 2*msgp.IntSize
+	for _, fld := range m.Fields {
+		s += msgp.StringPrefixSize + len(fld.Name) + msgp.StringPrefixSize + len(fld.Value)
+	}
+	return
+}
+
+func (dd *Dedupe) Snapshot() []byte {
+	st := dedupeStateT{
+		Version: snapshotVersion,
+		Kind:    kindDedupe,
+		Active:  dd.active,
+		Pend:    newFrame(dd.pendHit),
+	}
+	// Never fails; see metaT.MarshalMsg.
+	b, _ := st.MarshalMsg(nil)
+	return b
+}
+
+// Restore replaces the active window and pending hit with a snapshot.  The
+// dedupe window is not restored.
+func (dd *Dedupe) Restore(b []byte) error {
+	// Unchanged since version 1.
+	if _, err := readHeader(b, kindDedupe); err != nil {
+		return err
+	}
+
+	var st dedupeStateT
+	if _, err := st.UnmarshalMsg(b); err != nil {
+		return fmt.Errorf("%w: %w", ErrSnapshot, err)
+	}
+
+	dd.active = st.Active
+	dd.pendHit = st.Pend.frame()
+	return nil
+}
@@ -0,0 +1,592 @@
+package match
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MarshalMsg implements msgp.Marshaler
+func (z *dedupeStateT) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 4
+	o = append(o, 0x94)
+	o = msgp.AppendInt(o, z.Version)
+	o = msgp.AppendString(o, z.Kind)
+	o = msgp.AppendInt64(o, z.Active)
+	o, err = z.Pend.MarshalMsg(o)
+	if err != nil {
+		err = msgp.WrapError(err, "Pend")
+		return
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *dedupeStateT) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 4 {
+		err = msgp.ArrayError{Wanted: 4, Got: zb0001}
+		return
+	}
+	z.Version, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	z.Kind, bts, err = msgp.ReadStringBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Kind")
+		return
+	}
+	z.Active, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Active")
+		return
+	}
+	bts, err = z.Pend.UnmarshalMsg(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Pend")
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *dedupeStateT) Msgsize() (s int) {
+	s = 1 + msgp.IntSize + msgp.StringPrefixSize + len(z.Kind) + msgp.Int64Size + z.Pend.Msgsize()
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *frameT) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 6
+	o = append(o, 0x96)
+	o = msgp.AppendInt64(o, z.Start)
+	o = msgp.AppendInt64(o, z.Stop)
+	o = msgp.AppendInt64(o, z.Window)
+	o = msgp.AppendString(o, z.Key)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Logs)))
+	for za0001 := range z.Logs {
+		o, err = z.Logs[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Logs", za0001)
+			return
+		}
+	}
+	if z.Meta == nil { // allownil: if nil
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Meta)))
+		for za0002 := range z.Meta {
+			o, err = z.Meta[za0002].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Meta", za0002)
+				return
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *frameT) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 6 {
+		err = msgp.ArrayError{Wanted: 6, Got: zb0001}
+		return
+	}
+	z.Start, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Start")
+		return
+	}
+	z.Stop, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Stop")
+		return
+	}
+	z.Window, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Window")
+		return
+	}
+	z.Key, bts, err = msgp.ReadStringBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Key")
+		return
+	}
+	var zb0002 uint32
+	zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Logs")
+		return
+	}
+	if cap(z.Logs) >= int(zb0002) {
+		z.Logs = (z.Logs)[:zb0002]
+	} else {
+		z.Logs = make([]entry.LogEntry, zb0002)
+	}
+	for za0001 := range z.Logs {
+		bts, err = z.Logs[za0001].UnmarshalMsg(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Logs", za0001)
+			return
+		}
+	}
+	if msgp.IsNil(bts) {
+		bts = bts[1:]
+		z.Meta = nil
+	} else {
+		var zb0003 uint32
+		zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Meta")
+			return
+		}
+		if z.Meta != nil && cap(z.Meta) >= int(zb0003) {
+			z.Meta = (z.Meta)[:zb0003]
+		} else {
+			z.Meta = make([]metaT, zb0003)
+		}
+		for za0002 := range z.Meta {
+			bts, err = z.Meta[za0002].UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Meta", za0002)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *frameT) Msgsize() (s int) {
+	s = 1 + msgp.Int64Size + msgp.Int64Size + msgp.Int64Size + msgp.StringPrefixSize + len(z.Key) + msgp.ArrayHeaderSize
+	for za0001 := range z.Logs {
+		s += z.Logs[za0001].Msgsize()
+	}
+	s += msgp.ArrayHeaderSize
+	for za0002 := range z.Meta {
+		s += z.Meta[za0002].Msgsize()
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *stateT) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 11
+	o = append(o, 0x9b)
+	o = msgp.AppendInt(o, z.Version)
+	o = msgp.AppendString(o, z.Kind)
+	o = msgp.AppendInt64(o, z.Clock)
+	o = msgp.AppendInt64(o, z.GCMark)
+	o = msgp.AppendInt(o, z.NActive)
+	o = msgp.AppendUint64(o, z.HotLo)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.HotHi)))
+	for za0001 := range z.HotHi {
+		o = msgp.AppendUint64(o, z.HotHi[za0001])
+	}
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Terms)))
+	for za0002 := range z.Terms {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Terms[za0002])))
+		for za0003 := range z.Terms[za0002] {
+			o, err = z.Terms[za0002][za0003].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Terms", za0002, za0003)
+				return
+			}
+		}
+	}
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Resets)))
+	for za0004 := range z.Resets {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Resets[za0004])))
+		for za0005 := range z.Resets[za0004] {
+			o = msgp.AppendInt64(o, z.Resets[za0004][za0005])
+		}
+	}
+	o = msgp.AppendUint64(o, z.Seq)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Seqs)))
+	for za0006 := range z.Seqs {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Seqs[za0006])))
+		for za0007 := range z.Seqs[za0006] {
+			o = msgp.AppendUint64(o, z.Seqs[za0006][za0007])
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *stateT) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 11 {
+		err = msgp.ArrayError{Wanted: 11, Got: zb0001}
+		return
+	}
+	z.Version, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	z.Kind, bts, err = msgp.ReadStringBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Kind")
+		return
+	}
+	z.Clock, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Clock")
+		return
+	}
+	z.GCMark, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "GCMark")
+		return
+	}
+	z.NActive, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "NActive")
+		return
+	}
+	z.HotLo, bts, err = msgp.ReadUint64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "HotLo")
+		return
+	}
+	var zb0002 uint32
+	zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "HotHi")
+		return
+	}
+	if cap(z.HotHi) >= int(zb0002) {
+		z.HotHi = (z.HotHi)[:zb0002]
+	} else {
+		z.HotHi = make([]uint64, zb0002)
+	}
+	for za0001 := range z.HotHi {
+		z.HotHi[za0001], bts, err = msgp.ReadUint64Bytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "HotHi", za0001)
+			return
+		}
+	}
+	var zb0003 uint32
+	zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Terms")
+		return
+	}
+	if cap(z.Terms) >= int(zb0003) {
+		z.Terms = (z.Terms)[:zb0003]
+	} else {
+		z.Terms = make([][]entry.LogEntry, zb0003)
+	}
+	for za0002 := range z.Terms {
+		var zb0004 uint32
+		zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Terms", za0002)
+			return
+		}
+		if cap(z.Terms[za0002]) >= int(zb0004) {
+			z.Terms[za0002] = (z.Terms[za0002])[:zb0004]
+		} else {
+			z.Terms[za0002] = make([]entry.LogEntry, zb0004)
+		}
+		for za0003 := range z.Terms[za0002] {
+			bts, err = z.Terms[za0002][za0003].UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Terms", za0002, za0003)
+				return
+			}
+		}
+	}
+	var zb0005 uint32
+	zb0005, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Resets")
+		return
+	}
+	if cap(z.Resets) >= int(zb0005) {
+		z.Resets = (z.Resets)[:zb0005]
+	} else {
+		z.Resets = make([][]int64, zb0005)
+	}
+	for za0004 := range z.Resets {
+		var zb0006 uint32
+		zb0006, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Resets", za0004)
+			return
+		}
+		if cap(z.Resets[za0004]) >= int(zb0006) {
+			z.Resets[za0004] = (z.Resets[za0004])[:zb0006]
+		} else {
+			z.Resets[za0004] = make([]int64, zb0006)
+		}
+		for za0005 := range z.Resets[za0004] {
+			z.Resets[za0004][za0005], bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Resets", za0004, za0005)
+				return
+			}
+		}
+	}
+	z.Seq, bts, err = msgp.ReadUint64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Seq")
+		return
+	}
+	var zb0007 uint32
+	zb0007, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Seqs")
+		return
+	}
+	if cap(z.Seqs) >= int(zb0007) {
+		z.Seqs = (z.Seqs)[:zb0007]
+	} else {
+		z.Seqs = make([][]uint64, zb0007)
+	}
+	for za0006 := range z.Seqs {
+		var zb0008 uint32
+		zb0008, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Seqs", za0006)
+			return
+		}
+		if cap(z.Seqs[za0006]) >= int(zb0008) {
+			z.Seqs[za0006] = (z.Seqs[za0006])[:zb0008]
+		} else {
+			z.Seqs[za0006] = make([]uint64, zb0008)
+		}
+		for za0007 := range z.Seqs[za0006] {
+			z.Seqs[za0006][za0007], bts, err = msgp.ReadUint64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Seqs", za0006, za0007)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *stateT) Msgsize() (s int) {
+	s = 1 + msgp.IntSize + msgp.StringPrefixSize + len(z.Kind) + msgp.Int64Size + msgp.Int64Size + msgp.IntSize + msgp.Uint64Size + msgp.ArrayHeaderSize + (len(z.HotHi) * (msgp.Uint64Size)) + msgp.ArrayHeaderSize
+	for za0002 := range z.Terms {
+		s += msgp.ArrayHeaderSize
+		for za0003 := range z.Terms[za0002] {
+			s += z.Terms[za0002][za0003].Msgsize()
+		}
+	}
+	s += msgp.ArrayHeaderSize
+	for za0004 := range z.Resets {
+		s += msgp.ArrayHeaderSize + (len(z.Resets[za0004]) * (msgp.Int64Size))
+	}
+	s += msgp.Uint64Size + msgp.ArrayHeaderSize
+	for za0006 := range z.Seqs {
+		s += msgp.ArrayHeaderSize + (len(z.Seqs[za0006]) * (msgp.Uint64Size))
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *stateV1T) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// array header, size 9
+	o = append(o, 0x99)
+	o = msgp.AppendInt(o, z.Version)
+	o = msgp.AppendString(o, z.Kind)
+	o = msgp.AppendInt64(o, z.Clock)
+	o = msgp.AppendInt64(o, z.GCMark)
+	o = msgp.AppendInt(o, z.NActive)
+	o = msgp.AppendUint64(o, z.HotLo)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.HotHi)))
+	for za0001 := range z.HotHi {
+		o = msgp.AppendUint64(o, z.HotHi[za0001])
+	}
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Terms)))
+	for za0002 := range z.Terms {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Terms[za0002])))
+		for za0003 := range z.Terms[za0002] {
+			o, err = z.Terms[za0002][za0003].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Terms", za0002, za0003)
+				return
+			}
+		}
+	}
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Resets)))
+	for za0004 := range z.Resets {
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Resets[za0004])))
+		for za0005 := range z.Resets[za0004] {
+			o = msgp.AppendInt64(o, z.Resets[za0004][za0005])
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *stateV1T) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if zb0001 != 9 {
+		err = msgp.ArrayError{Wanted: 9, Got: zb0001}
+		return
+	}
+	z.Version, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	z.Kind, bts, err = msgp.ReadStringBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Kind")
+		return
+	}
+	z.Clock, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Clock")
+		return
+	}
+	z.GCMark, bts, err = msgp.ReadInt64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "GCMark")
+		return
+	}
+	z.NActive, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "NActive")
+		return
+	}
+	z.HotLo, bts, err = msgp.ReadUint64Bytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "HotLo")
+		return
+	}
+	var zb0002 uint32
+	zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "HotHi")
+		return
+	}
+	if cap(z.HotHi) >= int(zb0002) {
+		z.HotHi = (z.HotHi)[:zb0002]
+	} else {
+		z.HotHi = make([]uint64, zb0002)
+	}
+	for za0001 := range z.HotHi {
+		z.HotHi[za0001], bts, err = msgp.ReadUint64Bytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "HotHi", za0001)
+			return
+		}
+	}
+	var zb0003 uint32
+	zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Terms")
+		return
+	}
+	if cap(z.Terms) >= int(zb0003) {
+		z.Terms = (z.Terms)[:zb0003]
+	} else {
+		z.Terms = make([][]entry.LogEntry, zb0003)
+	}
+	for za0002 := range z.Terms {
+		var zb0004 uint32
+		zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Terms", za0002)
+			return
+		}
+		if cap(z.Terms[za0002]) >= int(zb0004) {
+			z.Terms[za0002] = (z.Terms[za0002])[:zb0004]
+		} else {
+			z.Terms[za0002] = make([]entry.LogEntry, zb0004)
+		}
+		for za0003 := range z.Terms[za0002] {
+			bts, err = z.Terms[za0002][za0003].UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Terms", za0002, za0003)
+				return
+			}
+		}
+	}
+	var zb0005 uint32
+	zb0005, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err, "Resets")
+		return
+	}
+	if cap(z.Resets) >= int(zb0005) {
+		z.Resets = (z.Resets)[:zb0005]
+	} else {
+		z.Resets = make([][]int64, zb0005)
+	}
+	for za0004 := range z.Resets {
+		var zb0006 uint32
+		zb0006, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			err = msgp.WrapError(err, "Resets", za0004)
+			return
+		}
+		if cap(z.Resets[za0004]) >= int(zb0006) {
+			z.Resets[za0004] = (z.Resets[za0004])[:zb0006]
+		} else {
+			z.Resets[za0004] = make([]int64, zb0006)
+		}
+		for za0005 := range z.Resets[za0004] {
+			z.Resets[za0004][za0005], bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Resets", za0004, za0005)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *stateV1T) Msgsize() (s int) {
+	s = 1 + msgp.IntSize + msgp.StringPrefixSize + len(z.Kind) + msgp.Int64Size + msgp.Int64Size + msgp.IntSize + msgp.Uint64Size + msgp.ArrayHeaderSize + (len(z.HotHi) * (msgp.Uint64Size)) + msgp.ArrayHeaderSize
+	for za0002 := range z.Terms {
+		s += msgp.ArrayHeaderSize
+		for za0003 := range z.Terms[za0002] {
+			s += z.Terms[za0002][za0003].Msgsize()
+		}
+	}
+	s += msgp.ArrayHeaderSize
+	for za0004 := range z.Resets {
+		s += msgp.ArrayHeaderSize + (len(z.Resets[za0004]) * (msgp.Int64Size))
+	}
+	return
+}
@@ -0,0 +1,335 @@
+package match
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type snapshotter interface {
+	Matcher
+	Snapshot() []byte
+	Restore([]byte) error
+}
+
+// Snapshot after every prefix of lines; the restored matcher must emit the
+// same hits as the original on the remainder.
+func testRestore[M snapshotter](t *testing.T, factory func() (M, error), lines []string) {
+	t.Helper()
+
+	var total int
+	for split := range len(lines) + 1 {
+		orig, err := factory()
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+
+		for i, line := range lines[:split] {
+			orig.Scan(LogEntry{Timestamp: int64(i + 1), Line: line})
+		}
+
+		restored, _ := factory()
+		if err := restored.Restore(orig.Snapshot()); err != nil {
+			t.Fatalf("Split %d: expected err == nil, got %v", split, err)
+		}
+
+		for i := split; i < len(lines); i++ {
+			e := LogEntry{Timestamp: int64(i + 1), Line: lines[i]}
+			want, got := orig.Scan(e), restored.Scan(e)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("Split %d line %d: expected %v, got %v", split, i, want, got)
+			}
+			total += want.Cnt
+		}
+
+		clock := int64(len(lines) + 100)
+		if want, got := orig.Eval(clock), restored.Eval(clock); !reflect.DeepEqual(want, got) {
+			t.Fatalf("Split %d: expected eval %v, got %v", split, want, got)
+		}
+	}
+
+	if total == 0 {
+		t.Fatalf("Expected hits after restore")
+	}
+}
+
+var snapshotLines = []string{
+	"alpha id=1", "noise", "beta id=2", "alpha id=3", "reset", "alpha id=1",
+	"beta id=1", "gamma", "beta id=3", "gamma", "alpha id=1", "noise",
+	"noise", "noise", "beta id=1", "gamma", "reset", "gamma",
+}
+
+func TestSnapshotSeq(t *testing.T) {
+	testRestore(t, func() (*MatchSeq, error) {
+		return NewMatchSeq(5, makeTermsA("alpha", "beta", "gamma")...)
+	}, snapshotLines)
+
+	// Dupes and correlated captures.
+	testRestore(t, func() (*MatchSeq, error) {
+		return NewMatchSeqOpts(5, []TermT{
+			captureTerm(`alpha id=(?P<id>\d)`),
+			makeRaw("alpha"),
+			captureTerm(`beta id=(?P<id>\d)`),
+		}, WithHitMeta(true))
+	}, snapshotLines)
+}
+
+func TestSnapshotSet(t *testing.T) {
+	testRestore(t, func() (*MatchSet, error) {
+		return NewMatchSet(5, makeTermsA("gamma", "beta", "alpha", "beta")...)
+	}, snapshotLines)
+}
+
+func TestSnapshotInverseSeq(t *testing.T) {
+	testRestore(t, func() (*InverseSeq, error) {
+		return NewInverseSeq(5, makeTermsA("alpha", "beta"), []ResetT{
+			{Term: makeRaw("reset"), Window: 2, Slide: -1},
+		})
+	}, snapshotLines)
+}
+
+func TestSnapshotInverseSet(t *testing.T) {
+	testRestore(t, func() (*InverseSet, error) {
+		return NewInverseSet(5, makeTermsA("beta", "alpha"), []ResetT{
+			{Term: makeRaw("reset"), Window: 3, Absolute: true},
+		})
+	}, snapshotLines)
+}
+
+func TestSnapshotDedupe(t *testing.T) {
+	var (
+		now  = time.Now().UnixNano()
+		hits Hits
+	)
+
+	sm, err := NewMatchSingleOpts(makeRaw("alpha"), WithHitMeta(true))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	appendHits(&hits, sm.Scan(LogEntry{Timestamp: now, Line: "alpha"}))
+	appendHits(&hits, sm.Scan(LogEntry{Timestamp: now + 1, Line: "alpha"}))
+
+	dd := NewDedupe(time.Hour)
+	dd.MaybeFireFrame(now+1, hits)
+
+	restored := NewDedupe(time.Hour)
+	if err := restored.Restore(dd.Snapshot()); err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	if !reflect.DeepEqual(dd, restored) {
+		t.Fatalf("Expected %v, got %v", dd, restored)
+	}
+
+	clock := now + int64(time.Hour)
+	if want, got := dd.PollFireFrame(), restored.PollFireFrame(); want.Logs != nil || got.Logs != nil {
+		t.Errorf("Expected no fire, got %v %v", want, got)
+	}
+	want, _ := dd.MaybeFireFrame(clock, Hits{})
+	got, _ := restored.MaybeFireFrame(clock, Hits{})
+	if want.Logs == nil || !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected pending frame %v, got %v", want, got)
+	}
+}
+
+func TestSnapshotFrameCount(t *testing.T) {
+	f := HitFrame{
+		Logs: []LogEntry{{Timestamp: 1, Line: "alpha"}, {Timestamp: 2, Line: "alpha"}},
+		Meta: []HitMeta{{Term: 0, Count: 3}, {Term: 0, Count: 3, Fields: []Field{{Name: "id", Value: "1"}}}},
+	}
+
+	wf := newFrame(f)
+	b, err := wf.MarshalMsg(nil)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var got frameT
+	rest, err := got.UnmarshalMsg(b)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("Expected err == nil, got %v %d", err, len(rest))
+	}
+	if !reflect.DeepEqual(f, got.frame()) {
+		t.Errorf("Expected %v, got %v", f, got.frame())
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	seq, _ := NewMatchSeq(5, makeTermsA("alpha", "beta")...)
+	seq.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	snap := seq.Snapshot()
+
+	set, _ := NewMatchSet(5, makeTermsA("alpha", "beta")...)
+	seq3, _ := NewMatchSeq(5, makeTermsA("alpha", "beta", "gamma")...)
+	inv, _ := NewInverseSeq(5, makeTermsA("alpha", "beta"), []ResetT{{Term: makeRaw("reset")}})
+
+	bad := append([]byte{}, snap...)
+	bad[1] = snapshotVersion + 1 // Version follows the array header
+
+	tests := map[string]struct {
+		m    snapshotter
+		data []byte
+		err  error
+	}{
+		"kind":      {m: set, data: snap, err: ErrSnapshotShape},
+		"terms":     {m: seq3, data: snap, err: ErrSnapshotShape},
+		"version":   {m: seq, data: bad, err: ErrSnapshotVersion},
+		"truncated": {m: seq, data: snap[:len(snap)-3], err: ErrSnapshot},
+		"empty":     {m: seq, data: nil, err: ErrSnapshot},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.m.Restore(tc.data); !errors.Is(err, tc.err) {
+				t.Errorf("Expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	// Restore from a sequence without resets.
+	if err := inv.Restore(func() []byte {
+		m, _ := NewInverseSeq(5, makeTermsA("alpha", "beta"), nil)
+		return m.Snapshot()
+	}()); !errors.Is(err, ErrSnapshotShape) {
+		t.Errorf("Expected ErrSnapshotShape, got %v", err)
+	}
+
+	// Failed restores leave the matcher intact.
+	if hits := seq.Scan(LogEntry{Timestamp: 2, Line: "beta"}); hits.Cnt != 1 {
+		t.Errorf("Expected hit, got %v", hits)
+	}
+}
+
+// Snapshots that would leave the matcher in a state it cannot scan from.
+func TestSnapshotInvalid(t *testing.T) {
+	var (
+		alpha = LogEntry{Timestamp: 1, Line: "alpha"}
+		beta  = LogEntry{Timestamp: 2, Line: "beta"}
+	)
+
+	state := func(kind string, fn func(st *stateT)) []byte {
+		st := stateT{
+			Version: snapshotVersion,
+			Kind:    kind,
+			Clock:   2,
+			Seq:     2,
+			Terms:   [][]LogEntry{{alpha}, {}},
+			Seqs:    [][]uint64{{1}, {}},
+		}
+		fn(&st)
+		return st.marshal()
+	}
+
+	seq, _ := NewMatchSeq(5, makeTermsA("alpha", "beta")...)
+	set, _ := NewMatchSet(5, makeTermsA("alpha", "beta")...)
+
+	tests := map[string]struct {
+		m    snapshotter
+		data []byte
+	}{
+		"emptyActive": {m: seq, data: state(kindSeq, func(st *stateT) {
+			st.NActive = 1
+			st.Terms[0], st.Seqs[0] = nil, nil
+		})},
+		"inactive": {m: seq, data: state(kindSeq, func(st *stateT) {})},
+		"future": {m: seq, data: state(kindSeq, func(st *stateT) {
+			st.NActive = 1
+			st.Clock = 0
+		})},
+		"order": {m: seq, data: state(kindSeq, func(st *stateT) {
+			st.NActive = 1
+			st.Terms[0], st.Seqs[0] = []LogEntry{beta, alpha}, []uint64{1, 2}
+		})},
+		"seqOrder": {m: seq, data: state(kindSeq, func(st *stateT) {
+			st.NActive = 1
+			st.Terms[0], st.Seqs[0] = []LogEntry{alpha, beta}, []uint64{2, 1}
+		})},
+		"seqs": {m: seq, data: state(kindSeq, func(st *stateT) {
+			st.NActive = 1
+			st.Seqs[0] = nil
+		})},
+		"hot": {m: set, data: state(kindSet, func(st *stateT) {
+			st.HotLo = 0b11
+		})},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.m.Restore(tc.data); !errors.Is(err, ErrSnapshot) {
+				t.Fatalf("Expected ErrSnapshot, got %v", err)
+			}
+			tc.m.Scan(LogEntry{Timestamp: 10, Line: "beta"})
+		})
+	}
+}
+
+// Version 1 snapshots restore as taken under OrderLenient.
+func TestSnapshotV1(t *testing.T) {
+	var (
+		// Taken after alpha@1, alpha@1, noise@2, alpha@2.
+		seqV1 = "9901a37365710200020090939383a16ca5616c706861a173a0a1740183a16ca5616c706861a173a0a1740183a16ca5616c706861a173a0a174029283a16ca5616c706861a173a0a1740183a16ca5616c706861a173a0a174029090"
+		// Taken after alpha@1, reset@2, beta@3, alpha@4.
+		invV1 = "9901aa696e7665727365536571040c020090939283a16ca5616c706861a173a0a1740183a16ca5616c706861a173a0a174049183a16ca462657461a173a0a1740390919102"
+	)
+
+	tests := map[string]struct {
+		factory func() (snapshotter, error)
+		snap    string
+		lines   []LogEntry
+	}{
+		"seq": {
+			factory: func() (snapshotter, error) {
+				return NewMatchSeq(10, makeTermsA("alpha", "alpha", "beta")...)
+			},
+			snap: seqV1,
+			lines: []LogEntry{
+				{Timestamp: 1, Line: "alpha"}, {Timestamp: 1, Line: "alpha"},
+				{Timestamp: 2, Line: "noise"}, {Timestamp: 2, Line: "alpha"},
+			},
+		},
+		"inverseSeq": {
+			factory: func() (snapshotter, error) {
+				return NewInverseSeq(10, makeTermsA("alpha", "beta", "gamma"), []ResetT{{Term: makeRaw("reset")}})
+			},
+			snap: invV1,
+			lines: []LogEntry{
+				{Timestamp: 1, Line: "alpha"}, {Timestamp: 2, Line: "reset"},
+				{Timestamp: 3, Line: "beta"}, {Timestamp: 4, Line: "alpha"},
+			},
+		},
+	}
+
+	rest := []LogEntry{
+		{Timestamp: 5, Line: "beta"}, {Timestamp: 6, Line: "gamma"},
+		{Timestamp: 7, Line: "beta"}, {Timestamp: 8, Line: "gamma"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tc.snap)
+
+			restored, _ := tc.factory()
+			if err := restored.Restore(b); err != nil {
+				t.Fatalf("Expected err == nil, got %v", err)
+			}
+
+			orig, _ := tc.factory()
+			for _, e := range tc.lines {
+				orig.Scan(e)
+			}
+
+			var total int
+			for _, e := range rest {
+				want, got := orig.Scan(e), restored.Scan(e)
+				if !reflect.DeepEqual(want, got) {
+					t.Fatalf("Line %v: expected %v, got %v", e, want, got)
+				}
+				total += want.Cnt
+			}
+			if total == 0 {
+				t.Errorf("Expected hits after restore")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package match
+
+// Stats are the runtime counters of a matcher along with an estimate of the
+// memory it holds.  Counters accumulate from construction; Asserts, Resets
+// and Bytes describe the state buffered at the time of the call.  Bytes is
+// estimated with LogEntry.Size plus 8 bytes per timestamp.
+
+type Stats struct {
+	Lines      int64   // Entries scanned
+	Matches    []int64 // Entries matched per term, buffered or not, by index as passed to the constructor; dupes count on the first
+	Hits       int64   // Frames fired
+	DropWindow int64   // Asserts dropped because their frame spanned more than the window
+	DropReset  int64   // Asserts dropped by a reset term
+	DropStale  int64   // Asserts dropped because their frame lost its first term
+	DropGC     int64   // Asserts evicted by garbage collection
+	DropLimit  int64   // Asserts evicted over WithMaxAsserts, WithMemoryLimit, WithMaxRuns or WithMaxSearch
+	OutOfOrder int64   // Entries rejected as older than the clock
+	Evicted    int64   // Partitions evicted (MatchPartition)
+	Asserts    int     // Entries buffered
+	Resets     int     // Reset timestamps buffered
+	Bytes      int     // Estimated size of buffered entries and timestamps
+}
+
+const stampSize = 8
+
+// A copy of the counters that does not share Matches.
+func (tr *tracerT) snapshot() Stats {
+	st := tr.stats
+	st.Matches = append([]int64(nil), st.Matches...)
+	return st
+}
+
+// Add the counters and buffers of o; Matches are summed by index.
+func (s *Stats) add(o Stats) {
+	s.Lines += o.Lines
+	s.Hits += o.Hits
+	s.DropWindow += o.DropWindow
+	s.DropReset += o.DropReset
+	s.DropStale += o.DropStale
+	s.DropGC += o.DropGC
+	s.DropLimit += o.DropLimit
+	s.OutOfOrder += o.OutOfOrder
+	s.Evicted += o.Evicted
+	s.Asserts += o.Asserts
+	s.Resets += o.Resets
+	s.Bytes += o.Bytes
+
+	if len(o.Matches) > len(s.Matches) {
+		s.Matches = append(s.Matches, make([]int64, len(o.Matches)-len(s.Matches))...)
+	}
+	for i, v := range o.Matches {
+		s.Matches[i] += v
+	}
+}
+
+func (s *Stats) addLog(e LogEntry) {
+	s.Asserts += 1
+	s.Bytes += e.Size()
+}
+
+func (s *Stats) addBuffered(terms []termT, resets []resetT) {
+	for _, term := range terms {
+		s.Asserts += len(term.asserts)
+		s.Bytes += term.bytes
+	}
+	for _, reset := range resets {
+		s.Resets += len(reset.resets)
+		s.Bytes += len(reset.resets) * stampSize
+	}
+}
+
+func (r *MatchSeq) Stats() Stats {
+	st := r.trace.snapshot()
+	st.addBuffered(r.terms, nil)
+	return st
+}
+
+func (r *MatchSet) Stats() Stats {
+	st := r.trace.snapshot()
+	st.addBuffered(r.terms, nil)
+	return st
+}
+
+func (r *InverseSeq) Stats() Stats {
+	st := r.trace.snapshot()
+	st.addBuffered(r.terms, r.resets)
+	return st
+}
+
+func (r *InverseSet) Stats() Stats {
+	st := r.trace.snapshot()
+	st.addBuffered(r.terms, r.resets)
+	return st
+}
+
+func (r *MatchPattern) Stats() Stats {
+	st := r.trace.snapshot()
+	for _, run := range r.runs {
+		for _, h := range run.hits {
+			st.Asserts += len(h.entries())
+		}
+	}
+	st.Bytes += r.bytes
+	return st
+}
+
+func (r *MatchSingle) Stats() Stats {
+	return r.trace.snapshot()
+}
+
+func (r *MatchCount) Stats() Stats {
+	st := r.trace.snapshot()
+	for _, e := range r.recent {
+		st.addLog(e)
+	}
+	if r.firstOk {
+		st.Bytes += r.first.Size()
+	}
+	if !r.tumbling {
+		st.Bytes += r.cnt * stampSize
+	}
+	return st
+}
+
+func (r *MatchAbsence) Stats() Stats {
+	st := r.trace.snapshot()
+	if r.armed {
+		st.addLog(r.last)
+	}
+	return st
+}
+
+// The counters of live and evicted partitions are summed; Lines and
+// OutOfOrder are those seen by the partition itself.
+func (r *MatchPartition) Stats() Stats {
+	st := r.trace.snapshot()
+	part := r.retired
+	part.Matches = append([]int64(nil), part.Matches...)
+
+	for el := r.lru.Front(); el != nil; el = el.Next() {
+		part.add(el.Value.(*partT).matcher.Stats())
+	}
+
+	part.Lines, part.OutOfOrder, part.Evicted = 0, 0, 0
+	st.add(part)
+	return st
+}
+
+// Matches counts the frames of each term; buffered state includes the term
+// matchers.
+func (r *NestedSeq) Stats() Stats {
+	return nestedStats(&r.trace, r.terms)
+}
+
+func (r *NestedSet) Stats() Stats {
+	return nestedStats(&r.trace, r.terms)
+}
+
+func nestedStats(tr *tracerT, terms []nestTermT) Stats {
+	st := tr.snapshot()
+	for _, t := range terms {
+		for _, f := range t.frames {
+			for _, e := range f.Logs {
+				st.addLog(e)
+			}
+		}
+
+		ts := t.matcher.Stats()
+		st.Asserts += ts.Asserts
+		st.Resets += ts.Resets
+		st.Bytes += ts.Bytes
+	}
+	return st
+}
+
+// RuleStats are the stats of a single matcher registered with the Engine.
+type RuleStats struct {
+	Id    string
+	Stats Stats
+}
+
+// Stats of every registered matcher, in registration order.
+func (e *Engine) Stats() []RuleStats {
+	stats := make([]RuleStats, 0, len(e.rules))
+	for _, r := range e.rules {
+		stats = append(stats, RuleStats{Id: r.id, Stats: r.matcher.Stats()})
+	}
+	return stats
+}
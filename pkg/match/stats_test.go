@@ -0,0 +1,231 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsSeq(t *testing.T) {
+	sm, err := NewMatchSeq(10, makeTermsA("alpha", "beta", "gamma")...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var (
+		alpha = LogEntry{Timestamp: 20, Line: "alpha"}
+		beta  = LogEntry{Timestamp: 21, Line: "beta"}
+	)
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+	sm.Scan(LogEntry{Timestamp: 1, Line: "gamma"})
+	sm.Scan(alpha)
+	sm.Scan(LogEntry{Timestamp: 20, Line: "noise"})
+	sm.Scan(LogEntry{Timestamp: 21, Line: "gamma"})
+	sm.Scan(beta)
+
+	want := Stats{
+		Lines:      7,
+		Matches:    []int64{2, 2, 1}, // gamma counts while beta is active
+		DropStale:  1,
+		DropGC:     1,
+		OutOfOrder: 1,
+		Asserts:    2,
+		Bytes:      alpha.Size() + beta.Size(),
+	}
+	if got := sm.Stats(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 22, Line: "gamma"})
+	if st := sm.Stats(); st.Hits != 1 || st.Matches[2] != 2 || st.Asserts != 0 || st.Bytes != 0 {
+		t.Errorf("Expected hit with nothing buffered, got %+v", st)
+	}
+}
+
+func TestStatsInverseSeq(t *testing.T) {
+	iq, err := NewInverseSeq(10, makeTermsA("alpha", "beta"), []ResetT{
+		{Term: makeRaw("reset")},
+	})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	alpha := LogEntry{Timestamp: 4, Line: "alpha"}
+
+	iq.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	iq.Scan(LogEntry{Timestamp: 2, Line: "reset"})
+	iq.Scan(LogEntry{Timestamp: 3, Line: "beta"})
+	iq.Scan(alpha)
+
+	want := Stats{
+		Lines:     4,
+		Matches:   []int64{2, 1},
+		DropReset: 1,
+		DropStale: 1,
+		Asserts:   1,
+		Resets:    1,
+		Bytes:     alpha.Size() + stampSize,
+	}
+	if got := iq.Stats(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	iq.Scan(LogEntry{Timestamp: 15, Line: "beta"})
+	if st := iq.Stats(); st.DropWindow != 1 || st.Hits != 0 {
+		t.Errorf("Expected window drop, got %+v", st)
+	}
+}
+
+func TestStatsSet(t *testing.T) {
+	sm, err := NewMatchSet(10, makeTermsA("alpha", "beta", "alpha")...)
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 2, Line: "beta"})
+	sm.Scan(LogEntry{Timestamp: 3, Line: "alpha"})
+
+	// Dupes count on the first occurrence.
+	st := sm.Stats()
+	if !reflect.DeepEqual(st.Matches, []int64{2, 1, 0}) || st.Hits != 1 || st.Asserts != 0 {
+		t.Errorf("Expected matches [2 1 0] and a hit, got %+v", st)
+	}
+
+	// Stats do not share state with the matcher.
+	st.Matches[0] = 100
+	if sm.Stats().Matches[0] != 2 {
+		t.Errorf("Expected copy of matches")
+	}
+}
+
+func TestStatsCount(t *testing.T) {
+	cm, err := NewMatchCount(10, 3, makeRaw("fail"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var (
+		e1 = LogEntry{Timestamp: 1, Line: "fail one"}
+		e2 = LogEntry{Timestamp: 2, Line: "fail two"}
+	)
+	cm.Scan(e1)
+	cm.Scan(e2)
+
+	want := Stats{
+		Lines:   2,
+		Matches: []int64{2},
+		Asserts: 2,
+		Bytes:   2*e1.Size() + e2.Size() + 2*stampSize, // First is retained separately
+	}
+	if got := cm.Stats(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// Matches count terms the matcher cannot take yet.
+func TestStatsUnbuffered(t *testing.T) {
+	pm, err := NewMatchPattern(10, []StepT{anyOf("alpha"), anyOf("beta")})
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	pm.Scan(LogEntry{Timestamp: 1, Line: "beta"})
+	pm.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+
+	if st := pm.Stats(); !reflect.DeepEqual(st.Matches, []int64{1, 1}) || st.Asserts != 1 {
+		t.Errorf("Expected both terms counted, got %+v", st)
+	}
+
+	am, err := NewMatchAbsence(10, makeRaw("fail"), WithStartTerm(makeRaw("start")))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+	am.Scan(LogEntry{Timestamp: 1, Line: "fail"})
+
+	if st := am.Stats(); !reflect.DeepEqual(st.Matches, []int64{1}) {
+		t.Errorf("Expected the disarmed match counted, got %+v", st)
+	}
+}
+
+func TestStatsPartition(t *testing.T) {
+	pm, err := NewMatchPartition(KeyT{Type: KeyRegex, Value: `id=(\w+)`}, seqFactory(10, "alpha", "beta"), WithMaxKeys(1))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 1, Line: "alpha id=a"})
+	pm.Scan(LogEntry{Timestamp: 2, Line: "beta id=a"})
+	pm.Scan(LogEntry{Timestamp: 3, Line: "alpha id=b"})
+	pm.Scan(LogEntry{Timestamp: 4, Line: "noise"})
+	pm.Scan(LogEntry{Timestamp: 3, Line: "beta id=b"})
+
+	// Partition a was evicted; its counters are kept.
+	want := Stats{
+		Lines:      5,
+		Matches:    []int64{2, 1},
+		Hits:       1,
+		OutOfOrder: 1,
+		Evicted:    1,
+		Asserts:    1,
+		Bytes:      LogEntry{Timestamp: 3, Line: "alpha id=b"}.Size(),
+	}
+	if got := pm.Stats(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestStatsNested(t *testing.T) {
+	nm, err := NewNestedSeq(10, seq(t, 5, "A", "B"), single(t, "C"))
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	var (
+		a = LogEntry{Timestamp: 1, Line: "A"}
+		b = LogEntry{Timestamp: 2, Line: "B"}
+		c = LogEntry{Timestamp: 3, Line: "A"}
+	)
+	nm.Scan(a)
+	nm.Scan(b)
+	nm.Scan(c)
+
+	// One queued frame of A, B, plus A buffered in the term matcher.
+	want := Stats{
+		Lines:   3,
+		Matches: []int64{1, 0},
+		Asserts: 3,
+		Bytes:   a.Size() + b.Size() + c.Size(),
+	}
+	if got := nm.Stats(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	nm.Scan(LogEntry{Timestamp: 4, Line: "C"})
+	if st := nm.Stats(); st.Hits != 1 || st.Matches[1] != 1 || st.Asserts != 1 {
+		t.Errorf("Expected hit, got %+v", st)
+	}
+}
+
+func TestStatsEngine(t *testing.T) {
+	engine := NewEngine()
+	for _, id := range []string{"b", "a"} {
+		m, err := NewMatchSingleOpts(makeRaw(id), WithTermCache(engine.Terms()))
+		if err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+		if err := engine.Add(id, m); err != nil {
+			t.Fatalf("Expected err == nil, got %v", err)
+		}
+	}
+
+	engine.Scan(LogEntry{Timestamp: 1, Line: "a"})
+
+	stats := engine.Stats()
+	if len(stats) != 2 || stats[0].Id != "b" || stats[1].Id != "a" {
+		t.Fatalf("Expected stats in registration order, got %+v", stats)
+	}
+	if stats[0].Stats.Hits != 0 || stats[1].Stats.Hits != 1 || stats[1].Stats.Lines != 1 {
+		t.Errorf("Expected a to fire, got %+v", stats)
+	}
+}
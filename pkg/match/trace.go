@@ -0,0 +1,189 @@
+package match
+
+// Tracing explains what a matcher did with the entries it scanned, eg. why a
+// rule did not fire on a given log.  Install a TraceFunc with WithTracer; the
+// matcher calls it synchronously on every state change.  Tracing is off by
+// default and costs a nil check when off.  The same events feed Stats.
+
+type TraceKindT uint8
+
+const (
+	TraceAssert     TraceKindT = iota // Entry matched Term
+	TraceDrop                         // Count asserts of Term were dropped; see Reason
+	TraceReset                        // Entry matched reset term Term
+	TraceGC                           // Garbage collection evicted Count asserts of Term
+	TraceHit                          // Frame fired
+	TraceOutOfOrder                   // Entry was older than the clock and discarded
+)
+
+func (k TraceKindT) String() string {
+	switch k {
+	case TraceAssert:
+		return "assert"
+	case TraceDrop:
+		return "drop"
+	case TraceReset:
+		return "reset"
+	case TraceGC:
+		return "gc"
+	case TraceHit:
+		return "hit"
+	case TraceOutOfOrder:
+		return "outOfOrder"
+	default:
+		return "unknown"
+	}
+}
+
+type DropReasonT uint8
+
+const (
+	DropNone   DropReasonT = iota
+	DropWindow             // The frame spanned more than the window
+	DropReset              // A reset term matched inside the reset window
+	DropStale              // The assert precedes the first term of the frame, or the frame lost its first term
+	DropEvict              // The partition Key was evicted (MatchPartition)
+	DropLimit              // The matcher was over WithMaxAsserts, WithMemoryLimit, WithMaxRuns or WithMaxSearch
+)
+
+func (r DropReasonT) String() string {
+	switch r {
+	case DropNone:
+		return "none"
+	case DropWindow:
+		return "window"
+	case DropReset:
+		return "reset"
+	case DropStale:
+		return "stale"
+	case DropEvict:
+		return "evict"
+	case DropLimit:
+		return "limit"
+	default:
+		return "unknown"
+	}
+}
+
+type TraceEvent struct {
+	Kind   TraceKindT
+	Reason DropReasonT // TraceDrop only
+	Term   int         // Index of the term or reset term as passed to the constructor; NoTerm if none
+	Count  int         // Asserts dropped or evicted, partitions evicted, or entries in a hit frame
+	Clock  int64       // Clock of the matcher
+	Key    string      // Partition key (MatchPartition)
+	Entry  LogEntry    // Entry scanned; TraceAssert, TraceReset and TraceOutOfOrder only
+	Frame  HitFrame    // TraceHit only
+}
+
+type TraceFunc func(TraceEvent)
+
+// Every matcher reports through a tracerT, which also keeps its Stats.
+type tracerT struct {
+	fn    TraceFunc
+	index []int // Constructor index per internal term; nil if the same
+	stats Stats
+}
+
+func newTracer(o optsT, nTerms int, index []int) tracerT {
+	return tracerT{
+		fn:    o.tracer,
+		index: index,
+		stats: Stats{Matches: make([]int64, nTerms)},
+	}
+}
+
+func (tr *tracerT) term(idx int) int {
+	if tr.index == nil || idx == NoTerm {
+		return idx
+	}
+	return tr.index[idx]
+}
+
+func (tr *tracerT) scan() {
+	tr.stats.Lines += 1
+}
+
+// Count a match of term idx, whether or not it is buffered.
+func (tr *tracerT) match(idx int) {
+	tr.stats.Matches[tr.term(idx)] += 1
+}
+
+func (tr *tracerT) assert(clock int64, idx int, e LogEntry) {
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceAssert, Term: tr.term(idx), Clock: clock, Entry: e})
+	}
+}
+
+// Count frames queued on a nested term; frames are not traced.
+func (tr *tracerT) frames(idx, cnt int) {
+	tr.stats.Matches[idx] += int64(cnt)
+}
+
+func (tr *tracerT) reset(clock int64, idx int, e LogEntry) {
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceReset, Term: idx, Clock: clock, Entry: e})
+	}
+}
+
+func (tr *tracerT) drop(clock int64, reason DropReasonT, idx, cnt int) {
+	if cnt <= 0 {
+		return
+	}
+
+	switch reason {
+	case DropWindow:
+		tr.stats.DropWindow += int64(cnt)
+	case DropReset:
+		tr.stats.DropReset += int64(cnt)
+	case DropStale:
+		tr.stats.DropStale += int64(cnt)
+	case DropLimit:
+		tr.stats.DropLimit += int64(cnt)
+	}
+
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceDrop, Reason: reason, Term: tr.term(idx), Count: cnt, Clock: clock})
+	}
+}
+
+func (tr *tracerT) gc(clock int64, idx, cnt int) {
+	if cnt <= 0 {
+		return
+	}
+
+	tr.stats.DropGC += int64(cnt)
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceGC, Term: tr.term(idx), Count: cnt, Clock: clock})
+	}
+}
+
+// Trace the last frame of hits.
+func (tr *tracerT) hit(clock int64, hits Hits) {
+	tr.stats.Hits += 1
+	if tr.fn != nil {
+		f := hits.Frame(hits.Cnt - 1)
+		tr.fn(TraceEvent{Kind: TraceHit, Term: NoTerm, Count: len(f.Logs), Clock: clock, Frame: f})
+	}
+}
+
+func (tr *tracerT) evict(clock int64, key string) {
+	tr.stats.Evicted += 1
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceDrop, Reason: DropEvict, Term: NoTerm, Count: 1, Clock: clock, Key: key})
+	}
+}
+
+func (tr *tracerT) outOfOrder(clock int64, e LogEntry) {
+	tr.stats.OutOfOrder += 1
+	if tr.fn != nil {
+		tr.fn(TraceEvent{Kind: TraceOutOfOrder, Term: NoTerm, Clock: clock, Entry: e})
+	}
+}
+
+// Trace the asserts of terms[from:] as dropped; call before clearing them.
+func (tr *tracerT) dropTerms(clock int64, reason DropReasonT, terms []termT, from int) {
+	for i := from; i < len(terms); i++ {
+		tr.drop(clock, reason, i, len(terms[i].asserts))
+	}
+}
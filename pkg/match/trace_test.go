@@ -0,0 +1,217 @@
+package match
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type traceLogT []string
+
+// Summarize events as "kind:term:count[:reason or line]" for comparison.
+func (tl *traceLogT) tracer() OptT {
+	return WithTracer(func(ev TraceEvent) {
+		s := fmt.Sprintf("%v:%d:%d", ev.Kind, ev.Term, ev.Count)
+		switch ev.Kind {
+		case TraceDrop:
+			s += ":" + ev.Reason.String()
+			if ev.Key != "" {
+				s += ":" + ev.Key
+			}
+		case TraceAssert, TraceReset, TraceOutOfOrder:
+			s += ":" + ev.Entry.Line
+		}
+		*tl = append(*tl, s)
+	})
+}
+
+func (tl *traceLogT) check(t *testing.T, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual([]string(*tl), want) {
+		t.Errorf("Expected trace:\n%v\ngot:\n%v", want, *tl)
+	}
+	*tl = nil
+}
+
+func TestTraceSeq(t *testing.T) {
+	var tl traceLogT
+	sm, err := NewMatchSeqOpts(10, makeTermsA("alpha", "beta", "gamma"), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	sm.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	sm.Scan(LogEntry{Timestamp: 5, Line: "beta"})
+	sm.Scan(LogEntry{Timestamp: 4, Line: "gamma"})
+	tl.check(t,
+		"assert:0:0:alpha",
+		"assert:1:0:beta",
+		"outOfOrder:-1:0:gamma",
+	)
+
+	// The window expires; the beta assert loses its alpha.
+	sm.Scan(LogEntry{Timestamp: 20, Line: "alpha"})
+	tl.check(t,
+		"gc:0:1",
+		"drop:1:1:stale",
+		"assert:0:0:alpha",
+	)
+
+	sm.Scan(LogEntry{Timestamp: 21, Line: "beta"})
+	hits := sm.Scan(LogEntry{Timestamp: 22, Line: "gamma"})
+	if hits.Cnt != 1 {
+		t.Fatalf("Expected hit, got %v", hits)
+	}
+	tl.check(t,
+		"assert:1:0:beta",
+		"assert:2:0:gamma",
+		"hit:-1:3",
+	)
+}
+
+func TestTraceInverseSeq(t *testing.T) {
+	var tl traceLogT
+	iq, err := NewInverseSeqOpts(10, makeTermsA("alpha", "beta"), []ResetT{
+		{Term: makeRaw("reset")},
+	}, tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	iq.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	iq.Scan(LogEntry{Timestamp: 2, Line: "reset"})
+	iq.Scan(LogEntry{Timestamp: 3, Line: "beta"})
+	tl.check(t,
+		"assert:0:0:alpha",
+		"reset:0:0:reset",
+		"assert:1:0:beta",
+		"drop:0:1:reset",
+		"drop:1:1:stale",
+	)
+
+	iq.Scan(LogEntry{Timestamp: 4, Line: "alpha"})
+	iq.Scan(LogEntry{Timestamp: 15, Line: "beta"})
+	tl.check(t,
+		"assert:0:0:alpha",
+		"assert:1:0:beta",
+		"drop:0:1:window",
+		"drop:1:1:stale",
+	)
+}
+
+func TestTraceSet(t *testing.T) {
+	var tl traceLogT
+	sm, err := NewMatchSetOpts(10, makeTermsA("alpha", "beta", "alpha", "gamma"), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	// Terms are reported by their index in the constructor.
+	sm.Scan(LogEntry{Timestamp: 1, Line: "gamma"})
+	sm.Scan(LogEntry{Timestamp: 20, Line: "beta"})
+	tl.check(t,
+		"assert:3:0:gamma",
+		"gc:3:1",
+		"assert:1:0:beta",
+	)
+}
+
+func TestTraceInverseSet(t *testing.T) {
+	var tl traceLogT
+	is, err := NewInverseSetOpts(10, makeTermsA("alpha", "beta"), []ResetT{
+		{Term: makeRaw("reset"), Window: 5, Absolute: true},
+	}, tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	is.Scan(LogEntry{Timestamp: 1, Line: "beta"})
+	is.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	is.Scan(LogEntry{Timestamp: 3, Line: "reset"})
+	is.Scan(LogEntry{Timestamp: 9, Line: "noise"})
+	tl.check(t,
+		"assert:1:0:beta",
+		"assert:0:0:alpha",
+		"reset:0:0:reset",
+		"drop:1:1:reset",
+	)
+}
+
+func TestTraceCount(t *testing.T) {
+	var tl traceLogT
+	cm, err := NewMatchCount(10, 2, makeRaw("fail"), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	cm.Scan(LogEntry{Timestamp: 1, Line: "fail"})
+	cm.Scan(LogEntry{Timestamp: 20, Line: "fail"})
+	cm.Scan(LogEntry{Timestamp: 21, Line: "fail"})
+	tl.check(t,
+		"assert:0:0:fail",
+		"gc:0:1",
+		"assert:0:0:fail",
+		"assert:0:0:fail",
+		"hit:-1:2",
+	)
+}
+
+func TestTraceAbsence(t *testing.T) {
+	var tl traceLogT
+	am, err := NewMatchAbsence(10, makeRaw("alpha"), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	am.Scan(LogEntry{Timestamp: 1, Line: "alpha"})
+	am.Eval(20)
+	tl.check(t,
+		"assert:0:0:alpha",
+		"hit:-1:1",
+	)
+}
+
+func TestTracePartition(t *testing.T) {
+	var tl traceLogT
+	pm, err := NewMatchPartition(KeyT{Type: KeyRegex, Value: `id=(\w+)`}, func() (Matcher, error) {
+		return NewMatchCount(10, 2, makeRaw("fail"))
+	}, WithMaxKeys(1), tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	pm.Scan(LogEntry{Timestamp: 1, Line: "fail id=a"})
+	pm.Scan(LogEntry{Timestamp: 2, Line: "fail id=b"})
+	pm.Scan(LogEntry{Timestamp: 1, Line: "fail id=b"})
+	tl.check(t,
+		"drop:-1:1:evict:a",
+		"outOfOrder:-1:0:fail id=b",
+	)
+}
+
+func TestTraceNested(t *testing.T) {
+	var tl traceLogT
+	nm, err := NewNestedSeqOpts(10, []Matcher{single(t, "alpha"), single(t, "beta")}, tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	nm.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	nm.Scan(LogEntry{Timestamp: 1, Line: "beta"})
+	if hits := nm.Scan(LogEntry{Timestamp: 3, Line: "beta"}); hits.Cnt != 1 {
+		t.Fatalf("Expected hit, got %v", hits)
+	}
+	tl.check(t,
+		"outOfOrder:-1:0:beta",
+		"hit:-1:2",
+	)
+
+	ns, err := NewNestedSetOpts(10, []Matcher{single(t, "alpha"), single(t, "beta")}, tl.tracer())
+	if err != nil {
+		t.Fatalf("Expected err == nil, got %v", err)
+	}
+
+	ns.Scan(LogEntry{Timestamp: 1, Line: "beta"})
+	ns.Scan(LogEntry{Timestamp: 2, Line: "alpha"})
+	tl.check(t, "hit:-1:2")
+}
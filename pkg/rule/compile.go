@@ -0,0 +1,543 @@
+package rule
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/match"
+)
+
+// CompiledT is a rule ready to scan.  Dedupe is nil unless the rule specified a dedupe window;
+// a partitioned rule dedupes each key within its matcher instead.
+type CompiledT struct {
+	Id      string
+	Matcher match.Matcher
+	Dedupe  *match.Dedupe
+}
+
+var keyTypes = map[string]match.KeyTypeT{
+	match.KeyStream.String(): match.KeyStream,
+	match.KeyRegex.String():  match.KeyRegex,
+	match.KeyJqJson.String(): match.KeyJqJson,
+	match.KeyJqYaml.String(): match.KeyJqYaml,
+}
+
+var orders = map[string]match.OrderT{
+	"":                          match.OrderLenient,
+	match.OrderLenient.String(): match.OrderLenient,
+	match.OrderStrict.String():  match.OrderStrict,
+	match.OrderInput.String():   match.OrderInput,
+}
+
+var selections = map[string]match.SelectT{
+	"":                              match.SelectEarliest,
+	match.SelectEarliest.String():   match.SelectEarliest,
+	match.SelectLatest.String():     match.SelectLatest,
+	match.SelectNonOverlap.String(): match.SelectNonOverlap,
+	match.SelectAll.String():        match.SelectAll,
+}
+
+var termTypes = map[string]match.TermTypeT{
+	"":                            match.TermRaw,
+	match.TermRaw.String():        match.TermRaw,
+	match.TermRegex.String():      match.TermRegex,
+	match.TermJqJson.String():     match.TermJqJson,
+	match.TermJqYaml.String():     match.TermJqYaml,
+	match.TermExpr.String():       match.TermExpr,
+	match.TermJqJsonFast.String(): match.TermJqJsonFast,
+}
+
+// Compile validates and compiles every rule in the document.
+// All validation errors are reported, not just the first.
+// Options are applied to every matcher; eg. match.WithTermCache
+// to share terms across rules scanned by a match.Engine.
+func (d *ParsedT) Compile(opts ...match.OptT) ([]CompiledT, error) {
+	var (
+		elist []error
+		ids   = make(map[string]struct{}, len(d.Rules))
+		out   = make([]CompiledT, 0, len(d.Rules))
+	)
+
+	for i, rule := range d.Rules {
+		switch _, ok := ids[rule.Id]; {
+		case rule.Id == "":
+			elist = append(elist, d.posErr(ErrRuleId, "rules", i))
+			continue
+		case ok:
+			elist = append(elist, d.posErr(ErrRuleDupeId, "rules", i, "id"))
+			continue
+		}
+		ids[rule.Id] = struct{}{}
+
+		c, err := d.compileRule(rule, opts, "rules", i)
+		if err != nil {
+			elist = append(elist, err)
+			continue
+		}
+		out = append(out, c)
+	}
+
+	if len(elist) > 0 {
+		return nil, errors.Join(elist...)
+	}
+
+	return out, nil
+}
+
+func (d *ParsedT) compileRule(rule RuleT, opts []match.OptT, path ...any) (CompiledT, error) {
+	if rule.Partition != nil {
+		return d.compilePartition(rule, opts, path...)
+	}
+
+	var (
+		err      error
+		elist    []error
+		window   int64
+		badWin   bool
+		lateness int64
+		nested   bool
+		pattern  bool
+		terms    []match.TermT
+		steps    []match.StepT
+		gaps     []match.GapT
+		resets   []match.ResetT
+		c        = CompiledT{Id: rule.Id}
+	)
+
+	if v, err := parseDuration(rule.Window); err != nil {
+		elist = append(elist, d.posErr(err, append(path, "window")...))
+		badWin = true
+	} else {
+		window = int64(v)
+	}
+
+	if v, err := parseDuration(rule.Lateness); err != nil {
+		elist = append(elist, d.posErr(err, append(path, "lateness")...))
+	} else {
+		lateness = int64(v)
+	}
+
+	if rule.Dedupe != "" {
+		if v, err := parseDuration(rule.Dedupe); err != nil {
+			elist = append(elist, d.posErr(err, append(path, "dedupe")...))
+		} else {
+			c.Dedupe = match.NewDedupe(v)
+		}
+	}
+
+	if len(rule.Terms) == 0 {
+		elist = append(elist, d.posErr(ErrNoTerms, append(path, "terms")...))
+	}
+
+	for i, term := range rule.Terms {
+		if term.MinGap != "" || term.MaxGap != "" {
+			if g, err := d.compileGap(rule, i, path...); err != nil {
+				elist = append(elist, err)
+			} else {
+				gaps = append(gaps, make([]match.GapT, i-1-len(gaps))...)
+				gaps = append(gaps, g)
+			}
+		}
+		if len(term.AnyOf) > 0 || term.Optional || term.Repeat != "" {
+			pattern = true
+		}
+		if term.Rule != nil {
+			nested = true
+			continue
+		}
+		s, err := d.compileStep(term, append(path, "terms", i)...)
+		if err != nil {
+			elist = append(elist, err)
+			continue
+		}
+		steps = append(steps, s)
+		terms = append(terms, s.Terms[0])
+	}
+
+	for i, reset := range rule.Resets {
+		r, err := d.compileReset(reset, len(rule.Terms), append(path, "resets", i)...)
+		if err != nil {
+			elist = append(elist, err)
+			continue
+		}
+		resets = append(resets, r)
+	}
+
+	// A rule without a window could never fire, or would fire on every entry.
+	switch rule.Type {
+	case TypeSeq, TypeSet, TypeCount, TypeAbsence:
+		if window <= 0 && !badWin {
+			elist = append(elist, d.posErr(ErrWindow, append(path, "window")...))
+		}
+	}
+
+	switch rule.Type {
+	case TypeSeq, TypeSet:
+		if nested && len(rule.Resets) > 0 {
+			elist = append(elist, d.posErr(ErrNestedResets, append(path, "resets")...))
+		}
+	case TypeSingle, TypeCount, TypeAbsence:
+		if len(rule.Terms) > 1 {
+			elist = append(elist, d.posErr(ErrSingleTerms, append(path, "terms")...))
+		}
+		if len(rule.Resets) > 0 {
+			elist = append(elist, d.posErr(ErrSingleResets, append(path, "resets")...))
+		}
+		if nested {
+			elist = append(elist, d.posErr(ErrSingleNested, append(path, "terms")...))
+		}
+		if rule.Type == TypeCount && rule.Count <= 0 {
+			elist = append(elist, d.posErr(ErrCount, append(path, "count")...))
+		}
+	default:
+		elist = append(elist, d.posErr(ErrRuleType, append(path, "type")...))
+	}
+
+	if pattern && (rule.Type != TypeSeq || nested || len(rule.Resets) > 0 || len(gaps) > 0 || rule.Order != "" || rule.Select != "") {
+		elist = append(elist, d.posErr(ErrPattern, append(path, "terms")...))
+	}
+
+	order, ok := orders[rule.Order]
+	if !ok {
+		elist = append(elist, d.posErr(ErrOrder, append(path, "order")...))
+	}
+
+	selection, ok := selections[rule.Select]
+	switch {
+	case !ok:
+		elist = append(elist, d.posErr(ErrSelect, append(path, "select")...))
+	case selection != match.SelectEarliest && len(rule.Resets) > 0:
+		elist = append(elist, d.posErr(ErrSelectResets, append(path, "select")...))
+	}
+
+	mOpts := append(slices.Clip(opts),
+		match.WithTumbling(rule.Tumbling),
+		match.WithOrder(order),
+		match.WithSelect(selection),
+		match.WithGaps(gaps...),
+	)
+	if rule.Start != nil {
+		if t, err := d.compileTerm(*rule.Start, append(path, "start")...); err != nil {
+			elist = append(elist, err)
+		} else {
+			mOpts = append(mOpts, match.WithStartTerm(t))
+		}
+	}
+
+	if len(elist) > 0 {
+		return c, errors.Join(elist...)
+	}
+
+	switch {
+	case nested:
+		c.Matcher, err = d.compileNested(rule, window, opts, path...)
+		if err != nil {
+			return c, err
+		}
+	case rule.Type == TypeSingle:
+		c.Matcher, err = match.NewMatchSingleOpts(terms[0], mOpts...)
+	case rule.Type == TypeCount:
+		c.Matcher, err = match.NewMatchCount(window, rule.Count, terms[0], mOpts...)
+	case rule.Type == TypeAbsence:
+		c.Matcher, err = match.NewMatchAbsence(window, terms[0], mOpts...)
+	case pattern:
+		c.Matcher, err = match.NewMatchPattern(window, steps, mOpts...)
+	case rule.Type == TypeSeq && len(resets) == 0:
+		c.Matcher, err = match.NewMatchSeqOpts(window, terms, mOpts...)
+	case rule.Type == TypeSeq:
+		c.Matcher, err = match.NewInverseSeqOpts(window, terms, resets, mOpts...)
+	case len(resets) == 0:
+		c.Matcher, err = match.NewMatchSetOpts(window, terms, mOpts...)
+	default:
+		c.Matcher, err = match.NewInverseSetOpts(window, terms, resets, mOpts...)
+	}
+
+	if err != nil {
+		return c, d.posErr(err, path...)
+	}
+
+	return d.reorder(c, lateness, opts, path...)
+}
+
+// Wrap the matcher in a MatchReorder if the rule specified a lateness.
+func (d *ParsedT) reorder(c CompiledT, lateness int64, opts []match.OptT, path ...any) (CompiledT, error) {
+	if lateness == 0 {
+		return c, nil
+	}
+
+	m, err := match.NewMatchReorder(lateness, c.Matcher, opts...)
+	if err != nil {
+		return c, d.posErr(err, append(path, "lateness")...)
+	}
+	c.Matcher = m
+
+	return c, nil
+}
+
+// The gap from the term before rule.Terms[i].
+func (d *ParsedT) compileGap(rule RuleT, i int, path ...any) (g match.GapT, err error) {
+	var (
+		elist []error
+		term  = rule.Terms[i]
+		tPath = append(path, "terms", i)
+	)
+
+	if i == 0 || rule.Type != TypeSeq || rule.Terms[i].Rule != nil || rule.Terms[i-1].Rule != nil {
+		return g, d.posErr(ErrGapTerm, tPath...)
+	}
+
+	if v, err := parseDuration(term.MinGap); err != nil {
+		elist = append(elist, d.posErr(err, append(tPath, "minGap")...))
+	} else {
+		g.Min = int64(v)
+	}
+
+	if v, err := parseDuration(term.MaxGap); err != nil {
+		elist = append(elist, d.posErr(err, append(tPath, "maxGap")...))
+	} else {
+		g.Max = int64(v)
+	}
+
+	return g, errors.Join(elist...)
+}
+
+// A partitioned rule compiles into a MatchPartition whose factory
+// compiles the rule without its partition block for each new key.  The
+// factory captures opts, so later compiles do not affect it.
+
+func (d *ParsedT) compilePartition(rule RuleT, opts []match.OptT, path ...any) (CompiledT, error) {
+	var (
+		elist []error
+		pOpts []match.OptT
+		part  = *rule.Partition
+		pPath = append(path, "partition")
+		c     = CompiledT{Id: rule.Id}
+	)
+
+	kt, ok := keyTypes[part.Type]
+	if !ok {
+		elist = append(elist, d.posErr(ErrKeyType, append(pPath, "type")...))
+	}
+
+	if part.MaxKeys > 0 {
+		pOpts = append(pOpts, match.WithMaxKeys(part.MaxKeys))
+	}
+
+	if part.Idle != "" {
+		if v, err := parseDuration(part.Idle); err != nil {
+			elist = append(elist, d.posErr(err, append(pPath, "idle")...))
+		} else {
+			pOpts = append(pOpts, match.WithIdle(int64(v)))
+		}
+	}
+
+	// Dedupe within the partition rather than across keys.
+	if rule.Dedupe != "" {
+		if v, err := parseDuration(rule.Dedupe); err != nil {
+			elist = append(elist, d.posErr(err, append(path, "dedupe")...))
+		} else {
+			pOpts = append(pOpts, match.WithDedupe(int64(v)))
+		}
+	}
+
+	// Reorder ahead of the partition rather than per key.
+	var lateness int64
+	if v, err := parseDuration(rule.Lateness); err != nil {
+		elist = append(elist, d.posErr(err, append(path, "lateness")...))
+	} else {
+		lateness = int64(v)
+	}
+
+	rule.Partition = nil
+	rule.Lateness = ""
+	rule.Dedupe = ""
+	inner, err := d.compileRule(rule, opts, path...)
+	if err != nil {
+		elist = append(elist, err)
+	}
+
+	if len(elist) > 0 {
+		return c, errors.Join(elist...)
+	}
+
+	first := inner.Matcher
+	factory := func() (match.Matcher, error) {
+		if m := first; m != nil {
+			first = nil
+			return m, nil
+		}
+		c, err := d.compileRule(rule, opts, path...)
+		return c.Matcher, err
+	}
+
+	if c.Matcher, err = match.NewMatchPartition(match.KeyT{Type: kt, Value: part.Value}, factory, pOpts...); err != nil {
+		return c, d.posErr(err, append(pPath, "value")...)
+	}
+
+	return d.reorder(c, lateness, opts, path...)
+}
+
+// A rule with nested terms compiles into a NestedSeq or NestedSet.
+// Leaf terms are wrapped in a MatchSingle.
+
+func (d *ParsedT) compileNested(rule RuleT, window int64, opts []match.OptT, path ...any) (match.Matcher, error) {
+	var (
+		elist []error
+		terms = make([]match.Matcher, 0, len(rule.Terms))
+	)
+
+	for i, term := range rule.Terms {
+		var (
+			m     match.Matcher
+			err   error
+			tPath = append(path, "terms", i)
+		)
+
+		if term.Rule != nil {
+			var c CompiledT
+			if c, err = d.compileRule(*term.Rule, opts, append(tPath, "rule")...); err == nil {
+				m = c.Matcher
+			}
+		} else {
+			var t match.TermT
+			if t, err = d.compileTerm(term, tPath...); err == nil {
+				m, err = match.NewMatchSingleOpts(t, opts...)
+			}
+		}
+
+		if err != nil {
+			elist = append(elist, err)
+			continue
+		}
+		terms = append(terms, m)
+	}
+
+	if len(elist) > 0 {
+		return nil, errors.Join(elist...)
+	}
+
+	var (
+		m   match.Matcher
+		err error
+	)
+
+	if rule.Type == TypeSeq {
+		m, err = match.NewNestedSeqOpts(window, terms, opts...)
+	} else {
+		m, err = match.NewNestedSetOpts(window, terms, opts...)
+	}
+
+	if err != nil {
+		return nil, d.posErr(err, path...)
+	}
+	return m, nil
+}
+
+func (d *ParsedT) compileTerm(term TermT, path ...any) (match.TermT, error) {
+	tt, ok := termTypes[term.Type]
+	if !ok {
+		return match.TermT{}, d.posErr(ErrTermType, append(path, "type")...)
+	}
+
+	t := match.TermT{Type: tt, Value: term.Value, Stream: term.Stream}
+
+	// Compile to surface regex/jq errors at the term's position.
+	if _, err := t.NewMatcher(); err != nil {
+		return t, d.posErr(err, append(path, "value")...)
+	}
+
+	if term.Extract != "" {
+		t.Extract = term.Extract
+		if _, err := t.NewMatcher(); err != nil {
+			return t, d.posErr(err, append(path, "extract")...)
+		}
+	}
+
+	if term.Capture {
+		t.Capture = true
+		if _, err := t.NewMatcher(); err != nil {
+			return t, d.posErr(err, append(path, "capture")...)
+		}
+	}
+
+	return t, nil
+}
+
+// A term with anyOf compiles each alternative; otherwise the term itself.
+func (d *ParsedT) compileStep(term TermT, path ...any) (match.StepT, error) {
+	var (
+		elist []error
+		s     = match.StepT{Optional: term.Optional}
+	)
+
+	if term.Repeat != "" {
+		if lo, hi, err := parseRepeat(term.Repeat); err != nil {
+			elist = append(elist, d.posErr(err, append(path, "repeat")...))
+		} else {
+			// {0,m} is an optional step.
+			s.Min, s.Max = lo, hi
+			s.Optional = s.Optional || lo == 0
+		}
+	}
+
+	if len(term.AnyOf) == 0 {
+		t, err := d.compileTerm(term, path...)
+		s.Terms = []match.TermT{t}
+		return s, errors.Join(append(elist, err)...)
+	}
+
+	if term.Value != "" {
+		return s, d.posErr(ErrAnyOf, append(path, "value")...)
+	}
+
+	for j, alt := range term.AnyOf {
+		aPath := append(path, "anyOf", j)
+		if alt.Rule != nil || len(alt.AnyOf) > 0 || alt.Repeat != "" || alt.Optional {
+			elist = append(elist, d.posErr(ErrAnyOf, aPath...))
+			continue
+		}
+		t, err := d.compileTerm(alt, aPath...)
+		if err != nil {
+			elist = append(elist, err)
+			continue
+		}
+		s.Terms = append(s.Terms, t)
+	}
+
+	return s, errors.Join(elist...)
+}
+
+func (d *ParsedT) compileReset(reset ResetT, nTerms int, path ...any) (match.ResetT, error) {
+	var elist []error
+
+	term, err := d.compileTerm(reset.Term, append(path, "term")...)
+	if err != nil {
+		elist = append(elist, err)
+	}
+
+	window, err := parseDuration(reset.Window)
+	if err != nil {
+		elist = append(elist, d.posErr(err, append(path, "window")...))
+	}
+
+	slide, err := parseDuration(reset.Slide)
+	if err != nil {
+		elist = append(elist, d.posErr(err, append(path, "slide")...))
+	}
+
+	if reset.Anchor < 0 || reset.Anchor >= nTerms && nTerms > 0 {
+		elist = append(elist, d.posErr(ErrAnchorRange, append(path, "anchor")...))
+	}
+
+	if len(elist) > 0 {
+		return match.ResetT{}, errors.Join(elist...)
+	}
+
+	return match.ResetT{
+		Term:     term,
+		Window:   int64(window),
+		Slide:    int64(slide),
+		Anchor:   reset.Anchor,
+		Absolute: reset.Absolute,
+	}, nil
+}
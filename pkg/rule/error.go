@@ -0,0 +1,47 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoRules      = errors.New("no rules")
+	ErrRuleId       = errors.New("missing rule id")
+	ErrRuleDupeId   = errors.New("duplicate rule id")
+	ErrRuleType     = errors.New("unknown rule type")
+	ErrTermType     = errors.New("unknown term type")
+	ErrDuration     = errors.New("invalid duration")
+	ErrNoTerms      = errors.New("no terms")
+	ErrSingleTerms  = errors.New("rule type requires exactly one term")
+	ErrSingleResets = errors.New("rule type does not support resets")
+	ErrSingleNested = errors.New("rule type does not support nested rules")
+	ErrCount        = errors.New("count rule requires a positive count")
+	ErrWindow       = errors.New("rule type requires a positive window")
+	ErrNestedResets = errors.New("resets not supported on rule with nested terms")
+	ErrAnchorRange  = errors.New("anchor out of range")
+	ErrKeyType      = errors.New("unknown partition key type")
+	ErrOrder        = errors.New("unknown order")
+	ErrSelect       = errors.New("unknown selection")
+	ErrSelectResets = errors.New("selection not supported on rule with resets")
+	ErrGapTerm      = errors.New("gap only supported on a later term of a seq rule")
+	ErrAnyOf        = errors.New("anyOf term cannot have a value, and its alternatives cannot have a rule, anyOf, optional or repeat")
+	ErrPattern      = errors.New("anyOf, optional and repeat terms only supported on a seq rule without resets, gaps, order or select")
+	ErrRepeat       = errors.New("invalid repeat")
+)
+
+// PosError decorates a rule error with its position in the source document.
+type PosError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *PosError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *PosError) Unwrap() error {
+	return e.Err
+}
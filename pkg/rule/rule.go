@@ -0,0 +1,296 @@
+// Package rule loads declarative YAML or JSON rule documents and compiles
+// them into match.Matcher trees.  JSON is a subset of YAML, so both formats
+// share the same parser.  A document looks like:
+//
+//	rules:
+//	  - id: oom-crash
+//	    type: seq
+//	    window: 10m
+//	    terms:
+//	      - value: OOMKilled
+//	      - type: regex
+//	        value: 'Back-off restarting failed container \w+'
+//	    resets:
+//	      - term: { value: "recovered" }
+//	        window: 5m
+//	    dedupe: 1h
+//
+// A term may specify a nested rule instead of a value; the nested rule's hits
+// then act as a single event in the parent, which compiles into a
+// match.NestedSeq or match.NestedSet.
+//
+// A term of a seq rule may list alternatives under anyOf, be marked optional,
+// or repeat, eg. "{3}", "{2,5}" or "{3,}"; the rule then compiles into a
+// match.MatchPattern.
+//
+// A rule with a partition block keeps an independent matcher per key, such
+// as a pod name, and compiles into a match.MatchPartition.  A dedupe window
+// then applies per key.
+//
+// Validation errors are reported as *PosError with the file, line and
+// column of the offending node.
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/match"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+const (
+	TypeSeq     = "seq"
+	TypeSet     = "set"
+	TypeSingle  = "single"
+	TypeCount   = "count"
+	TypeAbsence = "absence"
+)
+
+type DocT struct {
+	Rules []RuleT `yaml:"rules" json:"rules"`
+}
+
+type RuleT struct {
+	Id     string   `yaml:"id" json:"id"`
+	Type   string   `yaml:"type" json:"type"`
+	Window string   `yaml:"window,omitempty" json:"window,omitempty"`
+	Terms  []TermT  `yaml:"terms" json:"terms"`
+	Resets []ResetT `yaml:"resets,omitempty" json:"resets,omitempty"`
+	Dedupe string   `yaml:"dedupe,omitempty" json:"dedupe,omitempty"`
+
+	// Reorder entries that arrive up to Lateness out of order; hits are delayed by as much.
+	Lateness string `yaml:"lateness,omitempty" json:"lateness,omitempty"`
+
+	// Count rules only
+	Count    int  `yaml:"count,omitempty" json:"count,omitempty"`
+	Tumbling bool `yaml:"tumbling,omitempty" json:"tumbling,omitempty"`
+
+	// Seq rules only; lenient, strict or input.  Defaults to lenient.
+	Order string `yaml:"order,omitempty" json:"order,omitempty"`
+
+	// Seq and set rules without resets; earliest, latest, nonOverlapping or all.
+	Select string `yaml:"select,omitempty" json:"select,omitempty"`
+
+	// Absence rules only; arms on the first event if not specified.
+	Start *TermT `yaml:"start,omitempty" json:"start,omitempty"`
+
+	// Run an independent instance of the rule per extracted key.
+	Partition *PartitionT `yaml:"partition,omitempty" json:"partition,omitempty"`
+}
+
+// PartitionT extracts the key from the line with a regex or jq program,
+// or uses the stream name if Type is "stream".
+type PartitionT struct {
+	Type    string `yaml:"type" json:"type"`
+	Value   string `yaml:"value,omitempty" json:"value,omitempty"`
+	MaxKeys int    `yaml:"maxKeys,omitempty" json:"maxKeys,omitempty"`
+	Idle    string `yaml:"idle,omitempty" json:"idle,omitempty"`
+}
+
+// TermT defaults to a raw term if Type is not specified.
+// A term may instead specify a nested Rule whose hits act as a single event.
+// Extract is a jq program yielding fields to correlate on; jq terms only.
+// Capture correlates on the named groups of a regex term instead.
+// Stream restricts the term to entries on a stream, eg. stderr.
+// MinGap and MaxGap bound the delay from the previous term of a seq rule.
+// On a seq rule, AnyOf lists alternatives in place of a value, Optional lets
+// the term be skipped and Repeat is a quantifier such as "{3,}"; the rule
+// then compiles into a match.MatchPattern.
+type TermT struct {
+	Type     string  `yaml:"type,omitempty" json:"type,omitempty"`
+	Value    string  `yaml:"value,omitempty" json:"value,omitempty"`
+	Extract  string  `yaml:"extract,omitempty" json:"extract,omitempty"`
+	Capture  bool    `yaml:"capture,omitempty" json:"capture,omitempty"`
+	Stream   string  `yaml:"stream,omitempty" json:"stream,omitempty"`
+	MinGap   string  `yaml:"minGap,omitempty" json:"minGap,omitempty"`
+	MaxGap   string  `yaml:"maxGap,omitempty" json:"maxGap,omitempty"`
+	AnyOf    []TermT `yaml:"anyOf,omitempty" json:"anyOf,omitempty"`
+	Optional bool    `yaml:"optional,omitempty" json:"optional,omitempty"`
+	Repeat   string  `yaml:"repeat,omitempty" json:"repeat,omitempty"`
+	Rule     *RuleT  `yaml:"rule,omitempty" json:"rule,omitempty"`
+}
+
+type ResetT struct {
+	Term     TermT  `yaml:"term" json:"term"`
+	Window   string `yaml:"window,omitempty" json:"window,omitempty"`
+	Slide    string `yaml:"slide,omitempty" json:"slide,omitempty"`
+	Anchor   int    `yaml:"anchor,omitempty" json:"anchor,omitempty"`
+	Absolute bool   `yaml:"absolute,omitempty" json:"absolute,omitempty"`
+}
+
+// LoadFile reads and compiles the rule document at path.
+func LoadFile(path string) ([]CompiledT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(path, data)
+}
+
+// Load parses and compiles a rule document; fname is used for error reporting only.
+func Load(fname string, data []byte) ([]CompiledT, error) {
+	doc, err := Parse(fname, data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Compile()
+}
+
+// ParsedT is a decoded rule document along with the AST used to
+// resolve source positions during validation.
+type ParsedT struct {
+	DocT
+	fname string
+	file  *ast.File
+}
+
+func Parse(fname string, data []byte) (*ParsedT, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, wrapYamlErr(fname, err)
+	}
+
+	doc := &ParsedT{
+		fname: fname,
+		file:  file,
+	}
+
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return nil, &PosError{File: fname, Line: 1, Column: 1, Err: ErrNoRules}
+	}
+
+	if err = yaml.NodeToValue(file.Docs[0].Body, &doc.DocT, yaml.Strict()); err != nil {
+		return nil, wrapYamlErr(fname, err)
+	}
+
+	if len(doc.Rules) == 0 {
+		return nil, doc.posErr(ErrNoRules)
+	}
+
+	return doc, nil
+}
+
+// Resolve the position of the node at path and wrap err accordingly.
+// Falls back to the closest ancestor if the node does not exist.
+
+func (d *ParsedT) posErr(err error, path ...any) error {
+	for n := len(path); n >= 0; n-- {
+		b := (&yaml.PathBuilder{}).Root()
+		for _, p := range path[:n] {
+			switch v := p.(type) {
+			case string:
+				b = b.Child(v)
+			case int:
+				b = b.Index(uint(v))
+			}
+		}
+
+		node, ferr := b.Build().FilterFile(d.file)
+		if ferr != nil || node == nil {
+			continue
+		}
+
+		tk := node.GetToken()
+		return &PosError{File: d.fname, Line: tk.Position.Line, Column: tk.Position.Column, Err: err}
+	}
+
+	return &PosError{File: d.fname, Line: 1, Column: 1, Err: err}
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w '%s'", ErrDuration, s)
+	}
+	return v, nil
+}
+
+// Parse a quantifier of the form {n}, {n,m} or {n,}; hi is
+// match.Unbounded for {n,}.
+func parseRepeat(s string) (lo, hi int, err error) {
+	var (
+		ok   bool
+		body string
+		bad  = fmt.Errorf("%w '%s'", ErrRepeat, s)
+	)
+
+	if body, ok = strings.CutPrefix(s, "{"); ok {
+		body, ok = strings.CutSuffix(body, "}")
+	}
+	if !ok {
+		return 0, 0, bad
+	}
+
+	loS, hiS, ranged := strings.Cut(body, ",")
+
+	if lo, err = strconv.Atoi(loS); err != nil || lo < 0 {
+		return 0, 0, bad
+	}
+
+	switch {
+	case !ranged:
+		hi = lo
+	case hiS == "":
+		hi = match.Unbounded
+	default:
+		if hi, err = strconv.Atoi(hiS); err != nil || hi < lo {
+			return 0, 0, bad
+		}
+	}
+
+	if hi == 0 {
+		return 0, 0, bad
+	}
+	return lo, hi, nil
+}
+
+func wrapYamlErr(fname string, err error) error {
+	var (
+		tk      *token.Token
+		synErr  *yaml.SyntaxError
+		typeErr *yaml.TypeError
+		ovrErr  *yaml.OverflowError
+		dupErr  *yaml.DuplicateKeyError
+		unkErr  *yaml.UnknownFieldError
+		nodeErr *yaml.UnexpectedNodeTypeError
+		msg     string
+	)
+
+	switch {
+	case errors.As(err, &synErr):
+		tk, msg = synErr.Token, synErr.Message
+	case errors.As(err, &typeErr):
+		tk, msg = typeErr.Token, fmt.Sprintf("cannot unmarshal %s into %s", typeErr.SrcType, typeErr.DstType)
+	case errors.As(err, &ovrErr):
+		tk, msg = ovrErr.Token, fmt.Sprintf("overflow %s into %s", ovrErr.SrcNum, ovrErr.DstType)
+	case errors.As(err, &dupErr):
+		tk, msg = dupErr.Token, dupErr.Message
+	case errors.As(err, &unkErr):
+		tk, msg = unkErr.Token, unkErr.Message
+	case errors.As(err, &nodeErr):
+		tk, msg = nodeErr.Token, fmt.Sprintf("%s was used where %s is expected", nodeErr.Actual.YAMLName(), nodeErr.Expected.YAMLName())
+	}
+
+	if tk == nil {
+		return fmt.Errorf("%s: %w", fname, err)
+	}
+
+	return &PosError{
+		File:   fname,
+		Line:   tk.Position.Line,
+		Column: tk.Position.Column,
+		Err:    errors.New(msg),
+	}
+}
@@ -0,0 +1,729 @@
+package rule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/match"
+)
+
+func TestLoadYaml(t *testing.T) {
+	doc := `
+rules:
+  - id: seq
+    type: seq
+    window: 10s
+    terms:
+      - value: alpha
+      - type: regex
+        value: 'beta\d+'
+  - id: set
+    type: set
+    window: 10s
+    terms:
+      - value: alpha
+      - value: beta
+    dedupe: 1m
+  - id: inverse
+    type: seq
+    window: 10s
+    terms:
+      - value: alpha
+      - value: beta
+    resets:
+      - term: { value: reset }
+        window: 5s
+        slide: -1s
+        anchor: 1
+  - id: single
+    type: single
+    terms:
+      - type: jqJson
+        value: .shrubbery
+        stream: stderr
+  - id: count
+    type: count
+    window: 10m
+    count: 5
+    terms:
+      - value: OOMKilled
+  - id: absence
+    type: absence
+    window: 30s
+    start: { value: leader elected }
+    terms:
+      - value: renewed lease
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	if len(rules) != 6 {
+		t.Fatalf("Expected 6 rules, got %v", len(rules))
+	}
+
+	if _, ok := rules[0].Matcher.(*match.MatchSeq); !ok {
+		t.Errorf("Expected *MatchSeq, got %T", rules[0].Matcher)
+	}
+	if _, ok := rules[1].Matcher.(*match.MatchSet); !ok {
+		t.Errorf("Expected *MatchSet, got %T", rules[1].Matcher)
+	}
+	if rules[1].Dedupe == nil {
+		t.Errorf("Expected dedupe on rule %v", rules[1].Id)
+	}
+	if _, ok := rules[2].Matcher.(*match.InverseSeq); !ok {
+		t.Errorf("Expected *InverseSeq, got %T", rules[2].Matcher)
+	}
+	if _, ok := rules[3].Matcher.(*match.MatchSingle); !ok {
+		t.Errorf("Expected *MatchSingle, got %T", rules[3].Matcher)
+	} else if hits := rules[3].Matcher.Scan(match.LogEntry{Line: `{"shrubbery": 1}`, Stream: "stdout"}); hits.Cnt != 0 {
+		t.Errorf("Expected no hit on stdout, got %v", hits.Cnt)
+	}
+	if _, ok := rules[4].Matcher.(*match.MatchCount); !ok {
+		t.Errorf("Expected *MatchCount, got %T", rules[4].Matcher)
+	}
+	if _, ok := rules[5].Matcher.(*match.MatchAbsence); !ok {
+		t.Errorf("Expected *MatchAbsence, got %T", rules[5].Matcher)
+	}
+
+	var (
+		m     = rules[0].Matcher
+		clock = time.Now().UnixNano()
+	)
+
+	m.Scan(match.LogEntry{Line: "alpha", Timestamp: clock})
+	hits := m.Scan(match.LogEntry{Line: "beta12", Timestamp: clock + 1})
+	if hits.Cnt != 1 {
+		t.Errorf("Expected 1 hit, got %v", hits.Cnt)
+	}
+}
+
+func TestLoadJson(t *testing.T) {
+	doc := `{"rules": [{"id": "json", "type": "set", "window": "1s", "terms": [{"value": "alpha"}, {"value": "beta"}]}]}`
+
+	rules, err := Load("test.json", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	if len(rules) != 1 || rules[0].Id != "json" {
+		t.Fatalf("Expected single rule 'json', got %v", rules)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	var tests = map[string]struct {
+		doc  string
+		err  error
+		line int
+	}{
+		"NoRules": {
+			doc:  "rules: []\n",
+			err:  ErrNoRules,
+			line: 1,
+		},
+		"BadType": {
+			doc:  "rules:\n  - id: a\n    type: nope\n    terms:\n      - value: a\n",
+			err:  ErrRuleType,
+			line: 3,
+		},
+		"MissingWindow": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    terms:\n      - value: a\n",
+			err:  ErrWindow,
+			line: 2,
+		},
+		"EmptyWindow": {
+			doc:  "rules:\n  - id: a\n    type: count\n    count: 3\n    window: \"\"\n    terms:\n      - value: a\n",
+			err:  ErrWindow,
+			line: 5,
+		},
+		"NegativeWindow": {
+			doc:  "rules:\n  - id: a\n    type: absence\n    window: -1m\n    terms:\n      - value: a\n",
+			err:  ErrWindow,
+			line: 4,
+		},
+		"BadWindow": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 10parsecs\n    terms:\n      - value: a\n",
+			err:  ErrDuration,
+			line: 4,
+		},
+		"MissingId": {
+			doc:  "rules:\n  - type: seq\n    terms:\n      - value: a\n",
+			err:  ErrRuleId,
+			line: 2,
+		},
+		"DupeId": {
+			doc:  "rules:\n  - id: a\n    type: single\n    terms:\n      - value: a\n  - id: a\n    type: single\n    terms:\n      - value: b\n",
+			err:  ErrRuleDupeId,
+			line: 6,
+		},
+		"NoTerms": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms: []\n",
+			err:  ErrNoTerms,
+			line: 5,
+		},
+		"BadTermType": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - type: xml\n        value: a\n",
+			err:  ErrTermType,
+			line: 6,
+		},
+		"BadRegex": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - type: regex\n        value: '(['\n",
+			err:  match.ErrTermCompile,
+			line: 7,
+		},
+		"EmptyTerm": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - type: raw\n",
+			err:  match.ErrTermEmpty,
+			line: 6,
+		},
+		"BadAnchor": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n    resets:\n      - term: {value: b}\n        anchor: 3\n",
+			err:  ErrAnchorRange,
+			line: 9,
+		},
+		"NegativeAnchor": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n    resets:\n      - term: {value: b}\n        anchor: -1\n",
+			err:  ErrAnchorRange,
+			line: 9,
+		},
+		"CountMissing": {
+			doc:  "rules:\n  - id: a\n    type: count\n    window: 1m\n    terms:\n      - value: a\n",
+			err:  ErrCount,
+			line: 2,
+		},
+		"SingleResets": {
+			doc:  "rules:\n  - id: a\n    type: single\n    terms:\n      - value: a\n    resets:\n      - term: {value: b}\n",
+			err:  ErrSingleResets,
+			line: 7,
+		},
+		"BadKeyType": {
+			doc:  "rules:\n  - id: a\n    type: single\n    terms:\n      - value: a\n    partition:\n      type: xml\n",
+			err:  ErrKeyType,
+			line: 7,
+		},
+		"BadExpr": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - type: expr\n        value: 'raw(\"a\") and'\n",
+			err:  match.ErrExprSyntax,
+			line: 7,
+		},
+		"BadOrder": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    order: loose\n    terms:\n      - value: a\n",
+			err:  ErrOrder,
+			line: 5,
+		},
+		"BadSelect": {
+			doc:  "rules:\n  - id: a\n    type: set\n    window: 1m\n    select: first\n    terms:\n      - value: a\n",
+			err:  ErrSelect,
+			line: 5,
+		},
+		"SelectResets": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    select: all\n    terms:\n      - value: a\n    resets:\n      - term: {value: b}\n",
+			err:  ErrSelectResets,
+			line: 5,
+		},
+		"GapFirstTerm": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n        maxGap: 1s\n      - value: b\n",
+			err:  ErrGapTerm,
+			line: 6,
+		},
+		"GapSet": {
+			doc:  "rules:\n  - id: a\n    type: set\n    window: 1m\n    terms:\n      - value: a\n      - value: b\n        maxGap: 1s\n",
+			err:  ErrGapTerm,
+			line: 7,
+		},
+		"BadGap": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n      - value: b\n        minGap: soon\n",
+			err:  ErrDuration,
+			line: 8,
+		},
+		"AnyOfValue": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n        anyOf:\n          - value: b\n",
+			err:  ErrAnyOf,
+			line: 6,
+		},
+		"AnyOfBadTerm": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - anyOf:\n          - value: b\n          - type: regex\n            value: '('\n",
+			err:  match.ErrTermCompile,
+			line: 9,
+		},
+		"PatternSet": {
+			doc:  "rules:\n  - id: a\n    type: set\n    window: 1m\n    terms:\n      - value: a\n        optional: true\n      - value: b\n",
+			err:  ErrPattern,
+			line: 6,
+		},
+		"OptionalLast": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n      - value: b\n        optional: true\n",
+			err:  match.ErrStepOptional,
+			line: 2,
+		},
+		"BadRepeat": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n      - value: b\n        repeat: '{3,2}'\n      - value: c\n",
+			err:  ErrRepeat,
+			line: 8,
+		},
+		"RepeatOptionalMin": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n        optional: true\n        repeat: '{2,}'\n      - value: b\n",
+			err:  match.ErrStepRepeat,
+			line: 2,
+		},
+		"ExtractNotJq": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n        extract: '{a: .a}'\n",
+			err:  match.ErrTermExtract,
+			line: 7,
+		},
+		"CorrelateReset": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - type: regex\n        value: 'start (?P<req>\\d+)'\n        capture: true\n      - type: regex\n        value: 'fail (?P<req>\\d+)'\n        capture: true\n    resets:\n      - term:\n          value: shutdown\n",
+			err:  match.ErrCorrelateInverse,
+			line: 2,
+		},
+		"CaptureNotRegex": {
+			doc:  "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - value: a\n        capture: true\n",
+			err:  match.ErrTermCapture,
+			line: 7,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load("test.yaml", []byte(tc.doc))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected %v, got %v", tc.err, err)
+			}
+
+			var pErr *PosError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("Expected *PosError, got %T", err)
+			}
+			if pErr.Line != tc.line {
+				t.Errorf("Expected line %v, got %v: %v", tc.line, pErr.Line, pErr)
+			}
+			if pErr.File != "test.yaml" {
+				t.Errorf("Expected file test.yaml, got %v", pErr.File)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	doc := "rules:\n  - id: a\n    type: seq\n    windoe: 1s\n    terms:\n      - value: a\n"
+
+	_, err := Load("test.yaml", []byte(doc))
+
+	var pErr *PosError
+	if !errors.As(err, &pErr) {
+		t.Fatalf("Expected *PosError, got %v", err)
+	}
+	if pErr.Line != 4 {
+		t.Errorf("Expected line 4, got %v: %v", pErr.Line, pErr)
+	}
+}
+
+func TestLoadNested(t *testing.T) {
+	doc := `
+rules:
+  - id: nested
+    type: seq
+    window: 10s
+    terms:
+      - rule:
+          type: set
+          window: 5s
+          terms:
+            - value: X
+            - value: Y
+      - rule:
+          type: seq
+          window: 5s
+          terms:
+            - value: A
+            - value: B
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	m, ok := rules[0].Matcher.(*match.NestedSeq)
+	if !ok {
+		t.Fatalf("Expected *NestedSeq, got %T", rules[0].Matcher)
+	}
+
+	clock := time.Now().UnixNano()
+	for i, line := range []string{"Y", "X", "A"} {
+		if hits := m.Scan(match.LogEntry{Line: line, Timestamp: clock + int64(i)}); hits.Cnt != 0 {
+			t.Fatalf("Expected no hits, got %v", hits.Cnt)
+		}
+	}
+
+	hits := m.Scan(match.LogEntry{Line: "B", Timestamp: clock + 3})
+	if hits.Cnt != 1 || len(hits.Logs) != 4 {
+		t.Errorf("Expected 1 hit with 4 logs, got %v %v", hits.Cnt, len(hits.Logs))
+	}
+}
+
+func TestLoadNestedError(t *testing.T) {
+	doc := "rules:\n  - id: a\n    type: seq\n    window: 1m\n    terms:\n      - rule:\n          type: set\n          window: 1m\n          terms:\n            - type: regex\n              value: '(['\n"
+
+	_, err := Load("test.yaml", []byte(doc))
+	if !errors.Is(err, match.ErrTermCompile) {
+		t.Fatalf("Expected ErrTermCompile, got %v", err)
+	}
+
+	var pErr *PosError
+	if !errors.As(err, &pErr) || pErr.Line != 11 {
+		t.Errorf("Expected *PosError on line 11, got %v", err)
+	}
+}
+
+func TestLoadPartition(t *testing.T) {
+	doc := `
+rules:
+  - id: crash
+    type: seq
+    window: 10s
+    terms:
+      - value: OOMKilled
+      - value: Back-off
+    partition:
+      type: regex
+      value: 'pod=(\S+)'
+      maxKeys: 100
+      idle: 1m
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	m, ok := rules[0].Matcher.(*match.MatchPartition)
+	if !ok {
+		t.Fatalf("Expected *MatchPartition, got %T", rules[0].Matcher)
+	}
+
+	clock := time.Now().UnixNano()
+	m.Scan(match.LogEntry{Line: "OOMKilled pod=a", Timestamp: clock})
+	if hits := m.Scan(match.LogEntry{Line: "Back-off pod=b", Timestamp: clock + 1}); hits.Cnt != 0 {
+		t.Fatalf("Expected no hits, got %v", hits.Cnt)
+	}
+
+	hits := m.Scan(match.LogEntry{Line: "Back-off pod=a", Timestamp: clock + 2})
+	if hits.Cnt != 1 || hits.Frame(0).Key != "a" {
+		t.Errorf("Expected 1 hit on key a, got %v %v", hits.Cnt, hits.Frame(0).Key)
+	}
+}
+
+func TestLoadPartitionDedupe(t *testing.T) {
+	doc := `
+rules:
+  - id: crash
+    type: single
+    dedupe: 1m
+    terms:
+      - value: OOMKilled
+    partition:
+      type: regex
+      value: 'pod=(\S+)'
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+	if rules[0].Dedupe != nil {
+		t.Errorf("Expected dedupe within the partition, got %v", rules[0].Dedupe)
+	}
+
+	var (
+		m     = rules[0].Matcher
+		clock = time.Now().UnixNano()
+	)
+
+	for i, tc := range []struct {
+		line string
+		cnt  int
+	}{
+		{"OOMKilled pod=a", 1},
+		{"OOMKilled pod=b", 1}, // Not suppressed by a
+		{"OOMKilled pod=a", 0},
+	} {
+		if hits := m.Scan(match.LogEntry{Line: tc.line, Timestamp: clock + int64(i)}); hits.Cnt != tc.cnt {
+			t.Errorf("Line %d: expected %d hits, got %d", i, tc.cnt, hits.Cnt)
+		}
+	}
+}
+
+func TestLoadLateness(t *testing.T) {
+	doc := `
+rules:
+  - id: crash
+    type: seq
+    window: 10s
+    lateness: 2s
+    terms:
+      - value: OOMKilled
+      - value: Back-off
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	m, ok := rules[0].Matcher.(*match.MatchReorder)
+	if !ok {
+		t.Fatalf("Expected *MatchReorder, got %T", rules[0].Matcher)
+	}
+
+	clock := time.Now().UnixNano()
+	m.Scan(match.LogEntry{Line: "Back-off", Timestamp: clock + int64(time.Second)})
+	m.Scan(match.LogEntry{Line: "OOMKilled", Timestamp: clock})
+
+	if hits := m.Flush(); hits.Cnt != 1 {
+		t.Errorf("Expected 1 hit, got %v", hits.Cnt)
+	}
+
+	_, err = Load("test.yaml", []byte(strings.Replace(doc, "2s", "-2s", 1)))
+	if !errors.Is(err, match.ErrLateness) {
+		t.Errorf("Expected ErrLateness, got %v", err)
+	}
+}
+
+func TestLoadGaps(t *testing.T) {
+	doc := `
+rules:
+  - id: restart
+    type: seq
+    window: 1m
+    terms:
+      - value: Killing
+      - value: Started
+        maxGap: 2s
+      - value: Ready
+        minGap: 10s
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	var (
+		m     = rules[0].Matcher
+		clock = time.Now().UnixNano()
+		hits  int
+	)
+
+	for _, e := range []struct {
+		offset time.Duration
+		line   string
+	}{
+		{0, "Killing"},
+		{5 * time.Second, "Started"}, // Too late after Killing
+		{10 * time.Second, "Killing"},
+		{11 * time.Second, "Started"},
+		{15 * time.Second, "Ready"}, // Too soon after Started
+		{30 * time.Second, "Ready"},
+	} {
+		hits += m.Scan(match.LogEntry{Line: e.line, Timestamp: clock + int64(e.offset)}).Cnt
+	}
+
+	if hits != 1 {
+		t.Errorf("Expected 1 hit, got %v", hits)
+	}
+}
+
+func TestLoadPattern(t *testing.T) {
+	doc := `
+rules:
+  - id: restart
+    type: seq
+    window: 1m
+    terms:
+      - value: Killing
+      - anyOf:
+          - value: OOMKilled
+          - value: Error
+      - value: Pulling
+        optional: true
+      - value: Started
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	m, ok := rules[0].Matcher.(*match.MatchPattern)
+	if !ok {
+		t.Fatalf("Expected *MatchPattern, got %T", rules[0].Matcher)
+	}
+
+	var (
+		hits  match.Hits
+		clock = time.Now().UnixNano()
+	)
+
+	for i, line := range []string{"Killing", "Error", "Started"} {
+		hits = m.Scan(match.LogEntry{Line: line, Timestamp: clock + int64(i)})
+	}
+
+	if hits.Cnt != 1 {
+		t.Fatalf("Expected 1 hit, got %v", hits.Cnt)
+	}
+	if step, alt := m.Step(hits.Meta[1].Term); step != 1 || alt != 1 {
+		t.Errorf("Expected step 1 alternative 1, got %d:%d", step, alt)
+	}
+}
+
+func TestParseRepeat(t *testing.T) {
+	tests := map[string]struct {
+		lo, hi int
+		err    bool
+	}{
+		"{3}":   {lo: 3, hi: 3},
+		"{2,5}": {lo: 2, hi: 5},
+		"{3,}":  {lo: 3, hi: match.Unbounded},
+		"{0,1}": {lo: 0, hi: 1},
+		"{0}":   {err: true},
+		"{5,2}": {err: true},
+		"{-1,}": {err: true},
+		"3":     {err: true},
+		"{a}":   {err: true},
+		"{3":    {err: true},
+	}
+
+	for s, tc := range tests {
+		lo, hi, err := parseRepeat(s)
+		switch {
+		case tc.err && !errors.Is(err, ErrRepeat):
+			t.Errorf("%s: expected ErrRepeat, got %v", s, err)
+		case !tc.err && (err != nil || lo != tc.lo || hi != tc.hi):
+			t.Errorf("%s: expected %d,%d, got %d,%d %v", s, tc.lo, tc.hi, lo, hi, err)
+		}
+	}
+}
+
+func TestLoadRepeat(t *testing.T) {
+	doc := `
+rules:
+  - id: flap
+    type: seq
+    window: 1m
+    terms:
+      - value: deploy started
+      - value: connection reset
+        repeat: '{3,}'
+      - value: rollback
+`
+	rules, err := Load("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	var (
+		hits  match.Hits
+		m     = rules[0].Matcher
+		clock = time.Now().UnixNano()
+		lines = []string{"deploy started", "connection reset", "connection reset", "rollback"}
+	)
+
+	for i, line := range lines {
+		if h := m.Scan(match.LogEntry{Line: line, Timestamp: clock + int64(i)}); h.Cnt != 0 {
+			t.Fatalf("Expected no hit on %d resets", i-1)
+		}
+	}
+
+	m.Scan(match.LogEntry{Line: "connection reset", Timestamp: clock + 10})
+	hits = m.Scan(match.LogEntry{Line: "rollback", Timestamp: clock + 11})
+
+	if hits.Cnt != 1 || hits.Meta[1].Count != 3 {
+		t.Errorf("Expected 1 hit on 3 resets, got %v", hits.Meta)
+	}
+}
+
+func TestCompileEngine(t *testing.T) {
+	doc := `
+rules:
+  - id: one
+    type: seq
+    window: 10s
+    terms:
+      - value: alpha
+      - value: beta
+  - id: two
+    type: set
+    window: 10s
+    terms:
+      - value: beta
+      - value: alpha
+`
+	p, err := Parse("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	engine := match.NewEngine()
+	rules, err := p.Compile(match.WithTermCache(engine.Terms()))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	for _, r := range rules {
+		if err := engine.Add(r.Id, r.Matcher); err != nil {
+			t.Fatalf("Expected nil error, got: %v", err)
+		}
+	}
+
+	if engine.Terms().Len() != 2 {
+		t.Errorf("Expected 2 distinct terms, got %v", engine.Terms().Len())
+	}
+
+	clock := time.Now().UnixNano()
+	engine.Scan(match.LogEntry{Line: "alpha", Timestamp: clock})
+	if hits := engine.Scan(match.LogEntry{Line: "beta", Timestamp: clock + 1}); len(hits) != 2 {
+		t.Errorf("Expected 2 rule hits, got %v", hits)
+	}
+}
+
+// A partition builds matchers with the options of its own compile.
+func TestCompileOptsCaptured(t *testing.T) {
+	doc := `
+rules:
+  - id: crash
+    type: single
+    terms:
+      - value: OOMKilled
+    partition:
+      type: regex
+      value: 'pod=(\S+)'
+`
+	p, err := Parse("test.yaml", []byte(doc))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	var first, second int
+	count := func(n *int) match.TraceFunc {
+		return func(ev match.TraceEvent) {
+			if ev.Kind == match.TraceHit {
+				*n += 1
+			}
+		}
+	}
+
+	rules, err := p.Compile(match.WithTracer(count(&first)))
+	if err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+	if _, err := p.Compile(match.WithTracer(count(&second))); err != nil {
+		t.Fatalf("Expected nil error, got: %v", err)
+	}
+
+	clock := time.Now().UnixNano()
+	rules[0].Matcher.Scan(match.LogEntry{Line: "OOMKilled pod=a", Timestamp: clock})
+	rules[0].Matcher.Scan(match.LogEntry{Line: "OOMKilled pod=b", Timestamp: clock + 1})
+
+	if first != 2 || second != 0 {
+		t.Errorf("Expected 2 hits traced on the first compile only, got %d and %d", first, second)
+	}
+}